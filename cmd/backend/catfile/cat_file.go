@@ -1,39 +1,259 @@
 package catfile
 
 import (
+	"bufio"
 	"errors"
+	"fmt"
+	"io"
+	"os"
 	"patchy/objects"
 	"patchy/objects/objecttype"
 	"patchy/refs"
+	"patchy/util"
+	"strings"
 
 	"github.com/spf13/cobra"
 )
 
+var showType bool
+var showSize bool
+var checkExists bool
+var prettyPrint bool
+var batch bool
+var batchCheck bool
+
 func NewCommand() *cobra.Command {
-	return &cobra.Command{
-		Use:   "cat-file <object-hash>",
+	cmd := &cobra.Command{
+		Use: `cat-file <object>
+  cat-file (-t | -s | -e | -p) <object>
+  cat-file <type> <object>
+  cat-file (--batch | --batch-check)`,
 		Short: "Provides details about an object",
-		Long:  `Outputs the contents or details of an object given its hash`,
-		Args:  cobra.ExactArgs(1),
+		Long: `Outputs the contents or details of an object. Without options, the object is pretty printed with a header.
+-t prints the type of the object, -s its size in bytes and -p its contents in a plain format suitable for scripts. -e
+prints nothing and exits with a non-zero status if the object does not exist or is invalid. With <type>, the raw
+contents of the object are printed, and the object must be of that type.
+
+--batch and --batch-check read object names from standard input, one per line, and for each print
+'<hash> <type> <size>', followed by the raw contents and a newline for --batch, or '<name> missing' if the object
+cannot be found.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			hash, err := refs.ParseRev(args[0])
-			if err == nil {
-				args[0] = hash
+			modes := 0
+			for _, set := range []bool{showType, showSize, checkExists, prettyPrint, batch, batchCheck} {
+				if set {
+					modes++
+				}
+			}
+			if modes > 1 {
+				return errors.New("-t, -s, -e, -p, --batch and --batch-check cannot be used together")
+			}
+			if batch || batchCheck {
+				if len(args) > 0 {
+					return errors.New("--batch and --batch-check take object names on standard input")
+				}
+				return runBatch(os.Stdin, os.Stdout)
+			}
+			if modes == 0 && len(args) == 2 {
+				return printRaw(args[0], args[1])
+			}
+			if len(args) != 1 {
+				return errors.New("expected one object name")
+			}
+
+			hash, err := refs.ResolveObject(args[0])
+			if checkExists {
+				if err != nil {
+					return util.ErrExitStatus
+				}
+				if _, _, err := objects.ReadObjectHeader(hash); err != nil {
+					return util.ErrExitStatus
+				}
+				return nil
 			}
-			objType, err := objects.ReadObjectType(args[0])
+			if err != nil {
+				return err
+			}
+			switch {
+			case showType:
+				objType, err := objects.ReadObjectType(hash)
+				if err != nil {
+					return err
+				}
+				util.Println(objType)
+				return nil
+			case showSize:
+				_, size, err := objects.ReadObjectHeader(hash)
+				if err != nil {
+					return err
+				}
+				util.Println(size)
+				return nil
+			case prettyPrint:
+				return printPretty(hash)
+			}
+
+			objType, err := objects.ReadObjectType(hash)
 			if err != nil {
 				return err
 			}
 			switch objType {
 			case objecttype.Blob:
-				return objects.PrintBlob(args[0])
+				return objects.PrintBlob(hash)
 			case objecttype.Tree:
-				return objects.PrintTree(args[0])
+				return objects.PrintTree(hash)
 			case objecttype.Commit:
-				return objects.PrintCommit(args[0])
+				return objects.PrintCommit(hash)
 			default:
 				return errors.New("unknown object type")
 			}
 		},
 	}
+	cmd.Flags().BoolVarP(&showType, "type", "t", false, "show the type of the object")
+	cmd.Flags().BoolVarP(&showSize, "size", "s", false, "show the size of the object")
+	cmd.Flags().BoolVarP(&checkExists, "exists", "e", false, "exit with a non-zero status if the object is missing")
+	cmd.Flags().BoolVarP(&prettyPrint, "pretty", "p", false, "print the contents of the object in a plain format")
+	cmd.Flags().BoolVar(&batch, "batch", false, "print the details and contents of objects named on standard input")
+	cmd.Flags().BoolVar(&batchCheck, "batch-check", false, "print the details of objects named on standard input")
+	return cmd
+}
+
+func printRaw(typeName string, name string) error {
+	expectedType := objecttype.Parse(typeName)
+	if expectedType == objecttype.Unknown {
+		return fmt.Errorf("invalid object type '%s'", typeName)
+	}
+	hash, err := refs.ResolveObject(name)
+	if err != nil {
+		return err
+	}
+	objType, err := objects.ReadObjectType(hash)
+	if err != nil {
+		return err
+	}
+	if objType != expectedType {
+		return &objects.ObjectTypeMismatch{Hash: hash, Expected: expectedType, Actual: objType}
+	}
+	return printContents(hash)
+}
+
+// printContents prints the raw contents of an object, streaming them if the object is too large to hold in memory.
+func printContents(hash string) error {
+	_, size, err := objects.ReadObjectHeader(hash)
+	if err != nil {
+		return err
+	}
+	if size <= objects.StreamThreshold {
+		_, data, err := objects.ReadObject(hash)
+		if err != nil {
+			return err
+		}
+		util.Print(string(data))
+		return nil
+	}
+	if util.Quiet {
+		return nil
+	}
+	reader, err := objects.OpenObject(hash)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+	_, err = io.Copy(os.Stdout, reader)
+	return err
+}
+
+func printPretty(hash string) error {
+	objType, err := objects.ReadObjectType(hash)
+	if err != nil {
+		return err
+	}
+	switch objType {
+	case objecttype.Blob:
+		return printContents(hash)
+	case objecttype.Tree:
+		entries, err := objects.ReadTree(hash)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			entryType := objecttype.Blob
+			if entry.Mode == "040000" {
+				entryType = objecttype.Tree
+			}
+			util.Printf("%s %s %s\t%s\n", entry.Mode, entryType, entry.Hash, entry.Name)
+		}
+	case objecttype.Commit:
+		commit, err := objects.ReadCommit(hash)
+		if err != nil {
+			return err
+		}
+		util.Printf("tree %s\n", commit.Tree)
+		if commit.Parent != nil {
+			util.Printf("parent %s\n", *commit.Parent)
+		}
+		util.Printf("author %s %d\n\n", commit.Author, commit.Time.Unix())
+		util.Println(commit.Message)
+	default:
+		return errors.New("unknown object type")
+	}
+	return nil
+}
+
+// runBatch answers one lookup per line of input. Output is buffered, and only flushed once all of the input available
+// so far has been answered, so that both pipelines and interactive callers waiting on each answer are served well.
+func runBatch(input io.Reader, output io.Writer) error {
+	reader := bufio.NewReader(input)
+	writer := bufio.NewWriter(output)
+	for {
+		if reader.Buffered() == 0 {
+			if err := writer.Flush(); err != nil {
+				return err
+			}
+		}
+		line, err := reader.ReadString('\n')
+		if errors.Is(err, io.EOF) && line == "" {
+			break
+		} else if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		name := strings.TrimRight(line, "\r\n")
+		if err := batchLookup(name, writer); err != nil {
+			return err
+		}
+	}
+	return writer.Flush()
+}
+
+func batchLookup(name string, writer *bufio.Writer) error {
+	hash, err := refs.ResolveObject(name)
+	if err != nil {
+		_, err := fmt.Fprintf(writer, "%s missing\n", name)
+		return err
+	}
+	if batchCheck {
+		objType, size, err := objects.ReadObjectHeader(hash)
+		if err != nil {
+			_, err := fmt.Fprintf(writer, "%s missing\n", name)
+			return err
+		}
+		_, err = fmt.Fprintf(writer, "%s %s %d\n", hash, objType, size)
+		return err
+	}
+	reader, err := objects.OpenObject(hash)
+	if err != nil {
+		_, err := fmt.Fprintf(writer, "%s missing\n", name)
+		return err
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+	if _, err := fmt.Fprintf(writer, "%s %s %d\n", hash, reader.Type, reader.Size); err != nil {
+		return err
+	}
+	if _, err := io.Copy(writer, reader); err != nil {
+		return err
+	}
+	return writer.WriteByte('\n')
 }
@@ -0,0 +1,42 @@
+package debug
+
+import (
+	"errors"
+	"os"
+	"patchy/objects"
+	"patchy/util"
+
+	"github.com/spf13/cobra"
+)
+
+func NewCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "debug <subcommand>",
+		Short: "Inspect the internals of patchy",
+		Long:  `Tools for looking at how patchy behaves internally, meant for debugging and tuning.`,
+	}
+	cmd.AddCommand(&cobra.Command{
+		Use:   "cache-stats <command> [<args>...]",
+		Short: "Run a command and report how the object cache performed",
+		Long: `Runs another patchy command, then prints the hits, misses and evictions of the object cache along with
+how much of its budget is in use to standard error. The budget is set with the core.objectCacheSize config, in bytes
+with an optional k, m or g suffix.`,
+		DisableFlagParsing: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				return errors.New("expected a command to run")
+			}
+			root := cmd.Root()
+			root.SetArgs(args)
+			runErr := root.Execute()
+			stats := objects.GetCacheStats()
+			util.Fprintf(os.Stderr, "hits       %d\n", stats.Hits)
+			util.Fprintf(os.Stderr, "misses     %d\n", stats.Misses)
+			util.Fprintf(os.Stderr, "evictions  %d\n", stats.Evictions)
+			util.Fprintf(os.Stderr, "entries    %d\n", stats.Entries)
+			util.Fprintf(os.Stderr, "memory     %d / %d bytes\n", stats.Used, stats.Budget)
+			return runErr
+		},
+	})
+	return cmd
+}
@@ -0,0 +1,123 @@
+package hashobject
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"patchy/objects"
+	"patchy/objects/objecttype"
+	"patchy/util"
+
+	"github.com/spf13/cobra"
+)
+
+var typeName string
+var write bool
+var fromStdin bool
+
+func NewCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "hash-object [-t <type>] [-w] [--stdin] [<file>...]",
+		Short: "Compute the hash of an object, optionally writing it",
+		Long: `Prints the hash an object of the given type (blob by default) would have with the contents of each file,
+and of standard input with --stdin before any files. Nothing is written unless -w is given. Trees and commits are
+checked to be well formed before they are hashed.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			objType := objecttype.Parse(typeName)
+			if objType == objecttype.Unknown {
+				return fmt.Errorf("invalid object type '%s'", typeName)
+			}
+			if !fromStdin && len(args) == 0 {
+				return errors.New("expected files to hash, or --stdin")
+			}
+			if fromStdin {
+				hash, err := hashStdin(objType)
+				if err != nil {
+					return err
+				}
+				util.Println(hash)
+			}
+			for _, file := range args {
+				hash, err := hashFile(objType, file)
+				if err != nil {
+					return err
+				}
+				util.Println(hash)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&typeName, "type", "t", "blob", "type of object to create")
+	cmd.Flags().BoolVarP(&write, "write", "w", false, "write the object to the object database")
+	cmd.Flags().BoolVar(&fromStdin, "stdin", false, "read the object from standard input")
+	return cmd
+}
+
+func hashFile(objType objecttype.ObjectType, file string) (string, error) {
+	// Blobs need no validation, so they are streamed
+	if objType == objecttype.Blob {
+		f, err := os.Open(file)
+		if err != nil {
+			return "", err
+		}
+		defer func() {
+			_ = f.Close()
+		}()
+		return hashBlob(f)
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	return hashData(objType, data)
+}
+
+// hashStdin hashes standard input. Blobs are streamed as files are, by way of a temporary file, since the size of an
+// object is needed before its contents.
+func hashStdin(objType objecttype.ObjectType) (string, error) {
+	if objType != objecttype.Blob {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return "", err
+		}
+		return hashData(objType, data)
+	}
+	temp, err := os.CreateTemp("", "patchy-stdin-")
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = temp.Close()
+		_ = os.Remove(temp.Name())
+	}()
+	if _, err := io.Copy(temp, os.Stdin); err != nil {
+		return "", err
+	}
+	if _, err := temp.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return hashBlob(temp)
+}
+
+func hashBlob(f *os.File) (string, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	if write {
+		return objects.WriteObjectFrom(objecttype.Blob, f, info.Size())
+	}
+	return objects.HashObject(objecttype.Blob, f, info.Size())
+}
+
+func hashData(objType objecttype.ObjectType, data []byte) (string, error) {
+	if err := objects.ValidateObject(objType, data); err != nil {
+		return "", err
+	}
+	if write {
+		return objects.WriteObject(objType, data)
+	}
+	return objects.HashObject(objType, bytes.NewReader(data), int64(len(data)))
+}
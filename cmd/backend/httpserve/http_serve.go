@@ -0,0 +1,48 @@
+package httpserve
+
+import (
+	"errors"
+	"net/http"
+	"patchy/remote"
+	"patchy/repo"
+	"patchy/util"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var listenAddr string
+var auth string
+
+func NewCommand() *cobra.Command {
+	command := &cobra.Command{
+		Use:   "http-serve [--listen <address>] [--auth <user>:<password>]",
+		Short: "Host the current repository over HTTP",
+		Long: `Serves the current repository over HTTP so that it can be cloned, fetched from and pushed to through
+http:// remote urls. With --auth, clients must authenticate with the given credentials using basic auth.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			repoDir, err := repo.FindRepoDir()
+			if err != nil {
+				return err
+			}
+			username, password := "", ""
+			if auth != "" {
+				var found bool
+				username, password, found = strings.Cut(auth, ":")
+				if !found || username == "" {
+					return errors.New("--auth must be of the form <user>:<password>")
+				}
+			}
+			handler, err := remote.NewHTTPHandler(nil, username, password)
+			if err != nil {
+				return err
+			}
+			util.Printf("Serving %s on %s\n", repoDir, listenAddr)
+			return http.ListenAndServe(listenAddr, handler)
+		},
+	}
+	command.Flags().StringVarP(&listenAddr, "listen", "l", ":8080", "the address to listen on")
+	command.Flags().StringVar(&auth, "auth", "", "require basic auth with the given <user>:<password>")
+	return command
+}
@@ -0,0 +1,205 @@
+package lsfiles
+
+import (
+	"errors"
+	"os"
+	"patchy/ignore"
+	"patchy/objects"
+	"patchy/refs"
+	"patchy/repo"
+	"patchy/util"
+	"path/filepath"
+	"sort"
+
+	"github.com/spf13/cobra"
+)
+
+var cached bool
+var modified bool
+var deleted bool
+var others bool
+var ignored bool
+var nulTerminated bool
+
+func NewCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "ls-files [-c] [-m] [-d] [-o] [-i] [-z]",
+		Short: "List files in the working tree",
+		Long: `Lists files in the working tree relative to the repository root. Tracked files are those in the tree of
+HEAD. -c lists tracked files, which is the default, -m tracked files whose contents differ from HEAD, -d tracked files
+which are missing and -o untracked files. -i lists untracked files that are ignored instead of those that are not.
+Several options list each group in turn. With -z, names are terminated with NUL instead of a newline.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if ignored {
+				others = true
+			}
+			if !modified && !deleted && !others {
+				cached = true
+			}
+			repoRoot, err := repo.FindRepoRoot()
+			if err != nil {
+				return err
+			}
+			tracked, err := trackedFiles()
+			if err != nil {
+				return err
+			}
+			names := make([]string, 0, len(tracked))
+			for name := range tracked {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+
+			if cached {
+				printNames(names)
+			}
+			if modified || deleted {
+				var modifiedNames, deletedNames []string
+				for _, name := range names {
+					hash, err := objects.HashFile(filepath.Join(repoRoot, filepath.FromSlash(name)))
+					if errors.Is(err, os.ErrNotExist) {
+						deletedNames = append(deletedNames, name)
+						continue
+					} else if err != nil {
+						return err
+					}
+					if hash != tracked[name] {
+						modifiedNames = append(modifiedNames, name)
+					}
+				}
+				if modified {
+					// Deleted files count as modified too, as they do with git
+					modifiedNames = append(modifiedNames, deletedNames...)
+					sort.Strings(modifiedNames)
+					printNames(modifiedNames)
+				}
+				if deleted {
+					printNames(deletedNames)
+				}
+			}
+			if others {
+				untracked, err := untrackedFiles(repoRoot, tracked)
+				if err != nil {
+					return err
+				}
+				printNames(untracked)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVarP(&cached, "cached", "c", false, "list tracked files")
+	cmd.Flags().BoolVarP(&modified, "modified", "m", false, "list modified files")
+	cmd.Flags().BoolVarP(&deleted, "deleted", "d", false, "list deleted files")
+	cmd.Flags().BoolVarP(&others, "others", "o", false, "list untracked files")
+	cmd.Flags().BoolVarP(&ignored, "ignored", "i", false, "list ignored untracked files instead")
+	cmd.Flags().BoolVarP(&nulTerminated, "null", "z", false, "terminate names with NUL")
+	return cmd
+}
+
+// trackedFiles maps the name of every file in the tree of HEAD to its blob hash. An unborn branch tracks nothing.
+func trackedFiles() (map[string]string, error) {
+	headState, err := refs.ReadHead()
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]string)
+	if headState.Commit == "" {
+		return files, nil
+	}
+	commit, err := objects.ReadCommit(headState.Commit)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := objects.ReadTreeRecursive(commit.Tree)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range objects.FlattenTreeEntries(entries) {
+		files[filepath.ToSlash(entry.Name)] = entry.Hash
+	}
+	return files, nil
+}
+
+// untrackedFiles walks the working tree for files which are not tracked, and either are or are not ignored depending
+// on --ignored. Everything inside an ignored directory is ignored, except the repository directory itself.
+func untrackedFiles(repoRoot string, tracked map[string]string) ([]string, error) {
+	files := make([]string, 0)
+	err := filepath.WalkDir(repoRoot, func(file string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if file == repoRoot {
+			return nil
+		}
+		relPath, err := filepath.Rel(repoRoot, file)
+		if err != nil {
+			return err
+		}
+		if d.Name() == ".patchy" && relPath == ".patchy" {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		isIgnored, err := ignore.IsIgnored(relPath, d.IsDir())
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if isIgnored {
+				if ignored {
+					return listIgnoredDir(repoRoot, file, tracked, &files)
+				}
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		name := filepath.ToSlash(relPath)
+		if _, ok := tracked[name]; !ok && isIgnored == ignored {
+			files = append(files, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func listIgnoredDir(repoRoot string, dir string, tracked map[string]string, files *[]string) error {
+	err := filepath.WalkDir(dir, func(file string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == ".patchy" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		relPath, err := filepath.Rel(repoRoot, file)
+		if err != nil {
+			return err
+		}
+		if name := filepath.ToSlash(relPath); tracked[name] == "" {
+			*files = append(*files, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return filepath.SkipDir
+}
+
+func printNames(names []string) {
+	terminator := "\n"
+	if nulTerminated {
+		terminator = "\x00"
+	}
+	for _, name := range names {
+		util.Print(name, terminator)
+	}
+}
@@ -0,0 +1,224 @@
+package lstree
+
+import (
+	"errors"
+	"fmt"
+	"patchy/objects"
+	"patchy/objects/objecttype"
+	"patchy/refs"
+	"patchy/repo"
+	"patchy/util"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var recursive bool
+var treesOnly bool
+var nameOnly bool
+var long bool
+var nulTerminated bool
+
+func NewCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "ls-tree [-r] [-d] [--name-only] [--long] [-z] <tree-ish> [<path>...]",
+		Short: "List the contents of a tree object",
+		Long: `Lists the entries of a tree, or of the tree of a commit, as '<mode> <type> <hash>\t<name>'. With paths,
+only matching entries are listed; a path ending in a slash lists the contents of that directory. Inside a subdirectory
+of the working tree, paths and the names listed are relative to it, and only its entries are listed by default. -r recurses into subtrees, -d only lists trees, --name-only only prints names and --long
+adds the size of each blob. With -z, entries are terminated with NUL instead of a newline.`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if nameOnly && long {
+				return errors.New("--name-only and --long cannot be used together")
+			}
+			hash, err := refs.ResolveObject(args[0])
+			if err != nil {
+				return err
+			}
+			objType, err := objects.ReadObjectType(hash)
+			if err != nil {
+				return err
+			}
+			switch objType {
+			case objecttype.Commit:
+				commit, err := objects.ReadCommit(hash)
+				if err != nil {
+					return err
+				}
+				hash = commit.Tree
+			case objecttype.Tree:
+			default:
+				return fmt.Errorf("'%s' is not a tree or a commit", args[0])
+			}
+			prefix, err := workTreePrefix()
+			if err != nil {
+				return err
+			}
+			paths := make([]string, 0, len(args)-1)
+			for _, arg := range args[1:] {
+				p := path.Join(prefix, filepath.ToSlash(arg))
+				if p == ".." || strings.HasPrefix(p, "../") {
+					return &repo.FileNotInRepo{Path: arg}
+				}
+				// Paths naming the current directory or a parent of it list its contents, as ones ending in a slash do
+				clean := path.Clean(filepath.ToSlash(arg))
+				isDir := strings.HasSuffix(arg, "/") || clean == "." || clean == ".." || strings.HasSuffix(clean, "/..")
+				if p != "." && isDir {
+					p += "/"
+				}
+				paths = append(paths, p)
+			}
+			if len(paths) == 0 && prefix != "" {
+				paths = append(paths, prefix+"/")
+			}
+			return listTree(hash, prefix, paths)
+		},
+	}
+	cmd.Flags().BoolVarP(&recursive, "recursive", "r", false, "recurse into subtrees")
+	cmd.Flags().BoolVarP(&treesOnly, "trees-only", "d", false, "only list trees")
+	cmd.Flags().BoolVar(&nameOnly, "name-only", false, "only list the names of entries")
+	cmd.Flags().BoolVarP(&long, "long", "l", false, "show the size of blobs")
+	cmd.Flags().BoolVarP(&nulTerminated, "null", "z", false, "terminate entries with NUL")
+	return cmd
+}
+
+// listTree lists the entries of a tree matching the paths, naming them relative to prefix.
+func listTree(hash string, prefix string, paths []string) error {
+	entries, err := objects.ReadTreeRecursive(hash)
+	if err != nil {
+		return err
+	}
+	if paths = slices.DeleteFunc(paths, func(p string) bool { return p == "." }); len(paths) == 0 {
+		paths = nil
+	}
+	if recursive && !treesOnly {
+		for _, entry := range objects.FlattenTreeEntries(entries) {
+			name := filepath.ToSlash(entry.Name)
+			if matchesPaths(name, paths) {
+				if err := printEntry(entry, relativeName(name, prefix), false); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	return listEntries(entries, "", prefix, paths)
+}
+
+// listEntries lists the entries of a tree read by ReadTreeRecursive, whose own path is dir, descending into subtrees
+// only as far as the paths and -r require.
+func listEntries(entries []objects.TreeEntry, dir string, prefix string, paths []string) error {
+	for _, entry := range entries {
+		name := dir + entry.Name
+		isTree := entry.Mode == "040000"
+		if !matchesPaths(name, paths) {
+			if isTree && leadsToPaths(name, paths) {
+				if err := listEntries(entry.Children, name+"/", prefix, paths); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if !isTree && treesOnly {
+			continue
+		}
+		if !isTree || !recursive || treesOnly {
+			if err := printEntry(entry, relativeName(name, prefix), isTree); err != nil {
+				return err
+			}
+		}
+		if isTree && recursive {
+			if err := listEntries(entry.Children, name+"/", prefix, paths); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// workTreePrefix returns the slash-separated path of the working directory relative to the root of the working tree,
+// which is empty at the root, in bare repositories and outside of the working tree.
+func workTreePrefix() (string, error) {
+	root, err := repo.FindRepoRoot()
+	if errors.Is(err, repo.ErrNoWorkTree) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	cwd, err := filepath.Abs(".")
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(root, cwd)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", nil
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// relativeName turns the path of an entry from the root of the tree into one relative to prefix.
+func relativeName(name string, prefix string) string {
+	if prefix == "" {
+		return name
+	}
+	rel, err := filepath.Rel(filepath.FromSlash(prefix), filepath.FromSlash(name))
+	if err != nil {
+		return name
+	}
+	return filepath.ToSlash(rel)
+}
+
+func printEntry(entry objects.TreeEntry, name string, isTree bool) error {
+	terminator := "\n"
+	if nulTerminated {
+		terminator = "\x00"
+	}
+	if nameOnly {
+		util.Print(name, terminator)
+		return nil
+	}
+	entryType := objecttype.Blob
+	if isTree {
+		entryType = objecttype.Tree
+	}
+	if !long {
+		util.Printf("%s %s %s\t%s%s", entry.Mode, entryType, entry.Hash, name, terminator)
+		return nil
+	}
+	size := "-"
+	if !isTree {
+		_, blobSize, err := objects.ReadObjectHeader(entry.Hash)
+		if err != nil {
+			return err
+		}
+		size = fmt.Sprint(blobSize)
+	}
+	util.Printf("%s %s %s %7s\t%s%s", entry.Mode, entryType, entry.Hash, size, name, terminator)
+	return nil
+}
+
+// matchesPaths reports whether an entry is named by one of the paths, or is inside a directory named by one.
+func matchesPaths(name string, paths []string) bool {
+	if len(paths) == 0 {
+		return true
+	}
+	for _, p := range paths {
+		if name == p || strings.HasPrefix(name, strings.TrimSuffix(p, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func leadsToPaths(dir string, paths []string) bool {
+	for _, p := range paths {
+		if strings.HasPrefix(p, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
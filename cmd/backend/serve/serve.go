@@ -0,0 +1,31 @@
+package serve
+
+import (
+	"os"
+	"patchy/remote"
+	"patchy/repo"
+
+	"github.com/spf13/cobra"
+)
+
+func NewCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "serve [<directory>]",
+		Short: "Serve a repository to a fetch or push over standard input and output",
+		Long: `Speaks the patchy transfer protocol over standard input and output on behalf of the repository in
+<directory> (the current directory by default): advertises its refs, then either sends the objects a fetching client is
+missing or receives the objects and ref updates of a push. It is meant to be spawned by a client, for example through
+ssh:// or ext:: remote urls.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var r *repo.Repository
+			if len(args) > 0 {
+				var err error
+				if r, err = repo.Discover(args[0]); err != nil {
+					return err
+				}
+			}
+			return remote.Serve(r, os.Stdin, os.Stdout)
+		},
+	}
+}
@@ -0,0 +1,178 @@
+package blame
+
+import (
+	"errors"
+	"fmt"
+	"patchy/diff"
+	"patchy/objects"
+	"patchy/refs"
+	"patchy/repo"
+	"patchy/util"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+var lineRange string
+var porcelain bool
+
+func NewCommand() *cobra.Command {
+	command := &cobra.Command{
+		Use:   "blame [-L <start>,<end>] [--porcelain] <path> [<rev>]",
+		Short: "Show which commit last changed each line of a file",
+		Long: `Shows each line of a file as of <rev>, HEAD by default, along with the commit which last changed it and
+its author and date. The history of the file is followed across renames, in which case the line is shown with the
+name the file had in that commit too.
+
+-L limits the output to the lines from <start> to <end>, either of which may be left out to start at the first line
+or end at the last. <end> may also be given as +<count>. --porcelain shows the lines in a format meant for scripts,
+where each line is preceded by the hash of its commit and its line numbers there and in <rev>, and the author, date
+and summary of each commit are given the first time it comes up.`,
+		Args: cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			revSpec := "HEAD"
+			if len(args) > 1 {
+				revSpec = args[1]
+			}
+			commitHash, err := refs.ParseRev(revSpec)
+			if err != nil {
+				return err
+			}
+			path, err := repoPath(args[0])
+			if err != nil {
+				return err
+			}
+			start, end, err := parseLineRange(lineRange)
+			if err != nil {
+				return err
+			}
+			lines, err := diff.Blame(commitHash, path, start, end)
+			if err != nil {
+				return err
+			}
+			if porcelain {
+				return printPorcelain(lines)
+			}
+			return printBlame(lines, path)
+		},
+	}
+	command.Flags().StringVarP(&lineRange, "lines", "L", "", "only show the lines in the given range")
+	command.Flags().BoolVar(&porcelain, "porcelain", false, "show the output in a format meant for scripts")
+	return command
+}
+
+// repoPath turns a path relative to the current directory into a slash-separated one relative to the root of the
+// repository. In bare repositories, paths are taken to be relative to the root already.
+func repoPath(path string) (string, error) {
+	repoRoot, err := repo.FindRepoRoot()
+	if errors.Is(err, repo.ErrNoWorkTree) {
+		return filepath.ToSlash(filepath.Clean(path)), nil
+	} else if err != nil {
+		return "", err
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	relPath, err := filepath.Rel(repoRoot, absPath)
+	if err != nil || relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+		return "", &repo.FileNotInRepo{Path: path}
+	}
+	return filepath.ToSlash(relPath), nil
+}
+
+// parseLineRange parses the argument of -L, returning 0 for an end which was left out.
+func parseLineRange(lineRange string) (int, int, error) {
+	if lineRange == "" {
+		return 1, 0, nil
+	}
+	invalid := fmt.Errorf("invalid line range '%s'", lineRange)
+	startText, endText, _ := strings.Cut(lineRange, ",")
+	start, end := 1, 0
+	var err error
+	if startText != "" {
+		if start, err = strconv.Atoi(startText); err != nil || start < 1 {
+			return 0, 0, invalid
+		}
+	}
+	if count, isCount := strings.CutPrefix(endText, "+"); isCount {
+		n, err := strconv.Atoi(count)
+		if err != nil || n < 1 {
+			return 0, 0, invalid
+		}
+		end = start + n - 1
+	} else if endText != "" {
+		if end, err = strconv.Atoi(endText); err != nil || end < start {
+			return 0, 0, invalid
+		}
+	}
+	return start, end, nil
+}
+
+func printBlame(lines []diff.BlameLine, path string) error {
+	if len(lines) == 0 {
+		return nil
+	}
+	commits := make(map[string]*objects.Commit)
+	authorWidth, pathWidth, showPaths := 0, 0, false
+	for _, line := range lines {
+		if _, ok := commits[line.Commit]; !ok {
+			commit, err := objects.ReadCommit(line.Commit)
+			if err != nil {
+				return err
+			}
+			commits[line.Commit] = commit
+		}
+		authorWidth = max(authorWidth, len(commits[line.Commit].Author))
+		pathWidth = max(pathWidth, len(line.Path))
+		showPaths = showPaths || line.Path != path
+	}
+	numberWidth := len(strconv.Itoa(lines[len(lines)-1].FinalLine))
+	for _, line := range lines {
+		commit := commits[line.Commit]
+		util.ColorPrint(color.FgYellow, line.Commit[:7])
+		if showPaths {
+			util.Printf(" %-*s", pathWidth, line.Path)
+		}
+		util.Printf(" (%-*s %s %*d) %s\n", authorWidth, commit.Author, commit.Time.Format("2006-01-02 15:04:05 -0700"),
+			numberWidth, line.FinalLine, strings.TrimSuffix(line.Text, "\n"))
+	}
+	return nil
+}
+
+// printPorcelain prints each group of consecutive lines from the same commit under a header giving the line numbers of
+// its first line and the size of the group, and each line of it under a header of its own. The details of a commit are
+// only given under the first header for it.
+func printPorcelain(lines []diff.BlameLine) error {
+	shown := make(map[string]bool)
+	for i, line := range lines {
+		groupStart := i == 0 || lines[i-1].Commit != line.Commit || lines[i-1].OrigLine != line.OrigLine-1
+		if !groupStart {
+			util.Printf("%s %d %d\n", line.Commit, line.OrigLine, line.FinalLine)
+		} else {
+			size := 1
+			for size < len(lines)-i && lines[i+size].Commit == line.Commit &&
+				lines[i+size].OrigLine == line.OrigLine+size {
+				size++
+			}
+			util.Printf("%s %d %d %d\n", line.Commit, line.OrigLine, line.FinalLine, size)
+		}
+		if !shown[line.Commit] {
+			shown[line.Commit] = true
+			commit, err := objects.ReadCommit(line.Commit)
+			if err != nil {
+				return err
+			}
+			util.Printf("author %s\n", commit.Author)
+			util.Printf("author-time %d\n", commit.Time.Unix())
+			util.Printf("author-tz %s\n", commit.Time.Format("-0700"))
+			util.Printf("summary %s\n", strings.SplitN(commit.Message, "\n", 2)[0])
+			util.Printf("filename %s\n", line.Path)
+		}
+		util.Printf("\t%s\n", strings.TrimSuffix(line.Text, "\n"))
+	}
+	return nil
+}
@@ -3,69 +3,285 @@ package branch
 import (
 	"errors"
 	"fmt"
-	"os"
+	"patchy/objects"
 	"patchy/refs"
-	"patchy/repo"
 	"patchy/util"
-	"path/filepath"
+	"path"
+	"strings"
 
+	"github.com/fatih/color"
 	"github.com/spf13/cobra"
 )
 
 var deleteBranch bool
+var forceDelete bool
+var moveBranch bool
+var copyBranch bool
+var force bool
+var listBranches bool
+var contains string
+var merged string
+var noMerged string
+var setUpstreamTo string
+var unsetUpstream bool
+var verbose int
 
 func NewCommand() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:   "branch [<branch-name>]",
-		Short: "List, create, or delete branches",
-		Long:  `List all branches, or create/delete a branch if a branch name is provided`,
-		Args:  cobra.MaximumNArgs(1),
+		Use: `branch [-v[v]] [--list] [--contains <rev>] [--merged[=<rev>]] [--no-merged[=<rev>]] [<pattern>...]
+  branch [-f] <branch-name> [<start-point>]
+  branch (-m | -c) [-f] [<old-branch>] <new-branch>
+  branch (-d | -D) <branch-name>...
+  branch (-u <upstream> | --unset-upstream) [<branch-name>]`,
+		Short: "List, create, rename, copy or delete branches",
+		Long: `Without arguments, or with --list, lists branches, optionally only those matching one of the given glob
+patterns, containing a revision or merged (or not merged) into a revision, HEAD by default.
+
+With a branch name, creates a branch at <start-point>, HEAD by default; -f resets the branch if it already exists.
+-m renames and -c copies a branch (the current branch by default) along with its upstream configuration; with -f the
+destination is overwritten. -d deletes branches which are merged into their upstream, or into HEAD if they have none;
+-D deletes them regardless. The checked out branch can never be deleted.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			if deleteBranch {
-				if len(args) != 1 {
-					return errors.New("branch name required")
-				}
-			}
-			repoDir, err := repo.FindRepoDir()
-			if err != nil {
-				return err
-			}
-			if len(args) == 1 {
-				branchName := args[0]
-				commitHash, err := refs.ResolveRef("refs/heads/" + branchName)
-				if deleteBranch {
-					if err != nil {
-						return err
-					}
-					if err := os.RemoveAll(filepath.Join(repoDir, "/refs/heads/", branchName)); err != nil {
-						return err
-					}
-					util.Printf("Removed branch %s (was %s)\n", branchName, commitHash[:7])
-					return nil
+			switch {
+			case setUpstreamTo != "" || unsetUpstream:
+				if len(args) > 1 {
+					return errors.New("too many arguments")
 				}
-				if err == nil {
-					return fmt.Errorf("branch %s already exists", branchName)
+				return updateUpstream(args)
+			case deleteBranch || forceDelete:
+				if len(args) == 0 {
+					return errors.New("branch name required")
 				}
-				return refs.NewBranch(branchName, "@")
+				return deleteBranches(args)
+			case moveBranch || copyBranch:
+				return moveOrCopyBranch(args)
+			case listBranches || len(args) == 0 || contains != "" || merged != "" || noMerged != "":
+				return listMatchingBranches(args)
 			}
-			branches, err := refs.ListBranches()
-			if err != nil {
-				return err
+			if len(args) > 2 {
+				return errors.New("too many arguments")
 			}
-			headState, err := refs.ReadHead()
-			if err != nil {
-				return err
+			startPoint := "@"
+			if len(args) == 2 {
+				startPoint = args[1]
 			}
-			for _, branch := range branches {
-				prefix := "  "
-				if headState.Ref == "refs/heads/"+branch.Name {
-					prefix = "* "
-				}
-				util.Printf("%s%s\n", prefix, branch.Name)
+			if force {
+				return refs.ResetBranch(args[0], startPoint)
 			}
-			return nil
+			return refs.NewBranch(args[0], startPoint)
 		},
 	}
-	cmd.Flags().BoolVarP(&deleteBranch, "delete", "d", false, "delete branch")
+	cmd.Flags().BoolVarP(&deleteBranch, "delete", "d", false, "delete fully merged branches")
+	cmd.Flags().BoolVarP(&forceDelete, "force-delete", "D", false, "delete branches even if they are not merged")
+	cmd.Flags().BoolVarP(&moveBranch, "move", "m", false, "rename a branch")
+	cmd.Flags().BoolVarP(&copyBranch, "copy", "c", false, "copy a branch")
+	cmd.Flags().BoolVarP(&force, "force", "f", false, "reset or overwrite existing branches")
+	cmd.Flags().BoolVarP(&listBranches, "list", "l", false, "list branches matching the given patterns")
+	cmd.Flags().StringVar(&contains, "contains", "", "only list branches containing the revision")
+	cmd.Flags().StringVar(&merged, "merged", "", "only list branches merged into the revision")
+	cmd.Flags().Lookup("merged").NoOptDefVal = "HEAD"
+	cmd.Flags().StringVar(&noMerged, "no-merged", "", "only list branches not merged into the revision")
+	cmd.Flags().Lookup("no-merged").NoOptDefVal = "HEAD"
+	cmd.Flags().StringVarP(&setUpstreamTo, "set-upstream-to", "u", "", "set the upstream of the branch")
+	cmd.Flags().BoolVar(&unsetUpstream, "unset-upstream", false, "remove the upstream of the branch")
+	cmd.Flags().CountVarP(&verbose, "verbose", "v", "show the last commit of each branch; twice to also show upstreams")
 	return cmd
 }
+
+func deleteBranches(names []string) error {
+	for _, name := range names {
+		commitHash, err := refs.ResolveRef("refs/heads/" + name)
+		if err != nil {
+			return err
+		}
+		if err := refs.DeleteBranch(name, forceDelete); errors.As(err, &refs.ErrBranchNotMerged) {
+			return fmt.Errorf("%w\nIf you are sure you want to delete it, run 'patchy branch -D %s'", err, name)
+		} else if err != nil {
+			return err
+		}
+		util.Printf("Removed branch %s (was %s)\n", name, commitHash[:7])
+	}
+	return nil
+}
+
+func moveOrCopyBranch(args []string) error {
+	if moveBranch && copyBranch {
+		return errors.New("-m and -c cannot be used together")
+	}
+	var oldName, newName string
+	switch len(args) {
+	case 1:
+		headState, err := refs.ReadHead()
+		if err != nil {
+			return err
+		}
+		if headState.Detached {
+			return errors.New("HEAD is detached, the branch to rename or copy is required")
+		}
+		oldName, newName = strings.TrimPrefix(headState.Ref, "refs/heads/"), args[0]
+	case 2:
+		oldName, newName = args[0], args[1]
+	default:
+		return errors.New("expected one or two branch names")
+	}
+	if moveBranch {
+		return refs.RenameBranch(oldName, newName, force)
+	}
+	return refs.CopyBranch(oldName, newName, force)
+}
+
+func updateUpstream(args []string) error {
+	branchName := ""
+	if len(args) == 1 {
+		branchName = args[0]
+	} else {
+		headState, err := refs.ReadHead()
+		if err != nil {
+			return err
+		}
+		if headState.Detached {
+			return errors.New("HEAD is detached, a branch name is required")
+		}
+		branchName = strings.TrimPrefix(headState.Ref, "refs/heads/")
+	}
+	if unsetUpstream {
+		return refs.UnsetUpstream(branchName)
+	}
+	if err := refs.SetUpstream(branchName, setUpstreamTo); err != nil {
+		return err
+	}
+	upstream, err := refs.Upstream(branchName)
+	if err != nil {
+		return err
+	}
+	util.Printf("branch '%s' set up to track '%s'.\n", branchName, refs.ShortRefName(upstream))
+	return nil
+}
+
+func listMatchingBranches(patterns []string) error {
+	branches, err := refs.ListBranches()
+	if err != nil {
+		return err
+	}
+	branches, err = filterBranches(branches, patterns)
+	if err != nil {
+		return err
+	}
+	headState, err := refs.ReadHead()
+	if err != nil {
+		return err
+	}
+	nameWidth := 0
+	for _, branch := range branches {
+		nameWidth = max(nameWidth, len(branch.Name))
+	}
+	for _, branch := range branches {
+		current := headState.Ref == "refs/heads/"+branch.Name
+		if current {
+			util.Print("* ")
+			util.ColorPrint(color.FgGreen, branch.Name)
+		} else {
+			util.Print("  ", branch.Name)
+		}
+		if verbose == 0 {
+			util.Println()
+			continue
+		}
+		util.Print(strings.Repeat(" ", nameWidth-len(branch.Name)+1))
+		util.ColorPrint(color.FgYellow, branch.CommitHash[:7])
+		util.Print(" ")
+		if tracking, err := describeUpstream(branch); err != nil {
+			return err
+		} else if tracking != "" {
+			util.Print(tracking, " ")
+		}
+		commit, err := objects.ReadCommit(branch.CommitHash)
+		if err != nil {
+			return err
+		}
+		util.Println(strings.SplitN(commit.Message, "\n", 2)[0])
+	}
+	return nil
+}
+
+func describeUpstream(branch refs.Branch) (string, error) {
+	status, err := refs.GetUpstreamStatus(branch)
+	if err != nil || status == nil {
+		return "", err
+	}
+	counts := make([]string, 0, 2)
+	if status.Gone {
+		counts = append(counts, "gone")
+	}
+	if status.Ahead > 0 {
+		counts = append(counts, fmt.Sprintf("ahead %d", status.Ahead))
+	}
+	if status.Behind > 0 {
+		counts = append(counts, fmt.Sprintf("behind %d", status.Behind))
+	}
+	if verbose < 2 {
+		if len(counts) == 0 {
+			return "", nil
+		}
+		return "[" + strings.Join(counts, ", ") + "]", nil
+	}
+	description := color.BlueString(refs.ShortRefName(status.Upstream))
+	if len(counts) > 0 {
+		description += ": " + strings.Join(counts, ", ")
+	}
+	return "[" + description + "]", nil
+}
+
+func filterBranches(branches []refs.Branch, patterns []string) ([]refs.Branch, error) {
+	filtered := make([]refs.Branch, 0, len(branches))
+	for _, branch := range branches {
+		if keep, err := matchesFilters(branch, patterns); err != nil {
+			return nil, err
+		} else if keep {
+			filtered = append(filtered, branch)
+		}
+	}
+	return filtered, nil
+}
+
+func matchesFilters(branch refs.Branch, patterns []string) (bool, error) {
+	if len(patterns) > 0 {
+		matched := false
+		for _, pattern := range patterns {
+			if ok, err := path.Match(pattern, branch.Name); err != nil {
+				return false, err
+			} else if ok {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false, nil
+		}
+	}
+	if contains != "" {
+		commitHash, err := refs.ParseRev(contains)
+		if err != nil {
+			return false, err
+		}
+		if ok, err := objects.IsAncestor(commitHash, branch.CommitHash); err != nil || !ok {
+			return false, err
+		}
+	}
+	for _, filter := range []struct {
+		rev    string
+		merged bool
+	}{{merged, true}, {noMerged, false}} {
+		if filter.rev == "" {
+			continue
+		}
+		commitHash, err := refs.ParseRev(filter.rev)
+		if err != nil {
+			return false, err
+		}
+		if ok, err := objects.IsAncestor(branch.CommitHash, commitHash); err != nil || ok != filter.merged {
+			return false, err
+		}
+	}
+	return true, nil
+}
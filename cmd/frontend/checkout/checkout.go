@@ -1,8 +1,11 @@
 package checkout
 
 import (
+	"errors"
 	"patchy/diff"
+	"patchy/hooks"
 	"patchy/refs"
+	"patchy/repo"
 	"patchy/util"
 
 	"github.com/fatih/color"
@@ -10,14 +13,27 @@ import (
 )
 
 var newBranch bool
+var force bool
 
 func NewCommand() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:   "checkout [-b] <branch> | <revspec>",
+		Use: `checkout [-b] <branch> | <revspec>
+  checkout [-f] [<revspec>] -- <pathspec>...`,
 		Short: "Switches between branches or checks out a specific commit",
-		Long:  `Switches between branches or checks out a specific commit`,
-		Args:  cobra.ExactArgs(1),
+		Long: `Switches between branches or checks out a specific commit.
+
+With pathspecs, restores the matching files from <revspec>, HEAD by default, instead, without moving HEAD, just like
+restore --source <revspec>. Files with local changes are only overwritten with --force.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if _, err := repo.FindRepoRoot(); err != nil {
+				return err
+			}
+			if dash := cmd.ArgsLenAtDash(); dash != -1 {
+				return checkoutPaths(args[:dash], args[dash:])
+			}
+			if len(args) != 1 {
+				return errors.New("expected a single branch or revision")
+			}
 			headState, err := refs.ReadHead()
 			if err != nil {
 				return err
@@ -32,8 +48,10 @@ func NewCommand() *cobra.Command {
 				if err != nil {
 					return err
 				}
-				err = refs.UpdateHead(args[0])
-				return err
+				if err = refs.UpdateHead(args[0]); err != nil {
+					return err
+				}
+				return runPostCheckout(headState.Commit, headState.Commit, true)
 			}
 			changes, err := diff.WorkingTreeDiff()
 			if err != nil {
@@ -65,9 +83,47 @@ func NewCommand() *cobra.Command {
 			} else {
 				util.Printf("Switched to branch '%s'\n", args[0])
 			}
-			return nil
+			return runPostCheckout(headState.Commit, newHeadState.Commit, true)
 		},
 	}
 	cmd.Flags().BoolVarP(&newBranch, "branch", "b", false, "Create a new branch")
+	cmd.Flags().BoolVarP(&force, "force", "f", false, "Overwrite local changes when checking out paths")
 	return cmd
 }
+
+func checkoutPaths(revSpecs []string, pathspecs []string) error {
+	if len(revSpecs) > 1 {
+		return errors.New("expected at most one revision before '--'")
+	} else if len(pathspecs) == 0 {
+		return errors.New("expected paths after '--'")
+	}
+	revSpec := "HEAD"
+	if len(revSpecs) == 1 {
+		revSpec = revSpecs[0]
+	}
+	changed, err := refs.CheckoutPaths(revSpec, pathspecs, force)
+	if err != nil {
+		return err
+	}
+	if len(changed) == 1 {
+		util.Printf("Updated 1 path from %s\n", revSpec)
+	} else {
+		util.Printf("Updated %d paths from %s\n", len(changed), revSpec)
+	}
+	headState, err := refs.ReadHead()
+	if err != nil {
+		return err
+	}
+	return runPostCheckout(headState.Commit, headState.Commit, false)
+}
+
+// runPostCheckout runs the post-checkout hook, which is told the commits HEAD was at before and after, and whether a
+// branch or commit was checked out rather than just some paths. It runs once the checkout is done, so its exit status
+// only becomes that of the command.
+func runPostCheckout(prevHead string, newHead string, branchCheckout bool) error {
+	flag := "0"
+	if branchCheckout {
+		flag = "1"
+	}
+	return hooks.Run(nil, hooks.PostCheckout, "", hooks.OrZeroHash(prevHead), hooks.OrZeroHash(newHead), flag)
+}
@@ -0,0 +1,58 @@
+package cherrypick
+
+import (
+	"errors"
+	"fmt"
+	"patchy/sequencer"
+
+	"github.com/spf13/cobra"
+)
+
+var continuePick bool
+var skipPick bool
+var abortPick bool
+
+func NewCommand() *cobra.Command {
+	command := &cobra.Command{
+		Use: `cherry-pick <rev>...
+  cherry-pick (--continue | --skip | --abort)`,
+		Short: "Apply the changes introduced by existing commits",
+		Long: `Applies the changes introduced by each of the given commits onto HEAD, in order, creating a new commit for
+each with the original message and author. The working tree must be clean.
+
+If the changes of a commit conflict with HEAD, the conflicting files are left with conflict markers and the cherry-pick
+stops. Once they are resolved, --continue commits the result and applies the remaining commits; --skip drops the
+conflicting commit instead and --abort returns to where the cherry-pick started.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			err := runSequencer(args, sequencer.CherryPick)
+			if errors.As(err, &sequencer.ErrStoppedOnConflict) || errors.As(err, &sequencer.ErrUnresolvedConflicts) {
+				return fmt.Errorf("%w\nAfter resolving the conflicts, run 'patchy cherry-pick --continue', or use "+
+					"'patchy cherry-pick --skip' to skip this commit or 'patchy cherry-pick --abort' to cancel", err)
+			}
+			return err
+		},
+	}
+	command.Flags().BoolVar(&continuePick, "continue", false, "continue after resolving conflicts")
+	command.Flags().BoolVar(&skipPick, "skip", false, "skip the commit that stopped on a conflict")
+	command.Flags().BoolVar(&abortPick, "abort", false, "cancel and return to the state before the cherry-pick")
+	command.MarkFlagsMutuallyExclusive("continue", "skip", "abort")
+	return command
+}
+
+func runSequencer(args []string, start func([]string) error) error {
+	resuming := continuePick || skipPick || abortPick
+	if resuming && len(args) > 0 {
+		return errors.New("--continue, --skip and --abort do not take revisions")
+	} else if !resuming && len(args) == 0 {
+		return errors.New("at least one revision is required")
+	}
+	switch {
+	case continuePick:
+		return sequencer.Continue()
+	case skipPick:
+		return sequencer.Skip()
+	case abortPick:
+		return sequencer.Abort()
+	}
+	return start(args)
+}
@@ -0,0 +1,33 @@
+package clone
+
+import (
+	"patchy/remote"
+	"patchy/util"
+
+	"github.com/spf13/cobra"
+)
+
+func NewCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "clone <repository> [<directory>]",
+		Short: "Clone a repository into a new directory",
+		Long: `Creates a new repository in <directory>, adds the source repository as the remote 'origin', fetches all of
+its branches into remote-tracking refs and checks out its current branch`,
+		Args: cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir := ""
+			if len(args) > 1 {
+				dir = args[1]
+			}
+			result, err := remote.Clone(args[0], dir)
+			if err != nil {
+				return err
+			}
+			util.Println("Cloned into", result.RepoDir)
+			if result.Branch == "" {
+				util.Println("Warning: You appear to have cloned an empty repository.")
+			}
+			return nil
+		},
+	}
+}
@@ -1,7 +1,12 @@
 package commit
 
 import (
+	"errors"
+	"io"
+	"os"
+	"patchy/commitmsg"
 	"patchy/diff"
+	"patchy/hooks"
 	"patchy/objects"
 	"patchy/refs"
 	"patchy/repo"
@@ -12,49 +17,151 @@ import (
 	"github.com/spf13/cobra"
 )
 
-var commitMessage string
+var messages []string
+var messageFile string
+var allowEmpty bool
+var allowEmptyMessage bool
+var noVerify bool
+var amend bool
+var noEdit bool
+var all bool
+var patch bool
 
 func NewCommand() *cobra.Command {
 	command := &cobra.Command{
-		Use:   "commit [--message <message>]",
+		Use: `commit [--amend [--no-edit]] [--no-verify] [--allow-empty] [--allow-empty-message]
+  [-m <message>... | -F <file>] [-a | -p | [--] <pathspec>...]`,
 		Short: "Create a new commit recording the current state of the repository",
-		Long: `Creates a new commit containing the current state of the repository. The new commit will be a child of 
-HEAD, and the HEAD reference will be updated to point to the new commit, unless in a detached HEAD state.`,
-		Args: cobra.NoArgs,
+		Long: `Creates a new commit containing the current state of the repository. The new commit will be a child of
+HEAD, and the HEAD reference will be updated to point to the new commit, unless in a detached HEAD state.
+
+The message is taken from -m, with each one given becoming a paragraph, or read from the file given with -F, or from
+stdin if it is '-'. Otherwise the editor is opened on COMMIT_EDITMSG to write it, with the changes being committed
+listed in comments. Commits with an empty message are aborted unless --allow-empty-message is given, and commits that
+change nothing unless --allow-empty is.
+
+With --amend, HEAD is replaced by a new commit with the current state of the repository instead, which keeps its
+parent and author. Its message is offered for editing unless a new one is given, or reused as is with --no-edit.
+
+Given pathspecs, only the matching files are committed as they are in the working tree, and every other file is kept
+as it is in HEAD. Matching files which have been deleted are deleted in the commit as well. Without pathspecs, or with
+-a, all changes in the working tree are committed.
+
+With -p, each hunk of the changes to files in HEAD is shown in turn, and only the chosen ones are committed. A hunk can
+be committed (y) or not (n), split into smaller ones (s), or edited by hand (e), and q leaves all of the remaining
+hunks out.`,
+		Args: cobra.ArbitraryArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(messages) > 0 && messageFile != "" {
+				return errors.New("options -m and -F cannot be used together")
+			}
+			if all && len(args) > 0 {
+				return errors.New("paths cannot be given with -a")
+			}
+			if patch && (all || len(args) > 0) {
+				return errors.New("option -p cannot be used with -a or paths")
+			}
+			if patch && messageFile == "-" {
+				return errors.New("option -p cannot be used with -F -, as hunks are chosen on stdin")
+			}
 			repoRoot, err := repo.FindRepoRoot()
 			if err != nil {
 				return err
 			}
+			if !noVerify {
+				if err := hooks.Run(nil, hooks.PreCommit, ""); err != nil {
+					return err
+				}
+			}
 
 			treeHash, err := objects.WriteTree(repoRoot)
 			if err != nil {
 				return err
 			}
+			if len(args) > 0 {
+				if treeHash, err = refs.PartialTree(treeHash, args); err != nil {
+					return err
+				}
+			} else if patch {
+				if treeHash, err = diff.SelectHunks(os.Stdin); err != nil {
+					return err
+				}
+			}
 
 			headStatus, err := refs.ReadHead()
 			if err != nil {
 				return err
 			}
 			var parentHash *string = nil
-			if len(headStatus.Commit) > 0 {
+			var amended *objects.Commit
+			if amend {
+				if headStatus.Commit == "" {
+					return errors.New("you have nothing to amend")
+				}
+				if amended, err = objects.ReadCommit(headStatus.Commit); err != nil {
+					return err
+				}
+				parentHash = amended.Parent
+			} else if len(headStatus.Commit) > 0 {
 				parentHash = &headStatus.Commit
+			}
+			prevTreeHash := ""
+			if parentHash != nil {
 				parent, err := objects.ReadCommit(*parentHash)
 				if err != nil {
 					return err
 				}
-				if parent.Tree == treeHash {
-					util.Println("Nothing to commit, working tree clean")
+				if parent.Tree == treeHash && !allowEmpty {
+					if amend {
+						return errors.New("amending the most recent commit would make it empty")
+					}
+					switch {
+					case patch:
+						util.Println("No changes selected")
+					case len(args) > 0:
+						util.Println("Nothing to commit in the given paths")
+					default:
+						util.Println("Nothing to commit, working tree clean")
+					}
 					return nil
 				}
+				prevTreeHash = parent.Tree
+			} else if patch && amended == nil {
+				// Without a HEAD there are no modified files to choose hunks from
+				util.Println("No changes selected")
+				return nil
+			}
+			changes, err := diff.TreeDiff(treeHash, prevTreeHash)
+			if err != nil {
+				return err
+			}
+
+			message, err := commitMessage(headStatus, amended, changes)
+			if err != nil {
+				return err
+			}
+			if message == "" && !allowEmptyMessage {
+				return &commitmsg.EmptyMessage{}
+			}
+			var hash string
+			if amended != nil {
+				hash, err = objects.WriteCommitWithAuthor(treeHash, parentHash, message, amended.Author, amended.Time)
+			} else {
+				hash, err = objects.WriteCommit(treeHash, parentHash, message)
 			}
-			hash, err := objects.WriteCommit(treeHash, parentHash, commitMessage)
 			if err != nil {
 				return err
 			}
 			if !headStatus.Detached {
 				err = refs.UpdateRef(headStatus.Ref, hash)
+			} else if amended != nil {
+				// The amended commit replaces HEAD even when detached, as nothing else would point at it
+				err = refs.UpdateHead(hash)
+			}
+			if err != nil {
+				return err
 			}
+			_ = hooks.Run(nil, hooks.PostCommit, "")
 
 			var branchName string
 			if headStatus.Detached {
@@ -66,23 +173,99 @@ HEAD, and the HEAD reference will be updated to point to the new commit, unless
 				branchName = headStatus.Ref[len("refs/heads/"):]
 			}
 			util.ColorPrintf(color.FgCyan, "[%s %s] ", branchName, hash[:7])
-			util.Println(strings.SplitN(commitMessage, "\n", 2)[0])
-			prevTreeHash := ""
-			if parentHash != nil {
-				parentCommit, err := objects.ReadCommit(*parentHash)
-				if err != nil {
-					return err
-				}
-				prevTreeHash = parentCommit.Tree
-			}
-			changes, err := diff.TreeDiff(treeHash, prevTreeHash)
-			if err != nil {
-				return err
-			}
+			util.Println(strings.SplitN(message, "\n", 2)[0])
 			diff.PrintDiffSummary(changes)
 			return nil
 		},
 	}
-	command.Flags().StringVarP(&commitMessage, "message", "m", "", "the commit message")
+	command.Flags().StringArrayVarP(&messages, "message", "m", nil, "use the given message, as a paragraph of its own")
+	command.Flags().StringVarP(&messageFile, "file", "F", "", "take the message from the given file, or - for stdin")
+	command.Flags().BoolVar(&allowEmpty, "allow-empty", false, "allow a commit that changes nothing")
+	command.Flags().BoolVar(&allowEmptyMessage, "allow-empty-message", false, "allow a commit with an empty message")
+	command.Flags().BoolVarP(&noVerify, "no-verify", "n", false, "skip the pre-commit and commit-msg hooks")
+	command.Flags().BoolVar(&amend, "amend", false, "replace the last commit with a new one")
+	command.Flags().BoolVarP(&all, "all", "a", false, "commit all changes in the working tree, which is the default")
+	command.Flags().BoolVarP(&patch, "patch", "p", false, "choose the hunks to commit interactively")
+	command.Flags().BoolVar(&noEdit, "no-edit", false, "reuse the message of the amended commit without editing it")
 	return command
 }
+
+// commitMessage gets the message of the new commit from -m or -F, or from the user's editor otherwise, passing it
+// through COMMIT_EDITMSG to the prepare-commit-msg and commit-msg hooks, which may edit it in place. When amending, the
+// editor starts out with the message of the amended commit.
+func commitMessage(headStatus *refs.HeadState, amended *objects.Commit, changes []diff.FileChange) (string, error) {
+	message := strings.Join(messages, "\n\n")
+	if messageFile == "-" {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return "", err
+		}
+		message = string(data)
+	} else if messageFile != "" {
+		data, err := os.ReadFile(messageFile)
+		if err != nil {
+			return "", err
+		}
+		message = string(data)
+	}
+	edit := len(messages) == 0 && messageFile == ""
+	source := []string{"message"}
+	if edit && amended != nil {
+		message = amended.Message
+		source = []string{"commit", headStatus.Commit}
+		edit = !noEdit
+	} else if edit {
+		source = nil
+	}
+
+	var comments []string
+	if edit {
+		comments = append(append(comments, commitmsg.Help...), "")
+		comments = append(comments, statusComments(headStatus, changes)...)
+	}
+	path, err := commitmsg.Write(nil, message, comments...)
+	if err != nil {
+		return "", err
+	}
+	if err := hooks.Run(nil, hooks.PrepareCommitMsg, "", append([]string{path}, source...)...); err != nil {
+		return "", err
+	}
+	if edit {
+		if err := util.EditFile(path); err != nil {
+			return "", err
+		}
+	}
+	if !noVerify {
+		if err := hooks.Run(nil, hooks.CommitMsg, "", path); err != nil {
+			return "", err
+		}
+	}
+	return commitmsg.Read(path, edit)
+}
+
+// statusComments describes what is being committed for the commit message template, the same way status does.
+func statusComments(headStatus *refs.HeadState, changes []diff.FileChange) []string {
+	var comments []string
+	if headStatus.Detached {
+		comments = append(comments, "HEAD detached at "+headStatus.Commit[:7])
+	} else {
+		comments = append(comments, "On branch "+strings.TrimPrefix(headStatus.Ref, "refs/heads/"))
+	}
+	if len(changes) == 0 {
+		return append(comments, "No changes")
+	}
+	comments = append(comments, "Changes to be committed:")
+	for _, change := range changes {
+		switch change.ChangeType {
+		case diff.Added:
+			comments = append(comments, "    added: "+change.NewName)
+		case diff.Deleted:
+			comments = append(comments, "    deleted: "+change.OldName)
+		case diff.Modified:
+			comments = append(comments, "    modified: "+change.NewName)
+		case diff.Moved:
+			comments = append(comments, "    moved: "+change.OldName+" -> "+change.NewName)
+		}
+	}
+	return comments
+}
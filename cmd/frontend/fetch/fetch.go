@@ -0,0 +1,72 @@
+package fetch
+
+import (
+	"patchy/remote"
+	"patchy/util"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+var fetchAll bool
+var prune bool
+
+func NewCommand() *cobra.Command {
+	command := &cobra.Command{
+		Use:   "fetch [--all] [--prune] [<remote>]",
+		Short: "Download objects and refs from another repository",
+		Long: `Fetches the branches of a remote (origin by default) along with all objects needed to complete their
+history, and updates the remote-tracking refs under refs/remotes/<remote>/. Without a remote, the remote of the current
+branch's upstream is used, or origin if it has none.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			names := []string{remote.DefaultRemote()}
+			if len(args) > 0 {
+				names = args
+			} else if fetchAll {
+				remotes, err := remote.ListRemotes()
+				if err != nil {
+					return err
+				}
+				names = make([]string, 0, len(remotes))
+				for _, r := range remotes {
+					names = append(names, r.Name)
+				}
+			}
+			for _, name := range names {
+				updates, err := remote.Fetch(name, prune)
+				if err != nil {
+					return err
+				}
+				printTrackingUpdates(name, updates)
+			}
+			return nil
+		},
+	}
+	command.Flags().BoolVar(&fetchAll, "all", false, "fetch all remotes")
+	command.Flags().BoolVarP(&prune, "prune", "p", false, "remove remote-tracking refs that no longer exist on the remote")
+	return command
+}
+
+func printTrackingUpdates(remoteName string, updates []remote.TrackingUpdate) {
+	if len(updates) == 0 {
+		return
+	}
+	r, err := remote.GetRemote(remoteName)
+	if err == nil {
+		util.Println("From", r.URL)
+	}
+	for _, update := range updates {
+		branch := strings.TrimPrefix(update.RemoteRef, "refs/heads/")
+		tracking := strings.TrimPrefix(update.LocalRef, "refs/remotes/")
+		switch {
+		case update.New == "":
+			util.ColorPrintf(color.FgRed, " - [deleted]         (none) -> %s\n", tracking)
+		case update.Old == "":
+			util.ColorPrintf(color.FgGreen, " * [new branch]      %s -> %s\n", branch, tracking)
+		default:
+			util.Printf("   %s..%s  %s -> %s\n", update.Old[:7], update.New[:7], branch, tracking)
+		}
+	}
+}
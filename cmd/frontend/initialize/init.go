@@ -7,25 +7,39 @@ import (
 	"github.com/spf13/cobra"
 )
 
+var bare bool
+
 func NewCommand() *cobra.Command {
-	return &cobra.Command{
-		Use:   "init [<directory>]",
+	command := &cobra.Command{
+		Use:   "init [--bare] [<directory>]",
 		Short: "Create an empty repository",
-		Long:  `Create an empty repository`,
-		Args:  cobra.MaximumNArgs(1),
+		Long: `Create an empty repository
+
+With --bare, the repository is created without a working tree, directly in <directory>`,
+		Args: cobra.MaximumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
+			path := "."
+			if len(args) > 0 {
+				path = args[0]
+			}
 			var repoPath string
 			var err error
-			if len(args) > 0 {
-				repoPath, err = repo.InitRepo(args[0])
+			if bare {
+				repoPath, err = repo.InitBareRepo(path)
 			} else {
-				repoPath, err = repo.InitRepo(".")
+				repoPath, err = repo.InitRepo(path)
 			}
 			if err != nil {
 				return err
 			}
-			util.Println("Initialized empty repository in", repoPath)
+			if bare {
+				util.Println("Initialized empty bare repository in", repoPath)
+			} else {
+				util.Println("Initialized empty repository in", repoPath)
+			}
 			return nil
 		},
 	}
+	command.Flags().BoolVar(&bare, "bare", false, "create a bare repository without a working tree")
+	return command
 }
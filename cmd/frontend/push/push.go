@@ -0,0 +1,113 @@
+package push
+
+import (
+	"errors"
+	"fmt"
+	"patchy/objects"
+	"patchy/refs"
+	"patchy/remote"
+	"patchy/util"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+var force bool
+var setUpstream bool
+var noVerify bool
+
+func NewCommand() *cobra.Command {
+	command := &cobra.Command{
+		Use:   "push [--force] [--no-verify] [<remote> [<src>[:<dst>]...]]",
+		Short: "Update remote refs along with associated objects",
+		Long: `Sends the objects needed by the given local revisions to a remote (origin by default) and updates the
+remote's branches to point at them. Without refspecs, the current branch is pushed to the branch of the same name.
+Updates that are not fast-forwards are refused unless --force is given or the refspec is prefixed with '+'. An empty
+<src> deletes the remote branch <dst>. Without a remote, the remote of the current branch's upstream is used, or origin
+if it has none. With --set-upstream, every pushed local branch starts tracking the remote branch it was pushed to.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			remoteName := remote.DefaultRemote()
+			if len(args) > 0 {
+				remoteName = args[0]
+			}
+			specs := args[min(len(args), 1):]
+			if len(specs) == 0 {
+				headState, err := refs.ReadHead()
+				if err != nil {
+					return err
+				}
+				if headState.Detached {
+					return errors.New("you are not currently on a branch")
+				}
+				specs = []string{headState.Ref}
+			}
+
+			results, err := remote.Push(remoteName, specs, force, noVerify)
+			if err != nil {
+				return err
+			}
+			util.Println("To", remoteName)
+			failed := false
+			for _, result := range results {
+				src := strings.TrimPrefix(result.Src, "refs/heads/")
+				dst := strings.TrimPrefix(result.Ref, "refs/heads/")
+				switch {
+				case result.Err != nil:
+					failed = true
+					var rejected *remote.RefRejected
+					reason := result.Err.Error()
+					if errors.As(result.Err, &rejected) {
+						reason = rejected.Reason
+					}
+					util.ColorPrintf(color.FgRed, " ! [rejected]        %s -> %s (%s)\n", src, dst, reason)
+				case result.Old == result.New:
+					util.Printf(" = [up to date]      %s -> %s\n", src, dst)
+				case result.New == "":
+					util.ColorPrintf(color.FgRed, " - [deleted]         %s\n", dst)
+				case result.Old == "":
+					util.ColorPrintf(color.FgGreen, " * [new branch]      %s -> %s\n", src, dst)
+				default:
+					// Forced updates can only be told apart from fast-forwards by their history
+					if fastForward, _ := objects.IsAncestor(result.Old, result.New); !fastForward {
+						util.Printf(" + %s...%s %s -> %s (forced update)\n", result.Old[:7], result.New[:7], src, dst)
+					} else {
+						util.Printf("   %s..%s  %s -> %s\n", result.Old[:7], result.New[:7], src, dst)
+					}
+				}
+			}
+			if failed {
+				return fmt.Errorf("failed to push some refs to '%s'", remoteName)
+			}
+			if setUpstream {
+				return setUpstreams(remoteName, results)
+			}
+			return nil
+		},
+	}
+	command.Flags().BoolVarP(&force, "force", "f", false, "allow updates that are not fast-forwards")
+	command.Flags().BoolVarP(&setUpstream, "set-upstream", "u", false, "make pushed branches track their remote branches")
+	command.Flags().BoolVar(&noVerify, "no-verify", false, "skip the pre-push hook")
+	return command
+}
+
+func setUpstreams(remoteName string, results []remote.PushResult) error {
+	if _, err := remote.GetRemote(remoteName); err != nil {
+		return err
+	}
+	for _, result := range results {
+		branchName := strings.TrimPrefix(result.Src, "refs/heads/")
+		if result.New == "" || !strings.HasPrefix(result.Ref, "refs/heads/") {
+			continue
+		}
+		if _, err := refs.ResolveRef("refs/heads/" + branchName); err != nil {
+			continue
+		}
+		upstream := remoteName + "/" + strings.TrimPrefix(result.Ref, "refs/heads/")
+		if err := refs.SetUpstream(branchName, upstream); err != nil {
+			return err
+		}
+		util.Printf("branch '%s' set up to track '%s'.\n", branchName, upstream)
+	}
+	return nil
+}
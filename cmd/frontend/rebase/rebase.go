@@ -0,0 +1,86 @@
+package rebase
+
+import (
+	"errors"
+	"fmt"
+	"patchy/refs"
+	"patchy/sequencer"
+
+	"github.com/spf13/cobra"
+)
+
+var onto string
+var interactive bool
+var continueRebase bool
+var skipRebase bool
+var abortRebase bool
+
+func NewCommand() *cobra.Command {
+	command := &cobra.Command{
+		Use: `rebase [-i] [--onto <newbase>] [<upstream>]
+  rebase (--continue | --skip | --abort)`,
+		Short: "Replay commits on top of another base",
+		Long: `Replays the commits of the current branch since it diverged from <upstream>, its upstream branch by default,
+on top of <upstream>, or of <newbase> with --onto, and then moves the branch to the last replayed commit.
+
+With --interactive, the list of commits to replay is opened in the editor first. Each line can pick a commit as is,
+reword its message, stop after it to edit it, squash or fixup it into the previous commit, or drop it, and lines can be
+reordered.
+
+If replaying a commit conflicts, the conflicting files are left with conflict markers and the rebase stops. Once they
+are resolved, --continue commits the result and replays the remaining commits; --skip drops the conflicting commit
+instead and --abort returns the branch to where it was before the rebase started. --continue also resumes after
+stopping to edit a commit, amending it with any changes made to the working tree.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			err := runRebase(args)
+			if errors.As(err, &sequencer.ErrStoppedOnConflict) || errors.As(err, &sequencer.ErrUnresolvedConflicts) {
+				return fmt.Errorf("%w\nAfter resolving the conflicts, run 'patchy rebase --continue', or use "+
+					"'patchy rebase --skip' to skip this commit or 'patchy rebase --abort' to cancel", err)
+			}
+			return err
+		},
+	}
+	command.Flags().StringVar(&onto, "onto", "", "replay the commits on top of this revision instead of upstream")
+	command.Flags().BoolVarP(&interactive, "interactive", "i", false, "edit the list of commits before replaying them")
+	command.Flags().BoolVar(&continueRebase, "continue", false, "continue after resolving conflicts or editing")
+	command.Flags().BoolVar(&skipRebase, "skip", false, "skip the commit that stopped on a conflict")
+	command.Flags().BoolVar(&abortRebase, "abort", false, "cancel and return to the state before the rebase")
+	command.MarkFlagsMutuallyExclusive("continue", "skip", "abort")
+	return command
+}
+
+func runRebase(args []string) error {
+	resuming := continueRebase || skipRebase || abortRebase
+	if resuming && (len(args) > 0 || onto != "" || interactive) {
+		return errors.New("--continue, --skip and --abort cannot be combined with other arguments")
+	}
+	switch {
+	case continueRebase:
+		return sequencer.ContinueRebase()
+	case skipRebase:
+		return sequencer.SkipRebase()
+	case abortRebase:
+		return sequencer.AbortRebase()
+	}
+
+	upstream := ""
+	if len(args) > 0 {
+		upstream = args[0]
+	} else {
+		headState, err := refs.ReadHead()
+		if err != nil {
+			return err
+		}
+		if !headState.Detached {
+			upstream, err = refs.Upstream(headState.Ref[len("refs/heads/"):])
+			if err != nil {
+				return err
+			}
+		}
+		if upstream == "" {
+			return errors.New("there is no upstream to rebase against, please specify one")
+		}
+	}
+	return sequencer.Rebase(upstream, onto, interactive)
+}
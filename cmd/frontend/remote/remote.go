@@ -0,0 +1,68 @@
+package remote
+
+import (
+	"patchy/remote"
+	"patchy/util"
+
+	"github.com/spf13/cobra"
+)
+
+var verbose bool
+
+func NewCommand() *cobra.Command {
+	command := &cobra.Command{
+		Use:   "remote [-v]",
+		Short: "Manage the set of tracked repositories",
+		Long:  `Lists, adds or removes the remote repositories whose branches are tracked by this repository`,
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return listRemotes()
+		},
+	}
+	command.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "show remote urls")
+
+	command.AddCommand(&cobra.Command{
+		Use:   "add <name> <url>",
+		Short: "Add a remote",
+		Long:  `Adds a remote named <name> for the repository at <url>`,
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return remote.AddRemote(args[0], args[1])
+		},
+	})
+	command.AddCommand(&cobra.Command{
+		Use:     "remove <name>",
+		Aliases: []string{"rm"},
+		Short:   "Remove a remote",
+		Long:    `Removes the remote named <name> along with all of its remote-tracking refs`,
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return remote.RemoveRemote(args[0])
+		},
+	})
+	command.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "List remotes",
+		Long:  `Lists all configured remotes`,
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return listRemotes()
+		},
+	})
+	return command
+}
+
+func listRemotes() error {
+	remotes, err := remote.ListRemotes()
+	if err != nil {
+		return err
+	}
+	for _, r := range remotes {
+		if verbose {
+			util.Printf("%s\t%s\n", r.Name, r.URL)
+		} else {
+			util.Println(r.Name)
+		}
+	}
+	return nil
+}
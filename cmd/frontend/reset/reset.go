@@ -0,0 +1,65 @@
+package reset
+
+import (
+	"errors"
+	"patchy/objects"
+	"patchy/refs"
+	"patchy/util"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+var soft bool
+var mixed bool
+var hard bool
+
+func NewCommand() *cobra.Command {
+	command := &cobra.Command{
+		Use:   "reset [--soft | --mixed | --hard] [<rev>]",
+		Short: "Move the current branch to a revision",
+		Long: `Points the current branch, or HEAD if it is detached, at <rev>, HEAD by default.
+
+With --hard, the working tree is also changed to match <rev>, and every change made to it is lost. Patchy has no index,
+so --soft and --mixed, the default, both leave the working tree as it is: the changes between <rev> and the working tree
+are then shown by status and will be part of the next commit. For the same reason, resetting individual paths is not
+supported; use restore to bring back the contents of files instead.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if cmd.ArgsLenAtDash() != -1 || len(args) > 1 {
+				return errors.New("resetting paths is not supported, as there is no index to reset them in")
+			}
+			mode := refs.ResetMixed
+			switch {
+			case soft:
+				mode = refs.ResetSoft
+			case hard:
+				mode = refs.ResetHard
+			}
+			revSpec := "HEAD"
+			if len(args) > 0 {
+				revSpec = args[0]
+			}
+
+			commitHash, err := refs.Reset(revSpec, mode)
+			if err != nil {
+				return err
+			}
+			if mode == refs.ResetHard {
+				commit, err := objects.ReadCommit(commitHash)
+				if err != nil {
+					return err
+				}
+				util.Print("HEAD is now at ")
+				util.ColorPrint(color.FgYellow, commitHash[:7])
+				util.Println("", strings.SplitN(commit.Message, "\n", 2)[0])
+			}
+			return nil
+		},
+	}
+	command.Flags().BoolVar(&soft, "soft", false, "only move the branch")
+	command.Flags().BoolVar(&mixed, "mixed", false, "only move the branch, as there is no index to reset")
+	command.Flags().BoolVar(&hard, "hard", false, "move the branch and discard all changes to the working tree")
+	command.MarkFlagsMutuallyExclusive("soft", "mixed", "hard")
+	return command
+}
@@ -0,0 +1,31 @@
+package restore
+
+import (
+	"patchy/refs"
+
+	"github.com/spf13/cobra"
+)
+
+var source string
+var force bool
+
+func NewCommand() *cobra.Command {
+	command := &cobra.Command{
+		Use:   "restore [--source <rev>] [--force] <pathspec>...",
+		Short: "Restore files in the working tree from a revision",
+		Long: `Restores the files matching the given pathspecs to their contents in <rev>, HEAD by default. A pathspec is a
+file or directory, relative to the current directory, or a glob pattern. Files matching a pathspec which are in HEAD but
+not in <rev> are removed.
+
+Files which have been changed since HEAD are not overwritten or removed unless --force is given, in which case those
+changes are lost.`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			_, err := refs.CheckoutPaths(source, args, force)
+			return err
+		},
+	}
+	command.Flags().StringVarP(&source, "source", "s", "HEAD", "the revision to restore files from")
+	command.Flags().BoolVarP(&force, "force", "f", false, "overwrite files with local changes")
+	return command
+}
@@ -0,0 +1,58 @@
+package revert
+
+import (
+	"errors"
+	"fmt"
+	"patchy/sequencer"
+
+	"github.com/spf13/cobra"
+)
+
+var continueRevert bool
+var skipRevert bool
+var abortRevert bool
+
+func NewCommand() *cobra.Command {
+	command := &cobra.Command{
+		Use: `revert <rev>...
+  revert (--continue | --skip | --abort)`,
+		Short: "Undo the changes introduced by existing commits",
+		Long: `Undoes the changes introduced by each of the given commits, in order, creating a new commit for each
+recording which commit it reverts. The working tree must be clean.
+
+If undoing the changes of a commit conflicts with HEAD, the conflicting files are left with conflict markers and the
+revert stops. Once they are resolved, --continue commits the result and reverts the remaining commits; --skip leaves the
+conflicting commit alone instead and --abort returns to where the revert started.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			err := runSequencer(args, sequencer.Revert)
+			if errors.As(err, &sequencer.ErrStoppedOnConflict) || errors.As(err, &sequencer.ErrUnresolvedConflicts) {
+				return fmt.Errorf("%w\nAfter resolving the conflicts, run 'patchy revert --continue', or use "+
+					"'patchy revert --skip' to skip this commit or 'patchy revert --abort' to cancel", err)
+			}
+			return err
+		},
+	}
+	command.Flags().BoolVar(&continueRevert, "continue", false, "continue after resolving conflicts")
+	command.Flags().BoolVar(&skipRevert, "skip", false, "skip the commit that stopped on a conflict")
+	command.Flags().BoolVar(&abortRevert, "abort", false, "cancel and return to the state before the revert")
+	command.MarkFlagsMutuallyExclusive("continue", "skip", "abort")
+	return command
+}
+
+func runSequencer(args []string, start func([]string) error) error {
+	resuming := continueRevert || skipRevert || abortRevert
+	if resuming && len(args) > 0 {
+		return errors.New("--continue, --skip and --abort do not take revisions")
+	} else if !resuming && len(args) == 0 {
+		return errors.New("at least one revision is required")
+	}
+	switch {
+	case continueRevert:
+		return sequencer.Continue()
+	case skipRevert:
+		return sequencer.Skip()
+	case abortRevert:
+		return sequencer.Abort()
+	}
+	return start(args)
+}
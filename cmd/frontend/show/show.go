@@ -0,0 +1,137 @@
+package show
+
+import (
+	"errors"
+	"patchy/diff"
+	"patchy/objects"
+	"patchy/objects/objecttype"
+	"patchy/refs"
+	"patchy/util"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+var stat bool
+var nameOnly bool
+var nameStatus bool
+var format string
+
+func NewCommand() *cobra.Command {
+	command := &cobra.Command{
+		Use:   "show [--stat | --name-only | --name-status] [--format <format>] [<object>...]",
+		Short: "Show commits, trees and files",
+		Long: `Shows each of the given objects, HEAD by default. An object is a revision, an object hash, or <rev>:<path>
+for a file or directory in a revision.
+
+A commit is shown with its author, date and message followed by the patch it introduces, or with --stat, --name-only
+or --name-status a summary of the files it changes. --format replaces the header with one of oneline or medium, the
+default, or a format string with placeholders such as %H, %h, %an, %ad, %s and %b. A tree is shown as a listing of its
+entries, and a file as its contents.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				args = []string{"HEAD"}
+			}
+			for i, name := range args {
+				if i > 0 {
+					util.Println()
+				}
+				hash, err := refs.ResolveObject(name)
+				if err != nil {
+					return err
+				}
+				objType, err := objects.ReadObjectType(hash)
+				if err != nil {
+					return err
+				}
+				switch objType {
+				case objecttype.Blob:
+					data, err := objects.ReadBlob(hash)
+					if err != nil {
+						return err
+					}
+					util.Print(string(data))
+				case objecttype.Tree:
+					err = showTree(name, hash)
+				case objecttype.Commit:
+					err = showCommit(hash)
+				default:
+					err = errors.New("unknown object type")
+				}
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+	command.Flags().BoolVar(&stat, "stat", false, "show the number of changed lines in each file instead of the patch")
+	command.Flags().BoolVar(&nameOnly, "name-only", false, "show only the names of changed files")
+	command.Flags().BoolVar(&nameStatus, "name-status", false, "show the names and kinds of changes of changed files")
+	command.Flags().StringVar(&format, "format", "", "the format of commit headers")
+	command.MarkFlagsMutuallyExclusive("stat", "name-only", "name-status")
+	return command
+}
+
+func showTree(name string, hash string) error {
+	entries, err := objects.ReadTree(hash)
+	if err != nil {
+		return err
+	}
+	util.ColorPrintf(color.FgYellow, "tree %s\n\n", name)
+	for _, entry := range entries {
+		if entry.Mode == "040000" {
+			util.Println(entry.Name + "/")
+		} else {
+			util.Println(entry.Name)
+		}
+	}
+	return nil
+}
+
+func showCommit(hash string) error {
+	commit, err := objects.ReadCommit(hash)
+	if err != nil {
+		return err
+	}
+	switch format {
+	case "", "medium":
+		util.ColorPrintf(color.FgYellow, "commit %s\n", hash)
+		util.Println("Author: ", commit.Author)
+		util.Println("Date:   ", commit.Time)
+		util.Println()
+		util.Println("    ", strings.ReplaceAll(commit.Message, "\n", "\n    "))
+	case "oneline":
+		util.ColorPrint(color.FgYellow, hash[:7])
+		util.Println("", strings.SplitN(commit.Message, "\n", 2)[0])
+	default:
+		customFormat := strings.TrimPrefix(strings.TrimPrefix(format, "format:"), "tformat:")
+		util.Println(objects.FormatCommit(hash, commit, customFormat))
+	}
+
+	parentTree := ""
+	if commit.Parent != nil {
+		parent, err := objects.ReadCommit(*commit.Parent)
+		if err != nil {
+			return err
+		}
+		parentTree = parent.Tree
+	}
+	changes, err := diff.TreeDiff(commit.Tree, parentTree)
+	if err != nil || len(changes) == 0 {
+		return err
+	}
+	if format != "oneline" {
+		util.Println()
+	}
+	switch {
+	case stat:
+		return diff.PrintStat(changes)
+	case nameOnly || nameStatus:
+		diff.PrintNameStatus(changes, nameOnly)
+		return nil
+	default:
+		return diff.PrintPatch(changes)
+	}
+}
@@ -1,8 +1,10 @@
 package status
 
 import (
+	"fmt"
 	"patchy/diff"
 	"patchy/refs"
+	"patchy/repo"
 	"patchy/util"
 
 	"github.com/fatih/color"
@@ -16,6 +18,9 @@ func NewCommand() *cobra.Command {
 		Long:  `Displays all changes made to the working tree since the last commit.`,
 		Args:  cobra.NoArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if _, err := repo.FindRepoRoot(); err != nil {
+				return err
+			}
 			headState, err := refs.ReadHead()
 			if err != nil {
 				return err
@@ -23,17 +28,22 @@ func NewCommand() *cobra.Command {
 			if headState.Detached {
 				util.ColorPrintf(color.FgRed, "HEAD detached at %s\n\n", headState.Commit[:7])
 			} else {
-				util.Printf("On branch %s\n\n", headState.Ref[len("refs/heads/"):])
+				branchName := headState.Ref[len("refs/heads/"):]
+				util.Printf("On branch %s\n", branchName)
+				if err := printUpstreamStatus(branchName, headState.Commit); err != nil {
+					return err
+				}
+				util.Println()
 			}
 			changes, err := diff.WorkingTreeDiff()
+			if err != nil {
+				return err
+			}
 			if len(changes) == 0 {
 				util.Println("Nothing to commit, working tree clean")
 				return nil
 			}
 			util.Println("Changes to be committed:")
-			if err != nil {
-				return err
-			}
 			for _, change := range changes {
 				switch change.ChangeType {
 				case diff.Added:
@@ -50,3 +60,36 @@ func NewCommand() *cobra.Command {
 		},
 	}
 }
+
+func printUpstreamStatus(branchName string, commitHash string) error {
+	upstream, err := refs.Upstream(branchName)
+	if err != nil || upstream == "" {
+		return err
+	}
+	status, err := refs.GetUpstreamStatus(refs.Branch{Name: branchName, CommitHash: commitHash, Upstream: upstream})
+	if err != nil {
+		return err
+	}
+	name := refs.ShortRefName(upstream)
+	switch {
+	case status.Gone:
+		util.Printf("Your branch is based on '%s', but the upstream is gone.\n", name)
+	case status.Ahead > 0 && status.Behind > 0:
+		util.Printf("Your branch and '%s' have diverged,\nand have %d and %d different commits each, respectively.\n",
+			name, status.Ahead, status.Behind)
+	case status.Ahead > 0:
+		util.Printf("Your branch is ahead of '%s' by %s.\n", name, pluralCommits(status.Ahead))
+	case status.Behind > 0:
+		util.Printf("Your branch is behind '%s' by %s.\n", name, pluralCommits(status.Behind))
+	default:
+		util.Printf("Your branch is up to date with '%s'.\n", name)
+	}
+	return nil
+}
+
+func pluralCommits(n int) string {
+	if n == 1 {
+		return "1 commit"
+	}
+	return fmt.Sprintf("%d commits", n)
+}
@@ -0,0 +1,282 @@
+package worktree
+
+import (
+	"fmt"
+	"os"
+	"patchy/refs"
+	"patchy/repo"
+	"patchy/repository"
+	"patchy/util"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var newBranch string
+var force bool
+var dryRun bool
+var verbose bool
+
+func NewCommand() *cobra.Command {
+	command := &cobra.Command{
+		Use:   "worktree",
+		Short: "Manage multiple working trees",
+		Long: `Manages the working trees of the repository. Linked working trees share the objects and refs of the repository
+they are added to, but each has a HEAD of its own. A branch can only be checked out in one working tree at a time.`,
+		Args: cobra.NoArgs,
+	}
+
+	add := &cobra.Command{
+		Use:   "add [-b <new-branch>] <path> [<commit-ish>]",
+		Short: "Create a new working tree",
+		Long: `Creates a new working tree at <path> and checks out <commit-ish> in it. A branch is checked out as itself, any
+other revision with a detached HEAD. With -b, a new branch starting at <commit-ish> is created and checked out
+instead. Without either, a new branch named after the last component of <path> is created at HEAD.`,
+		Args: cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			revSpec := ""
+			if len(args) > 1 {
+				revSpec = args[1]
+			}
+			return addWorkTree(args[0], revSpec)
+		},
+	}
+	add.Flags().StringVarP(&newBranch, "branch", "b", "", "create a new branch and check it out")
+	command.AddCommand(add)
+
+	command.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "List working trees",
+		Long:  `Lists the main working tree followed by the linked ones, with the commit and branch each has checked out`,
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return listWorkTrees()
+		},
+	})
+
+	remove := &cobra.Command{
+		Use:   "remove [--force] <worktree>",
+		Short: "Remove a working tree",
+		Long: `Deletes a linked working tree, given by its path or name, along with all of its files. Working trees with
+changes are only removed with --force.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return removeWorkTree(args[0])
+		},
+	}
+	remove.Flags().BoolVarP(&force, "force", "f", false, "remove the working tree even if it has changes")
+	command.AddCommand(remove)
+
+	prune := &cobra.Command{
+		Use:   "prune [--dry-run] [--verbose]",
+		Short: "Prune working tree information",
+		Long:  `Forgets the linked working trees whose directories have been deleted`,
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return pruneWorkTrees()
+		},
+	}
+	prune.Flags().BoolVarP(&dryRun, "dry-run", "n", false, "only report what would be pruned")
+	prune.Flags().BoolVarP(&verbose, "verbose", "v", false, "report each pruned working tree")
+	command.AddCommand(prune)
+	return command
+}
+
+func addWorkTree(path string, revSpec string) error {
+	branch := newBranch
+	if revSpec == "" && branch == "" {
+		// Check out the branch named after the working tree, creating it at HEAD if it does not exist yet
+		revSpec = filepath.Base(path)
+		if _, err := refs.ResolveRef("refs/heads/" + revSpec); err != nil {
+			branch = revSpec
+			revSpec = "HEAD"
+		}
+	} else if revSpec == "" {
+		revSpec = "HEAD"
+	}
+	commitHash, err := refs.ParseRev(revSpec)
+	if err != nil {
+		return err
+	}
+	var description string
+	if branch != "" {
+		if err := refs.NewBranch(branch, commitHash); err != nil {
+			return err
+		}
+		description = fmt.Sprintf("new branch '%s'", branch)
+	} else if _, err := refs.ResolveRef("refs/heads/" + revSpec); err == nil {
+		branch = revSpec
+		description = fmt.Sprintf("checking out '%s'", branch)
+	} else {
+		description = fmt.Sprintf("detached HEAD %s", commitHash[:7])
+	}
+
+	linked, err := repo.AddWorkTree(path)
+	if err != nil {
+		return err
+	}
+	if err := checkoutWorkTree(repository.New(linked), branch, commitHash); err != nil {
+		localDir, _ := linked.LocalDir()
+		_ = repo.RemoveWorkTree(filepath.Base(localDir))
+		_ = os.RemoveAll(path)
+		return err
+	}
+	util.Printf("Preparing worktree (%s)\n", description)
+	return nil
+}
+
+// checkoutWorkTree points the HEAD of a new working tree at branch, or at commitHash if there is no branch, and writes
+// out the files of the commit.
+func checkoutWorkTree(r *repository.Repository, branch string, commitHash string) error {
+	headTarget := commitHash
+	if branch != "" {
+		headTarget = branch
+	}
+	if err := r.Refs.UpdateHead(headTarget); err != nil {
+		return err
+	}
+	commit, err := r.Objects.ReadCommit(commitHash)
+	if err != nil {
+		return err
+	}
+	workTree, err := r.WorkTree()
+	if err != nil {
+		return err
+	}
+	return r.Objects.CheckoutTree("", commit.Tree, workTree)
+}
+
+func listWorkTrees() error {
+	workTrees, err := repo.ListWorkTrees()
+	if err != nil {
+		return err
+	}
+	width := 0
+	for _, workTree := range workTrees {
+		width = max(width, len(displayPath(workTree)))
+	}
+	for _, workTree := range workTrees {
+		line := fmt.Sprintf("%-*s", width, displayPath(workTree))
+		head, err := refs.ReadWorkTreeHead(workTree)
+		if err != nil {
+			return err
+		}
+		switch {
+		case workTree.Path == "":
+			line += " (bare)"
+		case head.Commit == "":
+			line += " 0000000"
+		default:
+			line += " " + head.Commit[:7]
+		}
+		if workTree.Path != "" {
+			if head.Detached {
+				line += " (detached HEAD)"
+			} else {
+				line += " [" + strings.TrimPrefix(head.Ref, "refs/heads/") + "]"
+			}
+		}
+		if workTree.Prunable {
+			line += " prunable"
+		}
+		util.Println(line)
+	}
+	return nil
+}
+
+func displayPath(workTree repo.WorkTreeInfo) string {
+	if workTree.Path == "" {
+		return workTree.LocalDir
+	}
+	return workTree.Path
+}
+
+// findWorkTree finds a linked working tree by its path or name.
+func findWorkTree(pathOrName string) (*repo.WorkTreeInfo, error) {
+	workTrees, err := repo.ListWorkTrees()
+	if err != nil {
+		return nil, err
+	}
+	absPath, err := filepath.Abs(pathOrName)
+	if err != nil {
+		return nil, err
+	}
+	for i, workTree := range workTrees {
+		if workTree.Path != absPath && (workTree.Name == "" || workTree.Name != pathOrName) {
+			continue
+		}
+		if i == 0 {
+			return nil, fmt.Errorf("'%s' is the main working tree", pathOrName)
+		}
+		return &workTrees[i], nil
+	}
+	return nil, fmt.Errorf("'%s' is not a working tree", pathOrName)
+}
+
+func removeWorkTree(pathOrName string) error {
+	workTree, err := findWorkTree(pathOrName)
+	if err != nil {
+		return err
+	}
+	if !workTree.Prunable {
+		linked, err := repository.Open(workTree.Path)
+		if err != nil {
+			return err
+		}
+		if !force {
+			if err := checkClean(linked, pathOrName); err != nil {
+				return err
+			}
+		}
+		if err := os.RemoveAll(workTree.Path); err != nil {
+			return err
+		}
+	}
+	return repo.RemoveWorkTree(workTree.Name)
+}
+
+// checkClean fails if a working tree has changes since its HEAD or an operation in progress.
+func checkClean(r *repository.Repository, pathOrName string) error {
+	localDir, err := r.LocalDir()
+	if err != nil {
+		return err
+	}
+	for _, dir := range []string{"sequencer", "rebase"} {
+		if exists, err := util.DoesFileExist(filepath.Join(localDir, dir)); err != nil {
+			return err
+		} else if exists {
+			return fmt.Errorf("'%s' has an operation in progress, use --force to delete it", pathOrName)
+		}
+	}
+	changes, err := r.Diff.WorkingTreeDiff()
+	if err != nil {
+		return err
+	}
+	if len(changes) > 0 {
+		return fmt.Errorf("'%s' contains modified or untracked files, use --force to delete it", pathOrName)
+	}
+	return nil
+}
+
+func pruneWorkTrees() error {
+	workTrees, err := repo.ListWorkTrees()
+	if err != nil {
+		return err
+	}
+	for _, workTree := range workTrees {
+		if !workTree.Prunable {
+			continue
+		}
+		if verbose || dryRun {
+			util.Printf("Removing worktrees/%s: patchydir file points to non-existent location\n", workTree.Name)
+		}
+		if dryRun {
+			continue
+		}
+		if err := repo.RemoveWorkTree(workTree.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -1,20 +1,44 @@
 package cmd
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"patchy/cmd/backend/catfile"
 	"patchy/cmd/backend/committree"
+	"patchy/cmd/backend/debug"
+	"patchy/cmd/backend/hashobject"
+	"patchy/cmd/backend/httpserve"
+	"patchy/cmd/backend/lsfiles"
+	"patchy/cmd/backend/lstree"
 	"patchy/cmd/backend/parserev"
+	"patchy/cmd/backend/serve"
 	"patchy/cmd/backend/updateref"
 	"patchy/cmd/backend/writeblob"
 	"patchy/cmd/backend/writetree"
+	"patchy/cmd/frontend/blame"
 	"patchy/cmd/frontend/branch"
 	"patchy/cmd/frontend/checkout"
+	"patchy/cmd/frontend/cherrypick"
+	"patchy/cmd/frontend/clone"
 	"patchy/cmd/frontend/commit"
+	"patchy/cmd/frontend/fetch"
 	"patchy/cmd/frontend/initialize"
 	"patchy/cmd/frontend/log"
+	"patchy/cmd/frontend/push"
+	"patchy/cmd/frontend/rebase"
+	"patchy/cmd/frontend/remote"
+	"patchy/cmd/frontend/reset"
+	"patchy/cmd/frontend/restore"
+	"patchy/cmd/frontend/revert"
+	"patchy/cmd/frontend/show"
 	"patchy/cmd/frontend/status"
+	"patchy/cmd/frontend/worktree"
+	"patchy/config"
+	"patchy/objects"
+	"patchy/repo"
 	"patchy/util"
+	"path/filepath"
 
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
@@ -24,32 +48,112 @@ var RootCmd = &cobra.Command{
 	Use:   "patchy <command> [<args>]",
 	Short: "Bad version control system",
 	Long:  `Patchy is a bad version control system`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := applyLocationFlags(); err != nil {
+			return err
+		}
+		return configureCache()
+	},
+}
+
+var changeDirs []string
+var patchyDir string
+var workTree string
+
+// applyLocationFlags changes directory for each -C in turn, then resolves --patchy-dir and --work-tree against the
+// resulting directory. They are exported as PATCHY_DIR and PATCHY_WORK_TREE so that they also apply to hooks and any
+// other patchy processes started from this one.
+func applyLocationFlags() error {
+	for _, dir := range changeDirs {
+		if dir == "" {
+			continue
+		}
+		if err := os.Chdir(dir); err != nil {
+			return fmt.Errorf("cannot change to '%s': %w", dir, err)
+		}
+	}
+	for _, location := range []struct {
+		path string
+		env  string
+	}{{patchyDir, repo.DirEnv}, {workTree, repo.WorkTreeEnv}} {
+		if location.path == "" {
+			continue
+		}
+		path, err := filepath.Abs(location.path)
+		if err != nil {
+			return err
+		}
+		if err := os.Setenv(location.env, path); err != nil {
+			return err
+		}
+	}
+	// Commands which run others, like debug cache-stats, must not apply them a second time
+	changeDirs, patchyDir, workTree = nil, "", ""
+	return nil
 }
 
 func Execute() {
 	err := RootCmd.Execute()
-	if err != nil {
+	if errors.Is(err, util.ErrExitStatus) {
+		os.Exit(1)
+	} else if err != nil {
 		util.ColorFprintln(color.FgHiRed, os.Stderr, "Error:", err)
 		os.Exit(1)
 	}
 }
 
+func configureCache() error {
+	cfg, err := config.Load()
+	if errors.Is(err, repo.ErrNotInRepo) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	budget, err := objects.CacheBudget(cfg)
+	if err != nil {
+		return err
+	}
+	objects.SetCacheBudget(budget)
+	return nil
+}
+
 func init() {
 	RootCmd.SilenceUsage = true
 	RootCmd.SilenceErrors = true
 	RootCmd.PersistentFlags().BoolVarP(&util.Quiet, "quiet", "q", false, "suppress output")
+	RootCmd.PersistentFlags().StringArrayVarP(&changeDirs, "directory", "C", nil, "run as if started in <path>")
+	RootCmd.PersistentFlags().StringVar(&patchyDir, "patchy-dir", "", "path to the repository directory")
+	RootCmd.PersistentFlags().StringVar(&workTree, "work-tree", "", "path to the working tree")
 
 	RootCmd.AddCommand(catfile.NewCommand())
 	RootCmd.AddCommand(committree.NewCommand())
+	RootCmd.AddCommand(debug.NewCommand())
+	RootCmd.AddCommand(hashobject.NewCommand())
+	RootCmd.AddCommand(httpserve.NewCommand())
+	RootCmd.AddCommand(lsfiles.NewCommand())
+	RootCmd.AddCommand(lstree.NewCommand())
 	RootCmd.AddCommand(parserev.NewCommand())
+	RootCmd.AddCommand(serve.NewCommand())
 	RootCmd.AddCommand(writeblob.NewCommand())
 	RootCmd.AddCommand(updateref.NewCommand())
 	RootCmd.AddCommand(writetree.NewCommand())
 
+	RootCmd.AddCommand(blame.NewCommand())
 	RootCmd.AddCommand(branch.NewCommand())
 	RootCmd.AddCommand(checkout.NewCommand())
+	RootCmd.AddCommand(cherrypick.NewCommand())
+	RootCmd.AddCommand(clone.NewCommand())
 	RootCmd.AddCommand(commit.NewCommand())
+	RootCmd.AddCommand(fetch.NewCommand())
 	RootCmd.AddCommand(initialize.NewCommand())
 	RootCmd.AddCommand(log.NewCommand())
+	RootCmd.AddCommand(push.NewCommand())
+	RootCmd.AddCommand(rebase.NewCommand())
+	RootCmd.AddCommand(remote.NewCommand())
+	RootCmd.AddCommand(reset.NewCommand())
+	RootCmd.AddCommand(restore.NewCommand())
+	RootCmd.AddCommand(revert.NewCommand())
+	RootCmd.AddCommand(show.NewCommand())
 	RootCmd.AddCommand(status.NewCommand())
+	RootCmd.AddCommand(worktree.NewCommand())
 }
@@ -0,0 +1,93 @@
+package commitmsg
+
+import (
+	"fmt"
+	"os"
+	"patchy/repo"
+	"patchy/util"
+	"path/filepath"
+	"strings"
+)
+
+// Help is the comment put below commit messages which are edited by the user.
+var Help = []string{
+	"Please enter the commit message for your changes. Lines starting",
+	"with '#' will be ignored, and an empty message aborts the commit.",
+}
+
+// Path returns the path of COMMIT_EDITMSG of the repository r, or of the default repository if it is nil, through which
+// commit messages are passed to the editor and to hooks.
+func Path(r *repo.Repository) (string, error) {
+	localDir, err := r.LocalDir()
+	if err != nil {
+		return "", fmt.Errorf("Path: %w", err)
+	}
+	return filepath.Join(localDir, "COMMIT_EDITMSG"), nil
+}
+
+// Write writes a commit message to COMMIT_EDITMSG of r, followed by the given lines as comments, and returns its path.
+func Write(r *repo.Repository, message string, comments ...string) (string, error) {
+	path, err := Path(r)
+	if err != nil {
+		return "", fmt.Errorf("Write: %w", err)
+	}
+	var content strings.Builder
+	content.WriteString(message + "\n")
+	if len(comments) > 0 {
+		content.WriteString("\n")
+	}
+	for _, comment := range comments {
+		if comment == "" {
+			content.WriteString("#\n")
+		} else {
+			content.WriteString("# " + comment + "\n")
+		}
+	}
+	if err := os.WriteFile(path, []byte(content.String()), 0644); err != nil {
+		return "", fmt.Errorf("Write: %w", err)
+	}
+	return path, nil
+}
+
+// Read reads a commit message back from path, dropping surrounding whitespace and, if strip is set, comment lines.
+func Read(path string, strip bool) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("Read: %w", err)
+	}
+	return Cleanup(string(data), strip), nil
+}
+
+// Cleanup drops trailing whitespace from each line of a commit message, blank lines around it and, if strip is set,
+// comment lines.
+func Cleanup(message string, strip bool) string {
+	lines := strings.Split(message, "\n")
+	kept := make([]string, 0, len(lines))
+	for _, line := range lines {
+		if strip && strings.HasPrefix(line, "#") {
+			continue
+		}
+		kept = append(kept, strings.TrimRight(line, " \t\r"))
+	}
+	return strings.Trim(strings.Join(kept, "\n"), "\n")
+}
+
+// Edit lets the user edit a commit message in their editor, below which the help and the given lines are shown as
+// comments. Comment lines are dropped from the result, and an empty result is an EmptyMessage error.
+func Edit(r *repo.Repository, message string, comments ...string) (string, error) {
+	path, err := Write(r, message, append(Help, comments...)...)
+	if err != nil {
+		return "", fmt.Errorf("Edit: %w", err)
+	}
+	if err := util.EditFile(path); err != nil {
+		return "", fmt.Errorf("Edit: %w", err)
+	}
+	edited, err := Read(path, true)
+	if err != nil {
+		return "", fmt.Errorf("Edit: %w", err)
+	}
+	if edited == "" {
+		return "", fmt.Errorf("Edit: %w", &EmptyMessage{})
+	}
+	return edited, nil
+}
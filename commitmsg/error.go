@@ -0,0 +1,11 @@
+package commitmsg
+
+type EmptyMessage struct{}
+
+func (e *EmptyMessage) Error() string {
+	return "aborting due to empty commit message"
+}
+
+var (
+	ErrEmptyMessage *EmptyMessage
+)
@@ -0,0 +1,263 @@
+package config
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"patchy/repo"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+type entry struct {
+	key   string
+	value string
+}
+
+type section struct {
+	name       string
+	subsection string
+	entries    []entry
+}
+
+type Config struct {
+	path     string
+	sections []*section
+}
+
+func Load() (*Config, error) {
+	cfg, err := LoadRepo(nil)
+	if err != nil {
+		return nil, fmt.Errorf("Load: %w", err)
+	}
+	return cfg, nil
+}
+
+// LoadRepo loads the config of a repository, or of the one found from the working directory if r is nil.
+func LoadRepo(r *repo.Repository) (*Config, error) {
+	repoDir, err := r.Dir()
+	if err != nil {
+		return nil, fmt.Errorf("LoadRepo: %w", err)
+	}
+	cfg, err := LoadFile(filepath.Join(repoDir, "config"))
+	if err != nil {
+		return nil, fmt.Errorf("LoadRepo: %w", err)
+	}
+	return cfg, nil
+}
+
+func LoadFile(path string) (*Config, error) {
+	cfg := &Config{path: path}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("LoadFile: %w", err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	var current *section
+	scanner := bufio.NewScanner(f)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") {
+				return nil, fmt.Errorf("LoadFile: %w", &BadConfig{path, lineNum})
+			}
+			header := strings.TrimSpace(line[1 : len(line)-1])
+			name, subsection, hasSubsection := strings.Cut(header, " ")
+			if hasSubsection {
+				subsection = strings.TrimSpace(subsection)
+				if len(subsection) < 2 || !strings.HasPrefix(subsection, "\"") || !strings.HasSuffix(subsection, "\"") {
+					return nil, fmt.Errorf("LoadFile: %w", &BadConfig{path, lineNum})
+				}
+				subsection = subsection[1 : len(subsection)-1]
+			}
+			current = cfg.section(name, subsection, true)
+			continue
+		}
+		key, value, found := strings.Cut(line, "=")
+		if current == nil || !found {
+			return nil, fmt.Errorf("LoadFile: %w", &BadConfig{path, lineNum})
+		}
+		current.entries = append(current.entries, entry{strings.TrimSpace(key), strings.TrimSpace(value)})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("LoadFile: %w", err)
+	}
+	return cfg, nil
+}
+
+func (c *Config) Save() error {
+	var builder strings.Builder
+	for _, s := range c.sections {
+		if len(s.entries) == 0 {
+			continue
+		}
+		if s.subsection != "" {
+			builder.WriteString(fmt.Sprintf("[%s \"%s\"]\n", s.name, s.subsection))
+		} else {
+			builder.WriteString(fmt.Sprintf("[%s]\n", s.name))
+		}
+		for _, e := range s.entries {
+			builder.WriteString(fmt.Sprintf("\t%s = %s\n", e.key, e.value))
+		}
+	}
+	if err := os.WriteFile(c.path, []byte(builder.String()), 0644); err != nil {
+		return fmt.Errorf("Save: %w", err)
+	}
+	return nil
+}
+
+func (c *Config) Get(key string) (string, bool) {
+	values := c.GetAll(key)
+	if len(values) == 0 {
+		return "", false
+	}
+	return values[len(values)-1], true
+}
+
+// GetInt reads an integer value, which may have a k, m or g suffix to scale it by 1024, 1024^2 or 1024^3.
+func (c *Config) GetInt(key string) (int64, bool, error) {
+	value, ok := c.Get(key)
+	if !ok {
+		return 0, false, nil
+	}
+	number, scale := strings.ToLower(value), int64(1)
+	for i, suffix := range []string{"k", "m", "g"} {
+		if strings.HasSuffix(number, suffix) {
+			number, scale = strings.TrimSuffix(number, suffix), int64(1)<<(10*(i+1))
+			break
+		}
+	}
+	n, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || n > math.MaxInt64/scale || n < math.MinInt64/scale {
+		return 0, false, fmt.Errorf("GetInt: %w", &BadValue{key, value})
+	}
+	return n * scale, true, nil
+}
+
+func (c *Config) GetAll(key string) []string {
+	name, subsection, key := splitKey(key)
+	s := c.section(name, subsection, false)
+	if s == nil {
+		return nil
+	}
+	values := make([]string, 0)
+	for _, e := range s.entries {
+		if e.key == key {
+			values = append(values, e.value)
+		}
+	}
+	return values
+}
+
+func (c *Config) Set(key string, value string) {
+	name, subsection, key := splitKey(key)
+	s := c.section(name, subsection, true)
+	for i, e := range s.entries {
+		if e.key == key {
+			s.entries[i].value = value
+			return
+		}
+	}
+	s.entries = append(s.entries, entry{key, value})
+}
+
+func (c *Config) Unset(key string) bool {
+	name, subsection, key := splitKey(key)
+	s := c.section(name, subsection, false)
+	if s == nil {
+		return false
+	}
+	entries := make([]entry, 0, len(s.entries))
+	for _, e := range s.entries {
+		if e.key != key {
+			entries = append(entries, e)
+		}
+	}
+	removed := len(entries) != len(s.entries)
+	s.entries = entries
+	return removed
+}
+
+func (c *Config) HasSection(name string, subsection string) bool {
+	s := c.section(name, subsection, false)
+	return s != nil && len(s.entries) > 0
+}
+
+func (c *Config) RemoveSection(name string, subsection string) bool {
+	for i, s := range c.sections {
+		if s.name == name && s.subsection == subsection {
+			c.sections = append(c.sections[:i], c.sections[i+1:]...)
+			return len(s.entries) > 0
+		}
+	}
+	return false
+}
+
+func (c *Config) RenameSection(name string, oldSubsection string, newSubsection string) bool {
+	c.RemoveSection(name, newSubsection)
+	s := c.section(name, oldSubsection, false)
+	if s == nil {
+		return false
+	}
+	s.subsection = newSubsection
+	return len(s.entries) > 0
+}
+
+func (c *Config) CopySection(name string, oldSubsection string, newSubsection string) bool {
+	c.RemoveSection(name, newSubsection)
+	s := c.section(name, oldSubsection, false)
+	if s == nil {
+		return false
+	}
+	c.section(name, newSubsection, true).entries = append([]entry{}, s.entries...)
+	return len(s.entries) > 0
+}
+
+func (c *Config) Subsections(name string) []string {
+	subsections := make([]string, 0)
+	for _, s := range c.sections {
+		if s.name == name && s.subsection != "" && len(s.entries) > 0 {
+			subsections = append(subsections, s.subsection)
+		}
+	}
+	return subsections
+}
+
+func (c *Config) section(name string, subsection string, create bool) *section {
+	for _, s := range c.sections {
+		if s.name == name && s.subsection == subsection {
+			return s
+		}
+	}
+	if !create {
+		return nil
+	}
+	s := &section{name: name, subsection: subsection}
+	c.sections = append(c.sections, s)
+	return s
+}
+
+// splitKey splits a key such as remote.origin.url into its section, subsection and variable name. The subsection may
+// itself contain dots, e.g. branch.release.1.0.remote.
+func splitKey(key string) (string, string, string) {
+	first := strings.Index(key, ".")
+	last := strings.LastIndex(key, ".")
+	if first == -1 {
+		return key, "", ""
+	}
+	if first == last {
+		return key[:first], "", key[last+1:]
+	}
+	return key[:first], key[first+1 : last], key[last+1:]
+}
@@ -0,0 +1,26 @@
+package config
+
+import "strconv"
+
+type BadConfig struct {
+	Path string
+	Line int
+}
+
+func (e *BadConfig) Error() string {
+	return "bad config line " + strconv.Itoa(e.Line) + " in " + e.Path
+}
+
+type BadValue struct {
+	Key   string
+	Value string
+}
+
+func (e *BadValue) Error() string {
+	return "bad value '" + e.Value + "' for config " + e.Key
+}
+
+var (
+	ErrBadConfig *BadConfig
+	ErrBadValue  *BadValue
+)
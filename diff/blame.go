@@ -0,0 +1,186 @@
+package diff
+
+import (
+	"fmt"
+	"patchy/refs"
+	"path/filepath"
+	"strings"
+)
+
+// BlameLine is a line of a file attributed to the commit which last changed it.
+type BlameLine struct {
+	Commit string
+	// Path is the path of the file in Commit, which differs from the blamed path if the file was renamed since
+	Path string
+	// OrigLine and FinalLine are the 1-based numbers of the line in Commit and in the blamed revision
+	OrigLine  int
+	FinalLine int
+	Text      string
+}
+
+// pendingLine is a line of the blamed file not yet attributed to a commit, by its indices in the blamed revision and in
+// the commit being looked at.
+type pendingLine struct {
+	final   int
+	current int
+}
+
+// Blame attributes lines start to end, counted from 1, of the file at path in a commit to the commits which introduced
+// them, going back through history and following the file across renames. An end of 0 stands for the last line.
+func (d *Differ) Blame(commitHash string, path string, start int, end int) ([]BlameLine, error) {
+	commit, err := d.objects.ReadCommit(commitHash)
+	if err != nil {
+		return nil, fmt.Errorf("Blame: %w", err)
+	}
+	hash, err := d.treeFile(commit.Tree, path)
+	if err != nil {
+		return nil, fmt.Errorf("Blame: %w", err)
+	} else if hash == "" {
+		return nil, fmt.Errorf("Blame: %w", &refs.PathNotInRev{Path: path, RevSpec: commitHash[:7]})
+	}
+	data, err := d.objects.ReadBlob(hash)
+	if err != nil {
+		return nil, fmt.Errorf("Blame: %w", err)
+	}
+	finalLines := SplitLines(data)
+	if end == 0 {
+		end = len(finalLines)
+	}
+	if len(finalLines) == 0 && start == 1 {
+		return []BlameLine{}, nil
+	}
+	if start < 1 || end < start || end > len(finalLines) {
+		return nil, fmt.Errorf("Blame: file %s has only %d lines", path, len(finalLines))
+	}
+
+	blamed := make([]BlameLine, end-start+1)
+	pending := make([]pendingLine, 0, len(blamed))
+	for i := start - 1; i < end; i++ {
+		pending = append(pending, pendingLine{i, i})
+	}
+	attribute := func(lines []pendingLine) {
+		for _, line := range lines {
+			blamed[line.final-start+1] = BlameLine{
+				Commit:    commitHash,
+				Path:      path,
+				OrigLine:  line.current + 1,
+				FinalLine: line.final + 1,
+				Text:      finalLines[line.final],
+			}
+		}
+	}
+
+	lines := finalLines
+	for len(pending) > 0 {
+		if commit.Parent == nil {
+			attribute(pending)
+			break
+		}
+		parentHash := *commit.Parent
+		parent, err := d.objects.ReadCommit(parentHash)
+		if err != nil {
+			return nil, fmt.Errorf("Blame: %w", err)
+		}
+		parentPath, parentFile, err := d.parentFile(commit.Tree, parent.Tree, path, lines)
+		if err != nil {
+			return nil, fmt.Errorf("Blame: %w", err)
+		}
+		if parentFile == "" {
+			attribute(pending)
+			break
+		}
+
+		if parentFile != hash {
+			data, err := d.objects.ReadBlob(parentFile)
+			if err != nil {
+				return nil, fmt.Errorf("Blame: %w", err)
+			}
+			parentLines := SplitLines(data)
+			// Lines left unchanged by the commit came from its parent, and all others were introduced by it
+			fromParent := make(map[int]int)
+			for _, edit := range DiffLines(parentLines, lines) {
+				if edit.Op == Equal {
+					fromParent[edit.NewLine] = edit.OldLine
+				}
+			}
+			remaining := make([]pendingLine, 0, len(pending))
+			introduced := make([]pendingLine, 0)
+			for _, line := range pending {
+				if parentLine, ok := fromParent[line.current]; ok {
+					remaining = append(remaining, pendingLine{line.final, parentLine})
+				} else {
+					introduced = append(introduced, line)
+				}
+			}
+			attribute(introduced)
+			pending, lines = remaining, parentLines
+		}
+		commitHash, commit, path, hash = parentHash, parent, parentPath, parentFile
+	}
+	return blamed, nil
+}
+
+// parentFile finds the file at path in a commit's tree in the tree of its parent, where it may have had another name,
+// returning its path and blob hash there. The path and hash are empty if the commit added the file.
+func (d *Differ) parentFile(tree string, parentTree string, path string, lines []string) (string, string, error) {
+	hash, err := d.treeFile(parentTree, path)
+	if err != nil || hash != "" {
+		return path, hash, err
+	}
+	changes, err := d.TreeDiff(tree, parentTree)
+	if err != nil {
+		return "", "", err
+	}
+	// A file moved as is shows up as such, but one which was also changed is only a deletion, so the deleted file most
+	// similar to it is taken instead, as long as at least half of their lines are the same
+	bestPath, bestHash, bestScore := "", "", 0.5
+	for _, change := range changes {
+		if change.ChangeType == Moved && filepath.ToSlash(change.NewName) == path {
+			return filepath.ToSlash(change.OldName), change.OldHash, nil
+		}
+		if change.ChangeType != Deleted {
+			continue
+		}
+		data, err := d.objects.ReadBlob(change.OldHash)
+		if err != nil {
+			return "", "", err
+		}
+		oldLines := SplitLines(data)
+		if len(oldLines)+len(lines) == 0 {
+			continue
+		}
+		same := 0
+		for _, edit := range DiffLines(oldLines, lines) {
+			if edit.Op == Equal {
+				same++
+			}
+		}
+		if score := float64(2*same) / float64(len(oldLines)+len(lines)); score >= bestScore {
+			bestPath, bestHash, bestScore = filepath.ToSlash(change.OldName), change.OldHash, score
+		}
+	}
+	return bestPath, bestHash, nil
+}
+
+// treeFile looks up the blob at a slash-separated path in a tree, returning an empty hash if there is none.
+func (d *Differ) treeFile(tree string, path string) (string, error) {
+	hash := tree
+	parts := strings.Split(path, "/")
+	for i, part := range parts {
+		entries, err := d.objects.ReadTree(hash)
+		if err != nil {
+			return "", err
+		}
+		found := false
+		for _, entry := range entries {
+			if entry.Name == part && (entry.Mode == "040000") == (i < len(parts)-1) {
+				hash, found = entry.Hash, true
+				break
+			}
+		}
+		if !found {
+			return "", nil
+		}
+	}
+	return hash, nil
+}
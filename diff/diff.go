@@ -3,8 +3,6 @@ package diff
 import (
 	"fmt"
 	"patchy/objects"
-	"patchy/refs"
-	"patchy/repo"
 	"patchy/util"
 	"sort"
 
@@ -28,8 +26,8 @@ type FileChange struct {
 	ChangeType ChangeType
 }
 
-func TreeDiff(newTree string, oldTree string) ([]FileChange, error) {
-	newEntries, err := objects.ReadTreeRecursive(newTree)
+func (d *Differ) TreeDiff(newTree string, oldTree string) ([]FileChange, error) {
+	newEntries, err := d.objects.ReadTreeRecursive(newTree)
 	if err != nil {
 		return nil, fmt.Errorf("TreeDiff: %w", err)
 	}
@@ -37,7 +35,7 @@ func TreeDiff(newTree string, oldTree string) ([]FileChange, error) {
 
 	var oldEntries []objects.TreeEntry
 	if len(oldTree) > 0 {
-		oldEntries, err = objects.ReadTreeRecursive(oldTree)
+		oldEntries, err = d.objects.ReadTreeRecursive(oldTree)
 		if err != nil {
 			return nil, fmt.Errorf("TreeDiff: %w", err)
 		}
@@ -55,27 +53,38 @@ func TreeDiff(newTree string, oldTree string) ([]FileChange, error) {
 	for _, entry := range oldEntries {
 		oldTreeByName[entry.Name] = entry.Hash
 	}
-	newTreeByHash := make(map[string]string)
-	for _, entry := range newEntries {
-		newTreeByHash[entry.Hash] = entry.Name
-	}
-	oldTreeByHash := make(map[string]string)
+	// Only files which disappeared from the old tree are candidates for being moved, so that copies are reported
+	// as additions
+	deletedByHash := make(map[string][]string)
 	for _, entry := range oldEntries {
-		oldTreeByHash[entry.Hash] = entry.Name
+		if _, exists := newTreeByName[entry.Name]; !exists {
+			deletedByHash[entry.Hash] = append(deletedByHash[entry.Hash], entry.Name)
+		}
 	}
 
-	for name, hash1 := range newTreeByName {
+	for _, entry := range newEntries {
+		name, hash1 := entry.Name, entry.Hash
 		if hash2, exists := oldTreeByName[name]; exists {
 			if hash1 != hash2 {
 				changes = append(changes, FileChange{
 					OldName:    name,
 					NewName:    name,
-					OldHash:    hash1,
-					NewHash:    hash2,
+					OldHash:    hash2,
+					NewHash:    hash1,
 					ChangeType: Modified,
 				})
 			}
-		} else if _, renamed := oldTreeByHash[hash1]; !renamed {
+		} else if oldNames := deletedByHash[hash1]; len(oldNames) > 0 {
+			// Check for renamed/moved files
+			deletedByHash[hash1] = oldNames[1:]
+			changes = append(changes, FileChange{
+				OldName:    oldNames[0],
+				NewName:    name,
+				OldHash:    hash1,
+				NewHash:    hash1,
+				ChangeType: Moved,
+			})
+		} else {
 			changes = append(changes, FileChange{
 				OldName:    "",
 				NewName:    name,
@@ -86,10 +95,8 @@ func TreeDiff(newTree string, oldTree string) ([]FileChange, error) {
 		}
 	}
 	// Check for deleted files
-	for name, hash2 := range oldTreeByName {
-		_, exists := newTreeByName[name]
-		_, renamed := newTreeByHash[hash2]
-		if !exists && !renamed {
+	for hash2, names := range deletedByHash {
+		for _, name := range names {
 			changes = append(changes, FileChange{
 				OldName:    name,
 				NewName:    "",
@@ -99,42 +106,33 @@ func TreeDiff(newTree string, oldTree string) ([]FileChange, error) {
 			})
 		}
 	}
-	// Check for renamed/moved files
-	for hash, oldName := range oldTreeByHash {
-		if newName, exists := newTreeByHash[hash]; exists && oldName != newName {
-			changes = append(changes, FileChange{
-				OldName:    oldName,
-				NewName:    newName,
-				OldHash:    hash,
-				NewHash:    hash,
-				ChangeType: Moved,
-			})
-		}
-	}
 	sort.Slice(changes, func(i, j int) bool {
-		return changes[i].NewName < changes[j].NewName
+		if changes[i].NewName != changes[j].NewName {
+			return changes[i].NewName < changes[j].NewName
+		}
+		return changes[i].OldName < changes[j].OldName
 	})
 	return changes, nil
 }
 
-func WorkingTreeDiff() ([]FileChange, error) {
-	repoRoot, err := repo.FindRepoRoot()
+func (d *Differ) WorkingTreeDiff() ([]FileChange, error) {
+	repoRoot, err := d.repo.WorkTree()
 	if err != nil {
 		return nil, fmt.Errorf("WorkingTreeDiff: %w", err)
 	}
-	headState, err := refs.ReadHead()
+	headState, err := d.refs.ReadHead()
 	if err != nil {
 		return nil, fmt.Errorf("WorkingTreeDiff: %w", err)
 	}
-	headCommit, err := objects.ReadCommit(headState.Commit)
+	headCommit, err := d.objects.ReadCommit(headState.Commit)
 	if err != nil {
 		return nil, fmt.Errorf("WorkingTreeDiff: %w", err)
 	}
-	currentTree, err := objects.WriteTree(repoRoot)
+	currentTree, err := d.objects.WriteTree(repoRoot)
 	if err != nil {
 		return nil, fmt.Errorf("WorkingTreeDiff: %w", err)
 	}
-	changes, err := TreeDiff(currentTree, headCommit.Tree)
+	changes, err := d.TreeDiff(currentTree, headCommit.Tree)
 	if err != nil {
 		return nil, fmt.Errorf("WorkingTreeDiff: %w", err)
 	}
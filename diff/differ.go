@@ -0,0 +1,56 @@
+package diff
+
+import (
+	"io"
+	"patchy/objects"
+	"patchy/refs"
+	"patchy/repo"
+)
+
+// Differ compares and merges the trees of a repository, and its working tree against HEAD.
+type Differ struct {
+	repo    *repo.Repository
+	objects *objects.Store
+	refs    *refs.Store
+}
+
+var defaultDiffer = &Differ{objects: objects.DefaultStore(), refs: refs.DefaultStore()}
+
+func NewDiffer(r *repo.Repository, objectStore *objects.Store, refStore *refs.Store) *Differ {
+	return &Differ{repo: r, objects: objectStore, refs: refStore}
+}
+
+// DefaultDiffer returns the differ of the repository found from the working directory, which the package level
+// functions use.
+func DefaultDiffer() *Differ {
+	return defaultDiffer
+}
+
+func TreeDiff(newTree string, oldTree string) ([]FileChange, error) {
+	return defaultDiffer.TreeDiff(newTree, oldTree)
+}
+
+func WorkingTreeDiff() ([]FileChange, error) {
+	return defaultDiffer.WorkingTreeDiff()
+}
+
+func MergeTrees(
+	baseTree string, oursTree string, theirsTree string, oursLabel string, theirsLabel string) (*TreeMerge, error) {
+	return defaultDiffer.MergeTrees(baseTree, oursTree, theirsTree, oursLabel, theirsLabel)
+}
+
+func SelectHunks(in io.Reader) (string, error) {
+	return defaultDiffer.SelectHunks(in)
+}
+
+func Blame(commitHash string, path string, start int, end int) ([]BlameLine, error) {
+	return defaultDiffer.Blame(commitHash, path, start, end)
+}
+
+func PrintPatch(changes []FileChange) error {
+	return defaultDiffer.PrintPatch(changes)
+}
+
+func PrintStat(changes []FileChange) error {
+	return defaultDiffer.PrintStat(changes)
+}
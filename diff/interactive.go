@@ -0,0 +1,261 @@
+package diff
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"patchy/objects"
+	"patchy/objects/objecttype"
+	"patchy/util"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+var hunkHelp = []string{
+	"y - commit this hunk",
+	"n - do not commit this hunk",
+	"q - quit; do not commit this hunk or any of the remaining ones",
+	"s - split the current hunk into smaller hunks",
+	"e - manually edit the current hunk",
+	"? - print help",
+}
+
+// SelectHunks goes through the hunks of each file modified in the working tree, asking which of them to keep, and
+// writes a tree of HEAD with only the chosen hunks applied. Answers are read a line at a time from in, and running out
+// of them is the same as quitting. Added, deleted, moved and binary files are left as they are in HEAD.
+func (d *Differ) SelectHunks(in io.Reader) (string, error) {
+	headState, err := d.refs.ReadHead()
+	if err != nil {
+		return "", fmt.Errorf("SelectHunks: %w", err)
+	}
+	files := make(map[string]string)
+	var changes []FileChange
+	if headState.Commit != "" {
+		headCommit, err := d.objects.ReadCommit(headState.Commit)
+		if err != nil {
+			return "", fmt.Errorf("SelectHunks: %w", err)
+		}
+		entries, err := d.objects.ReadTreeRecursive(headCommit.Tree)
+		if err != nil {
+			return "", fmt.Errorf("SelectHunks: %w", err)
+		}
+		for _, entry := range objects.FlattenTreeEntries(entries) {
+			files[entry.Name] = entry.Hash
+		}
+		if changes, err = d.WorkingTreeDiff(); err != nil {
+			return "", fmt.Errorf("SelectHunks: %w", err)
+		}
+	}
+
+	s := &hunkSelector{differ: d, reader: bufio.NewReader(in)}
+	selectable := false
+	for _, change := range changes {
+		if change.ChangeType != Modified {
+			continue
+		}
+		oldData, newData, err := d.readChangeBlobs(change)
+		if err != nil {
+			return "", fmt.Errorf("SelectHunks: %w", err)
+		}
+		if isBinary(oldData) || isBinary(newData) {
+			continue
+		}
+		selectable = true
+		oldLines := SplitLines(oldData)
+		chosen, quit, err := s.selectFile(change.NewName, Hunks(DiffLines(oldLines, SplitLines(newData)), 3))
+		if err != nil {
+			return "", fmt.Errorf("SelectHunks: %w", err)
+		}
+		if len(chosen) > 0 {
+			data := []byte(strings.Join(ApplyHunks(oldLines, chosen), ""))
+			if files[change.NewName], err = d.objects.WriteObject(objecttype.Blob, data); err != nil {
+				return "", fmt.Errorf("SelectHunks: %w", err)
+			}
+		}
+		if quit {
+			break
+		}
+	}
+	if !selectable {
+		util.Println("No changes.")
+	}
+
+	entries := make([]objects.TreeEntry, 0, len(files))
+	for name, hash := range files {
+		entries = append(entries, objects.TreeEntry{Mode: "100644", Name: name, Hash: hash})
+	}
+	tree, err := d.objects.BuildTree(entries)
+	if err != nil {
+		return "", fmt.Errorf("SelectHunks: %w", err)
+	}
+	return tree, nil
+}
+
+type hunkSelector struct {
+	differ *Differ
+	reader *bufio.Reader
+}
+
+// selectFile asks about each hunk of a file in turn, returning the chosen ones and whether the user quit.
+func (s *hunkSelector) selectFile(name string, hunks []Hunk) ([]Hunk, bool, error) {
+	util.ColorPrintf(color.Bold, "diff --patchy a/%s b/%s\n--- a/%s\n+++ b/%s\n", name, name, name, name)
+	chosen := make([]Hunk, 0)
+	for i := 0; i < len(hunks); {
+		hunk := hunks[i]
+		util.ColorPrintln(color.FgCyan, hunk.Header())
+		for _, edit := range hunk.Edits {
+			PrintLineEdit(edit)
+		}
+		parts := hunk.Split()
+		options := "y,n,q,e,?"
+		if len(parts) > 1 {
+			options = "y,n,q,s,e,?"
+		}
+		util.ColorPrintf(color.FgBlue, "(%d/%d) Commit this hunk [%s]? ", i+1, len(hunks), options)
+		answer, err := s.readAnswer()
+		if err != nil {
+			return nil, false, err
+		}
+		switch {
+		case answer == "y":
+			chosen = append(chosen, hunk)
+			i++
+		case answer == "n":
+			i++
+		case answer == "q":
+			return chosen, true, nil
+		case answer == "s" && len(parts) > 1:
+			util.Printf("Split into %d hunks.\n", len(parts))
+			hunks = slices.Concat(hunks[:i], parts, hunks[i+1:])
+		case answer == "e":
+			edited, err := s.editHunk(hunk)
+			if err != nil {
+				return nil, false, err
+			}
+			if edited == nil {
+				util.ColorPrintln(color.FgRed, "Your edited hunk does not apply.")
+				continue
+			}
+			chosen = append(chosen, *edited)
+			i++
+		case answer != "":
+			for _, line := range hunkHelp {
+				util.ColorPrintln(color.FgRed, line)
+			}
+		}
+	}
+	return chosen, false, nil
+}
+
+// readAnswer reads the first letter of the next line of input, which is q once the input runs out.
+func (s *hunkSelector) readAnswer() (string, error) {
+	line, err := s.reader.ReadString('\n')
+	if errors.Is(err, io.EOF) && line == "" {
+		util.Println()
+		return "q", nil
+	} else if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	line = strings.ToLower(strings.TrimSpace(line))
+	if line == "" {
+		return "", nil
+	}
+	return line[:1], nil
+}
+
+// editHunk lets the user edit a hunk in their editor. The lines it removes and keeps must stay the same, so only added
+// lines can be dropped and removed lines turned into kept ones; nil is returned for edits which break this.
+func (s *hunkSelector) editHunk(hunk Hunk) (*Hunk, error) {
+	localDir, err := s.differ.repo.LocalDir()
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(localDir, "HUNK_EDIT.diff")
+	var content strings.Builder
+	content.WriteString("# Manual hunk edit mode -- see bottom for a quick guide.\n")
+	content.WriteString(hunk.Header() + "\n")
+	for _, edit := range hunk.Edits {
+		switch edit.Op {
+		case Equal:
+			content.WriteString(" ")
+		case Insert:
+			content.WriteString("+")
+		case Delete:
+			content.WriteString("-")
+		}
+		content.WriteString(edit.Text)
+		if !strings.HasSuffix(edit.Text, "\n") {
+			content.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+	content.WriteString("# ---\n")
+	content.WriteString("# To remove '-' lines, make them ' ' lines (context).\n")
+	content.WriteString("# To remove '+' lines, delete them.\n")
+	content.WriteString("# Lines starting with # will be removed.\n")
+	if err := os.WriteFile(path, []byte(content.String()), 0644); err != nil {
+		return nil, err
+	}
+	defer os.Remove(path)
+	if err := util.EditFile(path); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	edits := make([]LineEdit, 0, len(hunk.Edits))
+	oldLine, newLine := hunk.Edits[0].OldLine, hunk.Edits[0].NewLine
+	for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+		if strings.HasPrefix(line, "#") || strings.HasPrefix(line, "@@") {
+			continue
+		}
+		if strings.HasPrefix(line, "\\") {
+			if len(edits) > 0 {
+				edits[len(edits)-1].Text = strings.TrimSuffix(edits[len(edits)-1].Text, "\n")
+			}
+			continue
+		}
+		// Editors may strip the trailing space from an empty unchanged line
+		if line == "" {
+			line = " "
+		}
+		edit := LineEdit{OldLine: oldLine, NewLine: newLine, Text: line[1:] + "\n"}
+		switch line[0] {
+		case ' ':
+			edit.Op = Equal
+			oldLine++
+			newLine++
+		case '+':
+			edit.Op = Insert
+			newLine++
+		case '-':
+			edit.Op = Delete
+			oldLine++
+		default:
+			return nil, nil
+		}
+		edits = append(edits, edit)
+	}
+	if len(edits) == 0 || !slices.Equal(oldSide(edits), oldSide(hunk.Edits)) {
+		return nil, nil
+	}
+	edited := newHunk(edits)
+	return &edited, nil
+}
+
+// oldSide returns the lines an edit script expects to find in the old lines.
+func oldSide(edits []LineEdit) []string {
+	lines := make([]string, 0, len(edits))
+	for _, edit := range edits {
+		if edit.Op != Insert {
+			lines = append(lines, edit.Text)
+		}
+	}
+	return lines
+}
@@ -0,0 +1,106 @@
+package diff_test
+
+import (
+	"fmt"
+	"os"
+	"patchy/objects"
+	"patchy/objects/objecttype"
+	"patchy/repo"
+	"patchy/repository"
+	"patchy/util"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// numberedLines returns the lines "1" to "n", with the lines given in changed replaced.
+func numberedLines(n int, changed map[int]string) string {
+	var b strings.Builder
+	for i := 1; i <= n; i++ {
+		if line, ok := changed[i]; ok {
+			b.WriteString(line + "\n")
+		} else {
+			fmt.Fprintf(&b, "%d\n", i)
+		}
+	}
+	return b.String()
+}
+
+// newRepo creates a repository whose HEAD holds file.txt with content, and whose working tree holds it with modified.
+func newRepo(t *testing.T, content string, modified string) *repository.Repository {
+	t.Helper()
+	dir := t.TempDir()
+	if _, err := repo.InitRepo(dir); err != nil {
+		t.Fatal(err)
+	}
+	r, err := repository.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blob, err := r.Objects.WriteObject(objecttype.Blob, []byte(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := r.Objects.BuildTree([]objects.TreeEntry{{Mode: "100644", Name: "file.txt", Hash: blob}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit, err := r.Objects.WriteCommitWithAuthor(tree, nil, "initial", "tester", time.Unix(1700000000, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Refs.UpdateRef("refs/heads/main", commit); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "file.txt"), []byte(modified), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestSelectHunks(t *testing.T) {
+	util.Quiet = true
+	t.Cleanup(func() {
+		util.Quiet = false
+	})
+	original := numberedLines(30, nil)
+	// Lines 2 and 4 are close enough to share a hunk, which can be split, while line 25 has one of its own
+	modified := numberedLines(30, map[int]string{2: "two", 4: "four", 25: "twenty-five"})
+	tests := []struct {
+		name    string
+		answers string
+		want    string
+	}{
+		{"all", "y\ny\n", modified},
+		{"first hunk", "y\nn\n", numberedLines(30, map[int]string{2: "two", 4: "four"})},
+		{"last hunk", "n\ny\n", numberedLines(30, map[int]string{25: "twenty-five"})},
+		{"split", "s\nn\ny\ny\n", numberedLines(30, map[int]string{4: "four", 25: "twenty-five"})},
+		{"help and blank lines are asked again", "?\n\ny\nn\n", numberedLines(30, map[int]string{2: "two", 4: "four"})},
+		{"quit", "y\nq\n", numberedLines(30, map[int]string{2: "two", 4: "four"})},
+		{"end of input", "", original},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := newRepo(t, original, modified)
+			tree, err := r.Diff.SelectHunks(strings.NewReader(test.answers))
+			if err != nil {
+				t.Fatal(err)
+			}
+			entries, err := r.Objects.ReadTree(tree)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 1 || entries[0].Name != "file.txt" {
+				t.Fatalf("tree has entries %+v, want only file.txt", entries)
+			}
+			data, err := r.Objects.ReadBlob(entries[0].Hash)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != test.want {
+				t.Errorf("file.txt is\n%s\nwant\n%s", data, test.want)
+			}
+		})
+	}
+}
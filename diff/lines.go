@@ -0,0 +1,106 @@
+package diff
+
+import "strings"
+
+type LineOp int
+
+const (
+	Equal LineOp = iota
+	Insert
+	Delete
+)
+
+// LineEdit is one step of an edit script turning one list of lines into another. OldLine and NewLine are the indices
+// of the line in the old and new lists; for insertions OldLine is the position in the old lines the line is inserted
+// at, and for deletions NewLine is the corresponding position in the new lines.
+type LineEdit struct {
+	Op      LineOp
+	OldLine int
+	NewLine int
+	Text    string
+}
+
+// SplitLines splits data into lines, keeping the line terminators so that joining the lines gives back the original
+// data. A final line without a terminator is kept as is.
+func SplitLines(data []byte) []string {
+	lines := make([]string, 0)
+	text := string(data)
+	for len(text) > 0 {
+		end := strings.IndexByte(text, '\n') + 1
+		if end == 0 {
+			end = len(text)
+		}
+		lines = append(lines, text[:end])
+		text = text[end:]
+	}
+	return lines
+}
+
+// DiffLines computes a shortest edit script from oldLines to newLines using Myers' algorithm.
+func DiffLines(oldLines []string, newLines []string) []LineEdit {
+	n, m := len(oldLines), len(newLines)
+	offset := n + m + 1
+	v := make([]int, 2*offset+1)
+	// trace[d] holds the furthest reaching x on each diagonal k in [-d, d] after d edits, indexed by k+d
+	trace := make([][]int, 0)
+	for d := 0; d <= n+m; d++ {
+		done := false
+		for k := -d; k <= d; k += 2 {
+			x := 0
+			if d == 0 {
+				x = 0
+			} else if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && oldLines[x] == newLines[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				done = true
+			}
+		}
+		trace = append(trace, append([]int{}, v[offset-d:offset+d+1]...))
+		if done {
+			break
+		}
+	}
+
+	edits := make([]LineEdit, 0, n+m)
+	x, y := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		prev := trace[d-1]
+		k := x - y
+		prevK := k - 1
+		if k == -d || (k != d && prev[k-1+d-1] < prev[k+1+d-1]) {
+			prevK = k + 1
+		}
+		prevX := prev[prevK+d-1]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+			edits = append(edits, LineEdit{Equal, x, y, oldLines[x]})
+		}
+		if x == prevX {
+			y--
+			edits = append(edits, LineEdit{Insert, x, y, newLines[y]})
+		} else {
+			x--
+			edits = append(edits, LineEdit{Delete, x, y, oldLines[x]})
+		}
+	}
+	for x > 0 && y > 0 {
+		x--
+		y--
+		edits = append(edits, LineEdit{Equal, x, y, oldLines[x]})
+	}
+	for i, j := 0, len(edits)-1; i < j; i, j = i+1, j-1 {
+		edits[i], edits[j] = edits[j], edits[i]
+	}
+	return edits
+}
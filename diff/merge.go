@@ -0,0 +1,254 @@
+package diff
+
+import (
+	"fmt"
+	"patchy/objects"
+	"patchy/objects/objecttype"
+	"slices"
+	"sort"
+	"strings"
+)
+
+type Conflict struct {
+	Path string
+	Kind string
+}
+
+type TreeMerge struct {
+	// Tree contains the merged files, with conflict markers in files whose changes could not be merged
+	Tree      string
+	Conflicts []Conflict
+}
+
+// chunk is a run of changed lines: the base lines [start, end) are replaced by lines.
+type chunk struct {
+	start int
+	end   int
+	lines []string
+}
+
+// MergeLines merges the changes made from base to ours and from base to theirs. Changes which overlap or touch are
+// only merged if both sides made the same change; otherwise both versions are kept between conflict markers and the
+// merge is reported as conflicted.
+func MergeLines(base []string, ours []string, theirs []string, oursLabel string, theirsLabel string) ([]string, bool) {
+	oursChunks := changedChunks(DiffLines(base, ours))
+	theirsChunks := changedChunks(DiffLines(base, theirs))
+	merged := make([]string, 0, len(ours))
+	conflicted := false
+	pos, i, j := 0, 0, 0
+	for i < len(oursChunks) || j < len(theirsChunks) {
+		// Group together all chunks from either side that overlap the first remaining one
+		nextI, nextJ := i, j
+		var start, end int
+		if j >= len(theirsChunks) || (i < len(oursChunks) && oursChunks[i].start <= theirsChunks[j].start) {
+			start, end = oursChunks[i].start, oursChunks[i].end
+			nextI++
+		} else {
+			start, end = theirsChunks[j].start, theirsChunks[j].end
+			nextJ++
+		}
+		for {
+			if nextI < len(oursChunks) && oursChunks[nextI].start <= end {
+				end = max(end, oursChunks[nextI].end)
+				nextI++
+			} else if nextJ < len(theirsChunks) && theirsChunks[nextJ].start <= end {
+				end = max(end, theirsChunks[nextJ].end)
+				nextJ++
+			} else {
+				break
+			}
+		}
+
+		merged = append(merged, base[pos:start]...)
+		oursLines := applyChunks(base, oursChunks[i:nextI], start, end)
+		theirsLines := applyChunks(base, theirsChunks[j:nextJ], start, end)
+		switch {
+		case nextJ == j:
+			merged = append(merged, oursLines...)
+		case nextI == i:
+			merged = append(merged, theirsLines...)
+		case slices.Equal(oursLines, theirsLines):
+			merged = append(merged, oursLines...)
+		default:
+			conflicted = true
+			merged = append(merged, "<<<<<<< "+oursLabel+"\n")
+			merged = append(merged, terminateLines(oursLines)...)
+			merged = append(merged, "=======\n")
+			merged = append(merged, terminateLines(theirsLines)...)
+			merged = append(merged, ">>>>>>> "+theirsLabel+"\n")
+		}
+		pos, i, j = end, nextI, nextJ
+	}
+	merged = append(merged, base[pos:]...)
+	return merged, conflicted
+}
+
+// MergeTrees applies the changes made between baseTree and theirsTree, as found by TreeDiff, to oursTree. Files changed
+// on both sides are merged line by line.
+func (d *Differ) MergeTrees(
+	baseTree string, oursTree string, theirsTree string, oursLabel string, theirsLabel string) (*TreeMerge, error) {
+	changes, err := d.TreeDiff(theirsTree, baseTree)
+	if err != nil {
+		return nil, fmt.Errorf("MergeTrees: %w", err)
+	}
+	oursEntries, err := d.objects.ReadTreeRecursive(oursTree)
+	if err != nil {
+		return nil, fmt.Errorf("MergeTrees: %w", err)
+	}
+	files := make(map[string]string)
+	for _, entry := range objects.FlattenTreeEntries(oursEntries) {
+		files[entry.Name] = entry.Hash
+	}
+
+	m := &merger{objects: d.objects, files: files, oursLabel: oursLabel, theirsLabel: theirsLabel}
+	for _, change := range changes {
+		switch change.ChangeType {
+		case Added:
+			err = m.add(change.NewName, change.NewHash)
+		case Deleted:
+			if current, exists := files[change.OldName]; exists && current == change.OldHash {
+				delete(files, change.OldName)
+			} else if exists {
+				m.conflict(change.OldName, "modify/delete")
+			}
+		case Modified:
+			if current, exists := files[change.NewName]; !exists {
+				files[change.NewName] = change.NewHash
+				m.conflict(change.NewName, "delete/modify")
+			} else if current == change.OldHash {
+				files[change.NewName] = change.NewHash
+			} else if current != change.NewHash {
+				err = m.mergeFile(change.NewName, change.OldHash, current, change.NewHash)
+			}
+		case Moved:
+			// A file which was renamed on their side keeps any changes made to it on ours
+			hash := change.NewHash
+			if current, exists := files[change.OldName]; exists {
+				hash = current
+				delete(files, change.OldName)
+			}
+			err = m.add(change.NewName, hash)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("MergeTrees: %w", err)
+		}
+	}
+
+	entries := make([]objects.TreeEntry, 0, len(files))
+	for name, hash := range files {
+		entries = append(entries, objects.TreeEntry{Mode: "100644", Name: name, Hash: hash})
+	}
+	tree, err := d.objects.BuildTree(entries)
+	if err != nil {
+		return nil, fmt.Errorf("MergeTrees: %w", err)
+	}
+	sort.Slice(m.conflicts, func(i, j int) bool {
+		return m.conflicts[i].Path < m.conflicts[j].Path
+	})
+	return &TreeMerge{Tree: tree, Conflicts: m.conflicts}, nil
+}
+
+type merger struct {
+	objects     *objects.Store
+	files       map[string]string
+	conflicts   []Conflict
+	oursLabel   string
+	theirsLabel string
+}
+
+func (m *merger) conflict(path string, kind string) {
+	m.conflicts = append(m.conflicts, Conflict{Path: path, Kind: kind})
+}
+
+func (m *merger) add(path string, hash string) error {
+	if current, exists := m.files[path]; !exists {
+		m.files[path] = hash
+	} else if current != hash {
+		return m.mergeFile(path, "", current, hash)
+	}
+	return nil
+}
+
+func (m *merger) mergeFile(path string, baseHash string, oursHash string, theirsHash string) error {
+	kind := "content"
+	if baseHash == "" {
+		kind = "add/add"
+	}
+	contents := make([][]byte, 3)
+	for i, hash := range []string{baseHash, oursHash, theirsHash} {
+		if hash == "" {
+			continue
+		}
+		data, err := m.objects.ReadBlob(hash)
+		if err != nil {
+			return err
+		}
+		// Binary files cannot be merged line by line, so ours is kept as is
+		if isBinary(data) {
+			m.conflict(path, "binary")
+			return nil
+		}
+		contents[i] = data
+	}
+	merged, conflicted := MergeLines(
+		SplitLines(contents[0]), SplitLines(contents[1]), SplitLines(contents[2]), m.oursLabel, m.theirsLabel)
+	hash, err := m.objects.WriteObject(objecttype.Blob, []byte(strings.Join(merged, "")))
+	if err != nil {
+		return err
+	}
+	m.files[path] = hash
+	if conflicted {
+		m.conflict(path, kind)
+	}
+	return nil
+}
+
+func changedChunks(edits []LineEdit) []chunk {
+	chunks := make([]chunk, 0)
+	var current *chunk
+	pos := 0
+	for _, edit := range edits {
+		if edit.Op == Equal {
+			if current != nil {
+				chunks = append(chunks, *current)
+				current = nil
+			}
+			pos++
+			continue
+		}
+		if current == nil {
+			current = &chunk{start: pos, end: pos, lines: make([]string, 0)}
+		}
+		if edit.Op == Delete {
+			pos++
+			current.end = pos
+		} else {
+			current.lines = append(current.lines, edit.Text)
+		}
+	}
+	if current != nil {
+		chunks = append(chunks, *current)
+	}
+	return chunks
+}
+
+func applyChunks(base []string, chunks []chunk, start int, end int) []string {
+	lines := make([]string, 0)
+	pos := start
+	for _, c := range chunks {
+		lines = append(lines, base[pos:c.start]...)
+		lines = append(lines, c.lines...)
+		pos = c.end
+	}
+	return append(lines, base[pos:end]...)
+}
+
+// terminateLines makes sure the last line ends with a newline so that a conflict marker can follow it.
+func terminateLines(lines []string) []string {
+	if len(lines) == 0 || strings.HasSuffix(lines[len(lines)-1], "\n") {
+		return lines
+	}
+	terminated := append([]string{}, lines...)
+	terminated[len(terminated)-1] += "\n"
+	return terminated
+}
@@ -0,0 +1,311 @@
+package diff
+
+import (
+	"bytes"
+	"fmt"
+	"patchy/util"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+type Hunk struct {
+	OldStart int
+	OldLines int
+	NewStart int
+	NewLines int
+	Edits    []LineEdit
+}
+
+// Hunks groups the changes of an edit script into hunks with up to context unchanged lines around each change.
+// Changes separated by no more than twice that many unchanged lines share a hunk.
+func Hunks(edits []LineEdit, context int) []Hunk {
+	hunks := make([]Hunk, 0)
+	for i := 0; i < len(edits); {
+		if edits[i].Op == Equal {
+			i++
+			continue
+		}
+		end := i + 1
+		for j := i; j < len(edits); j++ {
+			if edits[j].Op != Equal {
+				end = j + 1
+			} else if j-end+1 > 2*context {
+				break
+			}
+		}
+		start, stop := max(0, i-context), min(len(edits), end+context)
+		hunks = append(hunks, newHunk(edits[start:stop]))
+		i = stop
+	}
+	return hunks
+}
+
+func newHunk(edits []LineEdit) Hunk {
+	hunk := Hunk{Edits: edits}
+	for _, edit := range edits {
+		if edit.Op != Insert {
+			hunk.OldLines++
+		}
+		if edit.Op != Delete {
+			hunk.NewLines++
+		}
+	}
+	// Like in unified diffs, an empty range starts at the line before it
+	hunk.OldStart, hunk.NewStart = edits[0].OldLine, edits[0].NewLine
+	if hunk.OldLines > 0 {
+		hunk.OldStart++
+	}
+	if hunk.NewLines > 0 {
+		hunk.NewStart++
+	}
+	return hunk
+}
+
+func (h Hunk) Header() string {
+	return fmt.Sprintf("@@ -%s +%s @@", hunkRange(h.OldStart, h.OldLines), hunkRange(h.NewStart, h.NewLines))
+}
+
+// Split splits a hunk into smaller ones at each run of unchanged lines between its changes, which neighbouring parts
+// share as context. A hunk which cannot be split is returned as is.
+func (h Hunk) Split() []Hunk {
+	parts := make([]Hunk, 0)
+	start := 0
+	for i := 0; i < len(h.Edits); {
+		changes := i
+		for changes < len(h.Edits) && h.Edits[changes].Op == Equal {
+			changes++
+		}
+		if changes == len(h.Edits) {
+			break
+		}
+		context := changes
+		for context < len(h.Edits) && h.Edits[context].Op != Equal {
+			context++
+		}
+		end := context
+		for end < len(h.Edits) && h.Edits[end].Op == Equal {
+			end++
+		}
+		parts = append(parts, newHunk(h.Edits[start:end]))
+		start, i = context, end
+	}
+	if len(parts) < 2 {
+		return []Hunk{h}
+	}
+	return parts
+}
+
+// ApplyHunks applies some of the hunks of the diff of oldLines, in order. Unchanged lines shared by neighbouring
+// hunks from Split are only kept once.
+func ApplyHunks(oldLines []string, hunks []Hunk) []string {
+	lines := make([]string, 0, len(oldLines))
+	pos := 0
+	for _, hunk := range hunks {
+		for _, edit := range hunk.Edits {
+			if edit.Op != Insert && edit.OldLine < pos {
+				continue
+			}
+			lines = append(lines, oldLines[pos:max(pos, edit.OldLine)]...)
+			pos = max(pos, edit.OldLine)
+			switch edit.Op {
+			case Equal:
+				lines = append(lines, oldLines[pos])
+				pos++
+			case Insert:
+				lines = append(lines, edit.Text)
+			case Delete:
+				pos++
+			}
+		}
+	}
+	return append(lines, oldLines[pos:]...)
+}
+
+func hunkRange(start int, lines int) string {
+	if lines == 1 {
+		return fmt.Sprint(start)
+	}
+	return fmt.Sprintf("%d,%d", start, lines)
+}
+
+// PrintPatch prints the changes as a unified diff with three lines of context.
+func (d *Differ) PrintPatch(changes []FileChange) error {
+	for _, change := range changes {
+		if err := d.printFilePatch(change); err != nil {
+			return fmt.Errorf("PrintPatch: %w", err)
+		}
+	}
+	return nil
+}
+
+func (d *Differ) printFilePatch(change FileChange) error {
+	oldName, newName := change.OldName, change.NewName
+	if oldName == "" {
+		oldName = newName
+	} else if newName == "" {
+		newName = oldName
+	}
+	util.ColorPrintf(color.Bold, "diff --patchy a/%s b/%s\n", oldName, newName)
+	oldLabel, newLabel := "a/"+oldName, "b/"+newName
+	switch change.ChangeType {
+	case Added:
+		util.ColorPrintln(color.Bold, "new file")
+		oldLabel = "/dev/null"
+	case Deleted:
+		util.ColorPrintln(color.Bold, "deleted file")
+		newLabel = "/dev/null"
+	case Moved:
+		util.ColorPrintf(color.Bold, "rename from %s\nrename to %s\n", oldName, newName)
+		return nil
+	}
+
+	oldData, newData, err := d.readChangeBlobs(change)
+	if err != nil {
+		return err
+	}
+	if isBinary(oldData) || isBinary(newData) {
+		util.Printf("Binary files %s and %s differ\n", oldLabel, newLabel)
+		return nil
+	}
+	util.ColorPrintf(color.Bold, "--- %s\n+++ %s\n", oldLabel, newLabel)
+	for _, hunk := range Hunks(DiffLines(SplitLines(oldData), SplitLines(newData)), 3) {
+		util.ColorPrintln(color.FgCyan, hunk.Header())
+		for _, edit := range hunk.Edits {
+			PrintLineEdit(edit)
+		}
+	}
+	return nil
+}
+
+// PrintLineEdit prints a single line of a hunk with its +, - or space prefix.
+func PrintLineEdit(edit LineEdit) {
+	text := strings.TrimSuffix(edit.Text, "\n")
+	switch edit.Op {
+	case Insert:
+		util.ColorPrintln(color.FgGreen, "+"+text)
+	case Delete:
+		util.ColorPrintln(color.FgRed, "-"+text)
+	default:
+		util.Println(" " + text)
+	}
+	if !strings.HasSuffix(edit.Text, "\n") {
+		util.Println("\\ No newline at end of file")
+	}
+}
+
+// PrintStat prints how many lines were added and removed in each changed file, followed by the totals.
+func (d *Differ) PrintStat(changes []FileChange) error {
+	type fileStat struct {
+		name       string
+		insertions int
+		deletions  int
+		binary     bool
+	}
+	stats := make([]fileStat, 0, len(changes))
+	nameWidth, maxChanged := 0, 0
+	insertions, deletions := 0, 0
+	for _, change := range changes {
+		stat := fileStat{name: change.NewName}
+		switch change.ChangeType {
+		case Deleted:
+			stat.name = change.OldName
+		case Moved:
+			stat.name = change.OldName + " => " + change.NewName
+		}
+		oldData, newData, err := d.readChangeBlobs(change)
+		if err != nil {
+			return fmt.Errorf("PrintStat: %w", err)
+		}
+		if stat.binary = isBinary(oldData) || isBinary(newData); !stat.binary {
+			for _, edit := range DiffLines(SplitLines(oldData), SplitLines(newData)) {
+				switch edit.Op {
+				case Insert:
+					stat.insertions++
+				case Delete:
+					stat.deletions++
+				}
+			}
+		}
+		nameWidth = max(nameWidth, len(stat.name))
+		maxChanged = max(maxChanged, stat.insertions+stat.deletions)
+		insertions += stat.insertions
+		deletions += stat.deletions
+		stats = append(stats, stat)
+	}
+
+	// Scale the graph down so that the largest change fits in 50 columns
+	scale := func(n int) int {
+		if maxChanged <= 50 || n == 0 {
+			return n
+		}
+		return max(1, n*50/maxChanged)
+	}
+	for _, stat := range stats {
+		util.Printf(" %-*s | ", nameWidth, stat.name)
+		if stat.binary {
+			util.Println("Bin")
+			continue
+		}
+		util.Printf("%d ", stat.insertions+stat.deletions)
+		util.ColorPrint(color.FgGreen, strings.Repeat("+", scale(stat.insertions)))
+		util.ColorPrintln(color.FgRed, strings.Repeat("-", scale(stat.deletions)))
+	}
+	summary := fmt.Sprintf(" %d file%s changed", len(stats), plural(len(stats)))
+	if insertions > 0 || deletions == 0 {
+		summary += fmt.Sprintf(", %d insertion%s(+)", insertions, plural(insertions))
+	}
+	if deletions > 0 || insertions == 0 {
+		summary += fmt.Sprintf(", %d deletion%s(-)", deletions, plural(deletions))
+	}
+	util.Println(summary)
+	return nil
+}
+
+// PrintNameStatus prints each changed file preceded by a letter for the kind of change, or just the names of the
+// files with nameOnly.
+func PrintNameStatus(changes []FileChange, nameOnly bool) {
+	for _, change := range changes {
+		switch {
+		case nameOnly && change.ChangeType == Deleted:
+			util.Println(change.OldName)
+		case nameOnly:
+			util.Println(change.NewName)
+		case change.ChangeType == Added:
+			util.Printf("A\t%s\n", change.NewName)
+		case change.ChangeType == Deleted:
+			util.Printf("D\t%s\n", change.OldName)
+		case change.ChangeType == Modified:
+			util.Printf("M\t%s\n", change.NewName)
+		case change.ChangeType == Moved:
+			util.Printf("R\t%s\t%s\n", change.OldName, change.NewName)
+		}
+	}
+}
+
+func (d *Differ) readChangeBlobs(change FileChange) ([]byte, []byte, error) {
+	var oldData, newData []byte
+	var err error
+	if change.OldHash != "" {
+		if oldData, err = d.objects.ReadBlob(change.OldHash); err != nil {
+			return nil, nil, err
+		}
+	}
+	if change.NewHash != "" {
+		if newData, err = d.objects.ReadBlob(change.NewHash); err != nil {
+			return nil, nil, err
+		}
+	}
+	return oldData, newData, nil
+}
+
+func isBinary(data []byte) bool {
+	return bytes.IndexByte(data, 0) != -1
+}
+
+func plural(n int) string {
+	if n == 1 {
+		return ""
+	}
+	return "s"
+}
@@ -0,0 +1,16 @@
+package hooks
+
+import "strconv"
+
+type HookFailed struct {
+	Name     string
+	ExitCode int
+}
+
+func (e *HookFailed) Error() string {
+	return "the " + e.Name + " hook exited with status " + strconv.Itoa(e.ExitCode)
+}
+
+var (
+	ErrHookFailed *HookFailed
+)
@@ -0,0 +1,72 @@
+package hooks
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"patchy/repo"
+	"path/filepath"
+	"strings"
+)
+
+// Names of the hooks which are run, each from an executable file of the same name in the hooks directory of the
+// repository.
+const (
+	PreCommit            = "pre-commit"
+	PrepareCommitMsg     = "prepare-commit-msg"
+	CommitMsg            = "commit-msg"
+	PostCommit           = "post-commit"
+	PostCheckout         = "post-checkout"
+	PrePush              = "pre-push"
+	ReferenceTransaction = "reference-transaction"
+)
+
+// ZeroHash stands for a missing object in the arguments and input of hooks.
+const ZeroHash = "0000000000000000000000000000000000000000"
+
+// OrZeroHash returns hash, or ZeroHash if it is empty.
+func OrZeroHash(hash string) string {
+	if hash == "" {
+		return ZeroHash
+	}
+	return hash
+}
+
+// Run runs a hook of the repository r, or of the default repository if r is nil, with the given arguments and input.
+// Hooks which do not exist or are not executable are skipped. The hook runs in the root of the working tree, or in the
+// repository directory of a bare repository, and everything it prints goes to stderr. A non-zero exit is returned as a
+// HookFailed error.
+func Run(r *repo.Repository, name string, stdin string, args ...string) error {
+	repoDir, err := r.Dir()
+	if err != nil {
+		return fmt.Errorf("Run: %w", err)
+	}
+	path := filepath.Join(repoDir, "hooks", name)
+	if info, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("Run: %w", err)
+	} else if info.IsDir() || info.Mode()&0111 == 0 {
+		return nil
+	}
+
+	dir, err := r.WorkTree()
+	if errors.Is(err, repo.ErrNoWorkTree) {
+		dir = repoDir
+	} else if err != nil {
+		return fmt.Errorf("Run: %w", err)
+	}
+	cmd := exec.Command(path, args...)
+	cmd.Dir = dir
+	cmd.Stdin = strings.NewReader(stdin)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	var exitErr *exec.ExitError
+	if err := cmd.Run(); errors.As(err, &exitErr) {
+		return &HookFailed{name, exitErr.ExitCode()}
+	} else if err != nil {
+		return fmt.Errorf("Run: %w", err)
+	}
+	return nil
+}
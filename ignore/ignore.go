@@ -8,21 +8,36 @@ import (
 	"patchy/util"
 	"path/filepath"
 	"strings"
+	"sync"
 )
 
-var ignorePatterns []string = nil
+// Matcher matches paths against the ignore file of a repository, which is read once on first use.
+type Matcher struct {
+	repo     *repo.Repository
+	lock     sync.Mutex
+	patterns []string
+}
 
-func ReadIgnoreFile() ([]string, error) {
-	if ignorePatterns != nil {
-		return ignorePatterns, nil
+var defaultMatcher = &Matcher{}
+
+func NewMatcher(r *repo.Repository) *Matcher {
+	return &Matcher{repo: r}
+}
+
+func (m *Matcher) ReadIgnoreFile() ([]string, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.patterns != nil {
+		return m.patterns, nil
 	}
 
-	repoRoot, err := repo.FindRepoRoot()
+	repoRoot, err := m.repo.WorkTree()
 	if err != nil {
 		return nil, fmt.Errorf("ReadIgnoreFile: %w", err)
 	}
 
-	patterns := []string{".patchy/", ".git/"}
+	// .patchy is a file rather than a directory in linked working trees
+	patterns := []string{".patchy/", ".patchy", ".git/"}
 	ignoreFileExists, err := util.DoesFileExist(filepath.Join(repoRoot, ".patchyignore"))
 	if err != nil {
 		return nil, fmt.Errorf("ReadIgnoreFile: %w", err)
@@ -47,6 +62,37 @@ func ReadIgnoreFile() ([]string, error) {
 		}
 	}
 
-	ignorePatterns = patterns
+	m.patterns = patterns
 	return patterns, nil
 }
+
+// IsIgnored reports whether a path relative to the repository root matches one of the ignore patterns. Directories
+// are matched with a trailing slash, the same way WriteTree matches them.
+func (m *Matcher) IsIgnored(relPath string, isDir bool) (bool, error) {
+	patterns, err := m.ReadIgnoreFile()
+	if err != nil {
+		return false, fmt.Errorf("IsIgnored: %w", err)
+	}
+	relPath = filepath.ToSlash(relPath)
+	if isDir {
+		relPath += "/"
+	}
+	for _, pattern := range patterns {
+		if matched, err := filepath.Match(pattern, relPath); err == nil && matched {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func DefaultMatcher() *Matcher {
+	return defaultMatcher
+}
+
+func ReadIgnoreFile() ([]string, error) {
+	return defaultMatcher.ReadIgnoreFile()
+}
+
+func IsIgnored(relPath string, isDir bool) (bool, error) {
+	return defaultMatcher.IsIgnored(relPath, isDir)
+}
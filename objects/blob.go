@@ -9,20 +9,42 @@ import (
 	"github.com/fatih/color"
 )
 
-func WriteBlob(filename string) (string, error) {
+func (s *Store) WriteBlob(filename string) (string, error) {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return "", fmt.Errorf("WriteBlob: %w", err)
+	}
+	if info.Size() > StreamThreshold {
+		hash, err := s.writeLargeBlob(filename, info.Size())
+		if err != nil {
+			return "", fmt.Errorf("WriteBlob: %w", err)
+		}
+		return hash, nil
+	}
 	data, err := os.ReadFile(filename)
 	if err != nil {
 		return "", fmt.Errorf("WriteBlob: %w", err)
 	}
-	hash, err := WriteObject(objecttype.Blob, data)
+	hash, err := s.WriteObject(objecttype.Blob, data)
 	if err != nil {
 		return "", fmt.Errorf("WriteBlob: %w", err)
 	}
 	return hash, nil
 }
 
-func ReadBlob(hash string) ([]byte, error) {
-	objType, blob, err := ReadObject(hash)
+func (s *Store) writeLargeBlob(filename string, size int64) (string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	return s.WriteObjectFrom(objecttype.Blob, f, size)
+}
+
+func (s *Store) ReadBlob(hash string) ([]byte, error) {
+	objType, blob, err := s.ReadObject(hash)
 	if err != nil {
 		return nil, fmt.Errorf("ReadBlob: %w", err)
 	}
@@ -33,12 +55,12 @@ func ReadBlob(hash string) ([]byte, error) {
 	return blob, nil
 }
 
-func PrintBlob(hash string) error {
-	data, err := ReadBlob(hash)
+func (s *Store) PrintBlob(hash string) error {
+	data, err := s.ReadBlob(hash)
 	if err != nil {
 		return fmt.Errorf("PrintBlob: %w", err)
 	}
-	util.ColorPrintf(color.FgCyan, "[blob %s]\n", resolveObject(hash))
+	util.ColorPrintf(color.FgCyan, "[blob %s]\n", s.resolveObject(hash))
 	util.Println(string(data))
 	return nil
 }
@@ -0,0 +1,144 @@
+package objects
+
+import (
+	"container/list"
+	"fmt"
+	"math"
+	"patchy/config"
+	"patchy/objects/objecttype"
+	"sync"
+)
+
+// DefaultCacheBudget is the number of bytes of object contents kept in memory unless configured otherwise.
+const DefaultCacheBudget = 64 << 20
+
+// Each entry costs a little more than its contents, so that many tiny objects still count against the budget
+const cacheEntryOverhead = 128
+
+// ObjectCache keeps the contents of recently read objects in memory, evicting the least recently used ones once their
+// total size goes over budget. It is safe for concurrent use.
+type ObjectCache struct {
+	mu      sync.Mutex
+	budget  int
+	used    int
+	entries map[string]*list.Element
+	order   *list.List
+	stats   CacheStats
+}
+
+type CacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+	Entries   int
+	Used      int
+	Budget    int
+}
+
+type cacheEntry struct {
+	hash    string
+	objType objecttype.ObjectType
+	data    []byte
+}
+
+func NewObjectCache(budget int) *ObjectCache {
+	return &ObjectCache{budget: budget, entries: make(map[string]*list.Element), order: list.New()}
+}
+
+// Get looks up an object, counting a hit or a miss and marking it as the most recently used.
+func (c *ObjectCache) Get(hash string) (objecttype.ObjectType, []byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.entries[hash]
+	if !ok {
+		c.stats.Misses++
+		return objecttype.Unknown, nil, false
+	}
+	c.stats.Hits++
+	c.order.MoveToFront(element)
+	entry := element.Value.(*cacheEntry)
+	return entry.objType, entry.data, true
+}
+
+// Peek looks up an object without affecting statistics or eviction order.
+func (c *ObjectCache) Peek(hash string) (objecttype.ObjectType, []byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.entries[hash]
+	if !ok {
+		return objecttype.Unknown, nil, false
+	}
+	entry := element.Value.(*cacheEntry)
+	return entry.objType, entry.data, true
+}
+
+// Add caches an object, evicting others as needed. Objects which would not fit in the budget on their own are not
+// cached at all.
+func (c *ObjectCache) Add(hash string, objType objecttype.ObjectType, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.entries[hash]; ok {
+		c.order.MoveToFront(element)
+		return
+	}
+	if len(data)+cacheEntryOverhead > c.budget {
+		return
+	}
+	c.entries[hash] = c.order.PushFront(&cacheEntry{hash, objType, data})
+	c.used += len(data) + cacheEntryOverhead
+	c.evict()
+}
+
+// SetBudget changes the memory budget, evicting objects right away if it shrinks.
+func (c *ObjectCache) SetBudget(budget int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.budget = budget
+	c.evict()
+}
+
+func (c *ObjectCache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Entries = len(c.entries)
+	stats.Used = c.used
+	stats.Budget = c.budget
+	return stats
+}
+
+func (c *ObjectCache) evict() {
+	for c.used > c.budget && c.order.Len() > 0 {
+		oldest := c.order.Back()
+		entry := oldest.Value.(*cacheEntry)
+		c.order.Remove(oldest)
+		delete(c.entries, entry.hash)
+		c.used -= len(entry.data) + cacheEntryOverhead
+		c.stats.Evictions++
+	}
+}
+
+// CacheBudget reads the memory budget for object caches from core.objectCacheSize, which must be a size in bytes that
+// is not negative.
+func CacheBudget(cfg *config.Config) (int, error) {
+	budget, ok, err := cfg.GetInt("core.objectCacheSize")
+	if err != nil {
+		return 0, fmt.Errorf("CacheBudget: %w", err)
+	} else if !ok {
+		return DefaultCacheBudget, nil
+	}
+	if budget < 0 || budget > math.MaxInt {
+		value, _ := cfg.Get("core.objectCacheSize")
+		return 0, fmt.Errorf("CacheBudget: %w", &config.BadValue{Key: "core.objectCacheSize", Value: value})
+	}
+	return int(budget), nil
+}
+
+// SetCacheBudget changes the memory budget of the cache of the default store.
+func SetCacheBudget(budget int) {
+	defaultStore.cache.SetBudget(budget)
+}
+
+func GetCacheStats() CacheStats {
+	return defaultStore.cache.Stats()
+}
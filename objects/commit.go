@@ -20,69 +20,88 @@ type Commit struct {
 	Parent  *string
 }
 
-func WriteCommit(tree string, parent *string, message string) (string, error) {
-	if err := ResolveAndValidateObject(&tree); err != nil {
-		return "", fmt.Errorf("WriteCommit: bad tree, %w", err)
-	}
-
+func (s *Store) WriteCommit(tree string, parent *string, message string) (string, error) {
 	currentUser, err := user.Current()
 	if err != nil {
 		return "", fmt.Errorf("WriteCommit: %w", err)
 	}
-	author := currentUser.Username
-	currentTime := time.Now()
-	data, err := hex.DecodeString(tree)
+	hash, err := s.WriteCommitWithAuthor(tree, parent, message, currentUser.Username, time.Now())
 	if err != nil {
 		return "", fmt.Errorf("WriteCommit: %w", err)
 	}
-	data = append(data, []byte(fmt.Sprintf("\000%s\000%s\000%d\000", author, message, currentTime.Unix()))...)
+	return hash, nil
+}
+
+// WriteCommitWithAuthor writes a commit attributed to the given author and time rather than the current user, e.g.
+// when a commit is copied onto another branch.
+func (s *Store) WriteCommitWithAuthor(
+	tree string, parent *string, message string, author string, authorTime time.Time) (string, error) {
+	if err := s.ResolveAndValidateObject(&tree); err != nil {
+		return "", fmt.Errorf("WriteCommitWithAuthor: bad tree, %w", err)
+	}
+
+	data, err := hex.DecodeString(tree)
+	if err != nil {
+		return "", fmt.Errorf("WriteCommitWithAuthor: %w", err)
+	}
+	data = append(data, []byte(fmt.Sprintf("\000%s\000%s\000%d\000", author, message, authorTime.Unix()))...)
 	if parent != nil {
-		if objType, err := ReadObjectType(*parent); err == nil && objType != objecttype.Commit {
+		if objType, err := s.ReadObjectType(*parent); err == nil && objType != objecttype.Commit {
 			return "", fmt.Errorf(
-				"WriteCommit: bad parent, %w ",
+				"WriteCommitWithAuthor: bad parent, %w ",
 				&ObjectTypeMismatch{*parent, objecttype.Commit, objType})
 		} else if err != nil {
-			return "", fmt.Errorf("WriteCommit: bad parent, %w", err)
+			return "", fmt.Errorf("WriteCommitWithAuthor: bad parent, %w", err)
 		}
 		rawParentHash, err := hex.DecodeString(*parent)
 		if err != nil {
-			return "", fmt.Errorf("WriteCommit: %w", err)
+			return "", fmt.Errorf("WriteCommitWithAuthor: %w", err)
 		}
 		data = append(data, rawParentHash...)
 	}
-	hash, err := WriteObject(objecttype.Commit, data)
+	hash, err := s.WriteObject(objecttype.Commit, data)
 	if err != nil {
-		return "", fmt.Errorf("WriteCommit: %w", err)
+		return "", fmt.Errorf("WriteCommitWithAuthor: %w", err)
 	}
 	return hash, nil
 }
 
-func ReadCommit(hash string) (*Commit, error) {
-	objType, data, err := ReadObject(hash)
+func (s *Store) ReadCommit(hash string) (*Commit, error) {
+	objType, data, err := s.ReadObject(hash)
 	if err != nil {
 		return nil, fmt.Errorf("ReadCommit: %w", err)
 	}
 	if objType != objecttype.Commit {
 		return nil, fmt.Errorf("ReadCommit: %w", &ObjectTypeMismatch{hash, objecttype.Commit, objType})
 	}
-	i := 0
-	treeHashEnd := -1
-	commit := &Commit{}
-	for ; i < len(data); i++ {
-		if data[i] == 0 {
-			treeHashEnd = i
-			break
-		}
-	}
-	if treeHashEnd == -1 {
-		return nil, fmt.Errorf("ReadCommit: %w", &BadObject{hash, "format"})
+	commit, err := ParseCommit(hash, data)
+	if err != nil {
+		return nil, fmt.Errorf("ReadCommit: %w", err)
 	}
-	treeHash := hex.EncodeToString(data[:treeHashEnd])
-	if err := validateObject(treeHash); err != nil {
+	if err := s.validateObject(commit.Tree); err != nil {
 		return nil, fmt.Errorf("ReadCommit: bad tree, %w", err)
 	}
-	commit.Tree = treeHash
-	i++
+	if commit.Parent != nil {
+		if objType, err := s.ReadObjectType(*commit.Parent); err == nil && objType != objecttype.Commit {
+			return nil, fmt.Errorf(
+				"ReadCommit: bad parent, %w ",
+				&ObjectTypeMismatch{*commit.Parent, objecttype.Commit, objType})
+		} else if err != nil {
+			return nil, fmt.Errorf("ReadCommit: %w", err)
+		}
+	}
+	return commit, nil
+}
+
+func ParseCommit(hash string, data []byte) (*Commit, error) {
+	// The raw tree hash may itself contain null bytes, so it is read by length rather than up to the first separator
+	treeHashEnd := 20
+	commit := &Commit{}
+	if len(data) <= treeHashEnd || data[treeHashEnd] != 0 {
+		return nil, &BadObject{hash, "format"}
+	}
+	commit.Tree = hex.EncodeToString(data[:treeHashEnd])
+	i := treeHashEnd + 1
 
 	authorEnd := -1
 	for ; i < len(data); i++ {
@@ -92,7 +111,7 @@ func ReadCommit(hash string) (*Commit, error) {
 		}
 	}
 	if authorEnd == -1 {
-		return nil, fmt.Errorf("ReadCommit: %w", &BadObject{hash, "format"})
+		return nil, &BadObject{hash, "format"}
 	}
 	commit.Author = string(data[treeHashEnd+1 : authorEnd])
 	i++
@@ -105,7 +124,7 @@ func ReadCommit(hash string) (*Commit, error) {
 		}
 	}
 	if messageEnd == -1 {
-		return nil, fmt.Errorf("ReadCommit: %w", &BadObject{hash, "format"})
+		return nil, &BadObject{hash, "format"}
 	}
 	commit.Message = string(data[authorEnd+1 : messageEnd])
 	i++
@@ -118,11 +137,11 @@ func ReadCommit(hash string) (*Commit, error) {
 		}
 	}
 	if timeEnd == -1 {
-		return nil, fmt.Errorf("ReadCommit: %w", &BadObject{hash, "format"})
+		return nil, &BadObject{hash, "format"}
 	}
 	unixTime, err := strconv.Atoi(string(data[messageEnd+1 : timeEnd]))
 	if err != nil {
-		return nil, fmt.Errorf("ReadCommit: %w", &BadObject{hash, "format"})
+		return nil, &BadObject{hash, "format"}
 	}
 	commit.Time = time.Unix(int64(unixTime), 0)
 	i++
@@ -131,26 +150,19 @@ func ReadCommit(hash string) (*Commit, error) {
 	if i < len(data) {
 		parentHash := hex.EncodeToString(data[timeEnd+1:])
 		if len(parentHash) != 40 {
-			return nil, fmt.Errorf("ReadCommit: bad parent, %w", &BadObjectID{hash})
-		}
-		if objType, err := ReadObjectType(parentHash); err == nil && objType != objecttype.Commit {
-			return nil, fmt.Errorf(
-				"ReadCommit: bad parent, %w ",
-				&ObjectTypeMismatch{parentHash, objecttype.Commit, objType})
-		} else if err != nil {
-			return nil, fmt.Errorf("ReadCommit: %w", err)
+			return nil, &BadObjectID{hash}
 		}
 		commit.Parent = &parentHash
 	}
 	return commit, nil
 }
 
-func PrintCommit(hash string) error {
-	commit, err := ReadCommit(hash)
+func (s *Store) PrintCommit(hash string) error {
+	commit, err := s.ReadCommit(hash)
 	if err != nil {
 		return fmt.Errorf("PrintCommit: %w", err)
 	}
-	util.ColorPrintf(color.FgCyan, "[commit %s]\n", resolveObject(hash))
+	util.ColorPrintf(color.FgCyan, "[commit %s]\n", s.resolveObject(hash))
 	util.Printf("tree %s\n", commit.Tree)
 	if commit.Parent != nil {
 		util.Printf("parent %s\n", *commit.Parent)
@@ -0,0 +1,66 @@
+package objects
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FormatCommit expands the placeholders in format for a commit: %H and %h for its full and abbreviated hash, %T and %t
+// for its tree, %P and %p for its parent, %an for its author, %ad and %at for its date and unix time, %s for its
+// subject, %b for the rest of its message, %B for the whole message, %n for a newline and %% for a percent sign.
+// Anything else is left as is.
+func FormatCommit(hash string, commit *Commit, format string) string {
+	subject, body, _ := strings.Cut(commit.Message, "\n")
+	parent := ""
+	if commit.Parent != nil {
+		parent = *commit.Parent
+	}
+	placeholders := map[string]string{
+		"H":  hash,
+		"h":  abbreviate(hash),
+		"T":  commit.Tree,
+		"t":  abbreviate(commit.Tree),
+		"P":  parent,
+		"p":  abbreviate(parent),
+		"an": commit.Author,
+		"ad": commit.Time.Format(time.RubyDate),
+		"at": strconv.FormatInt(commit.Time.Unix(), 10),
+		"s":  subject,
+		"b":  strings.TrimLeft(body, "\n"),
+		"B":  commit.Message,
+		"n":  "\n",
+		"%":  "%",
+	}
+
+	var builder strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			builder.WriteByte(format[i])
+			continue
+		}
+		expanded := false
+		for _, length := range []int{2, 1} {
+			if i+1+length > len(format) {
+				continue
+			}
+			if value, ok := placeholders[format[i+1:i+1+length]]; ok {
+				builder.WriteString(value)
+				i += length
+				expanded = true
+				break
+			}
+		}
+		if !expanded {
+			builder.WriteByte('%')
+		}
+	}
+	return builder.String()
+}
+
+func abbreviate(hash string) string {
+	if len(hash) > 7 {
+		return hash[:7]
+	}
+	return hash
+}
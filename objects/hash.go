@@ -0,0 +1,81 @@
+package objects
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"os"
+	"patchy/objects/objecttype"
+	"strings"
+)
+
+// HashObject computes the hash of an object of the given type from its contents in reader, without holding them in
+// memory. The size goes into the object header, so it must be known up front and reader must hold exactly that much.
+func HashObject(objType objecttype.ObjectType, reader io.Reader, size int64) (string, error) {
+	hasher := sha1.New()
+	hasher.Write(objectHeader(objType, size))
+	copied, err := io.Copy(hasher, io.LimitReader(reader, size+1))
+	if err != nil {
+		return "", fmt.Errorf("HashObject: %w", err)
+	}
+	if copied != size {
+		return "", fmt.Errorf("HashObject: expected %d bytes of content, read %d", size, copied)
+	}
+	return fmt.Sprintf("%x", hasher.Sum(nil)), nil
+}
+
+// HashFile computes the hash a blob with the contents of a file would have, streaming the file rather than reading it
+// into memory, so that it can be compared with a tracked blob by hash.
+func HashFile(filename string) (string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", fmt.Errorf("HashFile: %w", err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	info, err := f.Stat()
+	if err != nil {
+		return "", fmt.Errorf("HashFile: %w", err)
+	}
+	hash, err := HashObject(objecttype.Blob, f, info.Size())
+	if err != nil {
+		return "", fmt.Errorf("HashFile: %w", err)
+	}
+	return hash, nil
+}
+
+// ValidateObject checks that data is well formed as the contents of an object of the given type.
+func ValidateObject(objType objecttype.ObjectType, data []byte) error {
+	hash := computeHash(append(objectHeader(objType, int64(len(data))), data...))
+	switch objType {
+	case objecttype.Blob:
+	case objecttype.Tree:
+		entries, err := ParseTree(hash, data)
+		if err != nil {
+			return fmt.Errorf("ValidateObject: %w", err)
+		}
+		for _, entry := range entries {
+			if entry.Mode != "040000" && entry.Mode != "100644" {
+				return fmt.Errorf("ValidateObject: %w", &BadObject{hash, "tree entry mode " + entry.Mode})
+			}
+			// Names are joined onto paths in the working tree, so they must not lead out of their directory or into
+			// the repository directory
+			if entry.Name == "" || entry.Name == "." || entry.Name == ".." || entry.Name == ".patchy" ||
+				strings.ContainsAny(entry.Name, "/\\\x00") {
+				return fmt.Errorf("ValidateObject: %w", &BadObject{hash, "tree entry name '" + entry.Name + "'"})
+			}
+		}
+	case objecttype.Commit:
+		if _, err := ParseCommit(hash, data); err != nil {
+			return fmt.Errorf("ValidateObject: %w", err)
+		}
+	default:
+		return fmt.Errorf("ValidateObject: %w", &BadObject{hash, "type"})
+	}
+	return nil
+}
+
+func objectHeader(objType objecttype.ObjectType, size int64) []byte {
+	return []byte(fmt.Sprintf("%s %d\000", objType.String(), size))
+}
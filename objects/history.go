@@ -0,0 +1,110 @@
+package objects
+
+import (
+	"fmt"
+	"patchy/objects/objecttype"
+)
+
+func (s *Store) IsAncestor(ancestor string, descendant string) (bool, error) {
+	hash := descendant
+	for {
+		if hash == ancestor {
+			return true, nil
+		}
+		commit, err := s.ReadCommit(hash)
+		if err != nil {
+			return false, fmt.Errorf("IsAncestor: %w", err)
+		}
+		if commit.Parent == nil {
+			return false, nil
+		}
+		hash = *commit.Parent
+	}
+}
+
+func IsAncestorAt(repoDir string, ancestor string, descendant string) (bool, error) {
+	hash := descendant
+	for {
+		if hash == ancestor {
+			return true, nil
+		}
+		objType, data, err := ReadObjectAt(repoDir, hash)
+		if err != nil {
+			return false, fmt.Errorf("IsAncestorAt: %w", err)
+		}
+		if objType != objecttype.Commit {
+			return false, fmt.Errorf("IsAncestorAt: %w", &ObjectTypeMismatch{hash, objecttype.Commit, objType})
+		}
+		commit, err := ParseCommit(hash, data)
+		if err != nil {
+			return false, fmt.Errorf("IsAncestorAt: %w", err)
+		}
+		if commit.Parent == nil {
+			return false, nil
+		}
+		hash = *commit.Parent
+	}
+}
+
+// CountDivergence counts the commits reachable from a but not from b (ahead) and from b but not from a (behind).
+func (s *Store) CountDivergence(a string, b string) (int, int, error) {
+	base, err := s.MergeBase(a, b)
+	if err != nil {
+		return 0, 0, fmt.Errorf("CountDivergence: %w", err)
+	}
+	ahead, err := s.countCommitsUntil(a, base)
+	if err != nil {
+		return 0, 0, fmt.Errorf("CountDivergence: %w", err)
+	}
+	behind, err := s.countCommitsUntil(b, base)
+	if err != nil {
+		return 0, 0, fmt.Errorf("CountDivergence: %w", err)
+	}
+	return ahead, behind, nil
+}
+
+// MergeBase finds the most recent commit that is an ancestor of both a and b, or an empty string if their histories
+// are unrelated.
+func (s *Store) MergeBase(a string, b string) (string, error) {
+	ancestorsOfA := make(map[string]bool)
+	for hash := a; hash != ""; {
+		ancestorsOfA[hash] = true
+		commit, err := s.ReadCommit(hash)
+		if err != nil {
+			return "", fmt.Errorf("MergeBase: %w", err)
+		}
+		hash = ""
+		if commit.Parent != nil {
+			hash = *commit.Parent
+		}
+	}
+	for hash := b; hash != ""; {
+		if ancestorsOfA[hash] {
+			return hash, nil
+		}
+		commit, err := s.ReadCommit(hash)
+		if err != nil {
+			return "", fmt.Errorf("MergeBase: %w", err)
+		}
+		hash = ""
+		if commit.Parent != nil {
+			hash = *commit.Parent
+		}
+	}
+	return "", nil
+}
+
+func (s *Store) countCommitsUntil(from string, until string) (int, error) {
+	count := 0
+	for hash := from; hash != until; count++ {
+		commit, err := s.ReadCommit(hash)
+		if err != nil {
+			return 0, err
+		}
+		if commit.Parent == nil {
+			return count + 1, nil
+		}
+		hash = *commit.Parent
+	}
+	return count, nil
+}
@@ -4,27 +4,23 @@ import (
 	"bytes"
 	"compress/zlib"
 	"crypto/sha1"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"patchy/objects/objecttype"
-	"patchy/repo"
 	"patchy/util"
 	"path/filepath"
 	"strconv"
 	"strings"
 )
 
-var objCache = make(map[string][]byte)
-var objTypeCache = make(map[string]objecttype.ObjectType)
-
-func objectExists(hash string) bool {
-	repoDir, err := repo.FindRepoDir()
+func (s *Store) HasObject(hash string) bool {
+	repoDir, err := s.repo.Dir()
 	if err != nil {
 		return false
 	}
-	exists, err := util.DoesFileExist(filepath.Join(repoDir, "objects", hash[:2], hash[2:]))
-	return exists && err == nil
+	return HasObjectAt(repoDir, hash)
 }
 
 func compressObject(object []byte) ([]byte, error) {
@@ -57,17 +53,15 @@ func computeHash(data []byte) string {
 	return fmt.Sprintf("%x", sha1.Sum(data))
 }
 
-func WriteObject(objType objecttype.ObjectType, data []byte) (string, error) {
-	repoDir, err := repo.FindRepoDir()
+func (s *Store) WriteObject(objType objecttype.ObjectType, data []byte) (string, error) {
+	repoDir, err := s.repo.Dir()
 	if err != nil {
 		return "", fmt.Errorf("WriteObject: %w", err)
 	}
-	header := []byte(fmt.Sprintf("%s %d\000", objType.String(), len(data)))
-	contents := append(header, data...)
+	contents := append(objectHeader(objType, int64(len(data))), data...)
 	hash := computeHash(contents)
-	if objectExists(hash) {
-		objCache[hash] = data
-		objTypeCache[hash] = objType
+	if s.HasObject(hash) {
+		s.cacheObject(hash, objType, data)
 		return hash, nil
 	}
 
@@ -84,86 +78,85 @@ func WriteObject(objType objecttype.ObjectType, data []byte) (string, error) {
 		return "", fmt.Errorf("WriteObject: %w", err)
 	}
 
-	objCache[hash] = data
-	objTypeCache[hash] = objType
+	s.cacheObject(hash, objType, data)
 	return hash, nil
 }
 
-func ReadObjectType(hash string) (objecttype.ObjectType, error) {
-	repoDir, err := repo.FindRepoDir()
+func (s *Store) ReadObjectType(hash string) (objecttype.ObjectType, error) {
+	objType, _, err := s.ReadObjectHeader(hash)
 	if err != nil {
 		return objecttype.Unknown, fmt.Errorf("ReadObjectType: %w", err)
 	}
-	if err := ResolveAndValidateObject(&hash); err != nil {
-		return objecttype.Unknown, fmt.Errorf("ReadObjectType: %w", err)
-	}
+	return objType, nil
+}
 
-	dir := filepath.Join(repoDir, "objects", hash[:2])
-	file := filepath.Join(dir, hash[2:])
-	compressedData, err := os.ReadFile(file)
+// ReadObjectHeader reads the type and size of an object, only inflating as much of it as is needed to read its header.
+func (s *Store) ReadObjectHeader(hash string) (objecttype.ObjectType, int, error) {
+	repoDir, err := s.repo.Dir()
 	if err != nil {
-		return objecttype.Unknown, fmt.Errorf("ReadObjectType: %w", err)
+		return objecttype.Unknown, 0, fmt.Errorf("ReadObjectHeader: %w", err)
 	}
-
-	reader, err := zlib.NewReader(bytes.NewReader(compressedData))
-	if err != nil {
-		return objecttype.Unknown, fmt.Errorf("ReadObjectType: %w", err)
+	if err := s.ResolveAndValidateObject(&hash); err != nil {
+		return objecttype.Unknown, 0, fmt.Errorf("ReadObjectHeader: %w", err)
 	}
-	defer func() {
-		_ = reader.Close()
-	}()
-	headerBytes := make([]byte, 0)
-	buf := make([]byte, 1)
-	n, err := reader.Read(buf)
-	for buf[0] != 0 {
-		if n != 1 || err != nil {
-			return objecttype.Unknown, fmt.Errorf(
-				"ReadObjectType: %w", &BadObject{hash, "format"})
-		}
-		headerBytes = append(headerBytes, buf[0])
-		n, err = reader.Read(buf)
+	if objType, data, ok := s.cache.Peek(hash); ok {
+		return objType, len(data), nil
 	}
-	header := strings.Split(string(headerBytes), " ")
-	if len(header) != 2 {
-		return objecttype.Unknown, fmt.Errorf(
-			"ReadObjectType: %w", &BadObject{hash, "header"})
+	objType, size, err := readObjectHeaderAt(repoDir, hash)
+	if err != nil {
+		return objecttype.Unknown, 0, fmt.Errorf("ReadObjectHeader: %w", err)
 	}
+	return objType, size, nil
+}
 
-	switch header[0] {
-	case "blob":
-		return objecttype.Blob, nil
-	case "tree":
-		return objecttype.Tree, nil
-	case "commit":
-		return objecttype.Commit, nil
-	default:
-		return objecttype.Unknown, fmt.Errorf(
-			"ReadObjectType: %w", &BadObject{hash, "type"})
+func readObjectHeaderAt(repoDir string, hash string) (objecttype.ObjectType, int, error) {
+	reader, err := openObjectAt(repoDir, hash)
+	if err != nil {
+		return objecttype.Unknown, 0, err
 	}
+	_ = reader.Close()
+	return reader.Type, int(reader.Size), nil
 }
 
-func ReadObject(hash string) (objecttype.ObjectType, []byte, error) {
-	repoDir, err := repo.FindRepoDir()
+func (s *Store) ReadObject(hash string) (objecttype.ObjectType, []byte, error) {
+	repoDir, err := s.repo.Dir()
 	if err != nil {
 		return objecttype.Unknown, nil, fmt.Errorf("ReadObject: %w", err)
 	}
-	if err := ResolveAndValidateObject(&hash); err != nil {
+	if err := s.ResolveAndValidateObject(&hash); err != nil {
 		return objecttype.Unknown, nil, fmt.Errorf("ReadObject: %w", err)
 	}
-	if data, ok := objCache[hash]; ok {
-		return objTypeCache[hash], data, nil
+	if objType, data, ok := s.cache.Get(hash); ok {
+		return objType, data, nil
 	}
 
-	dir := filepath.Join(repoDir, "objects", hash[:2])
-	file := filepath.Join(dir, hash[2:])
-	compressedData, err := os.ReadFile(file)
+	objType, content, err := ReadObjectAt(repoDir, hash)
 	if err != nil {
 		return objecttype.Unknown, nil, fmt.Errorf("ReadObject: %w", err)
 	}
+	s.cacheObject(hash, objType, content)
+	return objType, content, nil
+}
+
+// cacheObject remembers the contents of an object, unless it is large enough that it should be streamed instead.
+func (s *Store) cacheObject(hash string, objType objecttype.ObjectType, data []byte) {
+	if len(data) > StreamThreshold {
+		return
+	}
+	s.cache.Add(hash, objType, data)
+}
+
+func ReadObjectAt(repoDir string, hash string) (objecttype.ObjectType, []byte, error) {
+	compressedData, err := os.ReadFile(objectPath(repoDir, hash))
+	if errors.Is(err, os.ErrNotExist) {
+		return objecttype.Unknown, nil, &ObjectNotFound{hash}
+	} else if err != nil {
+		return objecttype.Unknown, nil, err
+	}
 
 	blob, err := decompressObject(compressedData)
 	if err != nil {
-		return objecttype.Unknown, nil, fmt.Errorf("ReadObject: %w", err)
+		return objecttype.Unknown, nil, err
 	}
 
 	nullPos := -1
@@ -174,35 +167,51 @@ func ReadObject(hash string) (objecttype.ObjectType, []byte, error) {
 		}
 	}
 	if nullPos <= 0 {
-		return objecttype.Unknown, nil, fmt.Errorf(
-			"ReadObjectType: %w", &BadObject{hash, "format"})
+		return objecttype.Unknown, nil, &BadObject{hash, "format"}
 	}
 	header := strings.Split(string(blob[:nullPos]), " ")
 	content := blob[nullPos+1:]
 
 	if len(header) != 2 {
-		return objecttype.Unknown, nil, fmt.Errorf(
-			"ReadObjectType: %w", &BadObject{hash, "header"})
+		return objecttype.Unknown, nil, &BadObject{hash, "header"}
 	}
 	length, err := strconv.Atoi(header[1])
 	if err != nil || length != len(content) {
-		return objecttype.Unknown, nil, fmt.Errorf(
-			"ReadObjectType: %w", &BadObject{hash, "header"})
-	}
-
-	var objType objecttype.ObjectType
-	switch header[0] {
-	case "blob":
-		objType = objecttype.Blob
-	case "tree":
-		objType = objecttype.Tree
-	case "commit":
-		objType = objecttype.Commit
-	default:
-		return objecttype.Unknown, nil, fmt.Errorf(
-			"ReadObjectType: %w", &BadObject{hash, "type"})
-	}
-	objCache[hash] = content
-	objTypeCache[hash] = objType
+		return objecttype.Unknown, nil, &BadObject{hash, "header"}
+	}
+
+	objType := objecttype.Parse(header[0])
+	if objType == objecttype.Unknown {
+		return objecttype.Unknown, nil, &BadObject{hash, "type"}
+	}
 	return objType, content, nil
 }
+
+func HasObjectAt(repoDir string, hash string) bool {
+	exists, err := util.DoesFileExist(objectPath(repoDir, hash))
+	return exists && err == nil
+}
+
+func CopyObject(srcRepoDir string, dstRepoDir string, hash string) error {
+	if HasObjectAt(dstRepoDir, hash) {
+		return nil
+	}
+	data, err := os.ReadFile(objectPath(srcRepoDir, hash))
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("CopyObject: %w", &ObjectNotFound{hash})
+	} else if err != nil {
+		return fmt.Errorf("CopyObject: %w", err)
+	}
+	file := objectPath(dstRepoDir, hash)
+	if err := os.MkdirAll(filepath.Dir(file), os.ModePerm); err != nil {
+		return fmt.Errorf("CopyObject: %w", err)
+	}
+	if err := os.WriteFile(file, data, 0666); err != nil {
+		return fmt.Errorf("CopyObject: %w", err)
+	}
+	return nil
+}
+
+func objectPath(repoDir string, hash string) string {
+	return filepath.Join(repoDir, "objects", hash[:2], hash[2:])
+}
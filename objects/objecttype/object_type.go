@@ -21,3 +21,16 @@ func (objType ObjectType) String() string {
 		return "unknown"
 	}
 }
+
+func Parse(name string) ObjectType {
+	switch name {
+	case "blob":
+		return Blob
+	case "tree":
+		return Tree
+	case "commit":
+		return Commit
+	default:
+		return Unknown
+	}
+}
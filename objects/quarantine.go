@@ -0,0 +1,69 @@
+package objects
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"patchy/objects/objecttype"
+	"path/filepath"
+)
+
+// Quarantine holds objects received from another repository apart from the store, so that they only become part of it
+// once the whole transfer has been checked, and a failed one leaves nothing behind.
+type Quarantine struct {
+	repoDir string
+	dir     string
+	hashes  []string
+}
+
+// NewQuarantine creates an empty quarantine inside the objects directory of the store, so that its objects can be
+// moved into place without copying them.
+func (s *Store) NewQuarantine() (*Quarantine, error) {
+	repoDir, err := s.repo.Dir()
+	if err != nil {
+		return nil, fmt.Errorf("NewQuarantine: %w", err)
+	}
+	dir, err := os.MkdirTemp(filepath.Join(repoDir, "objects"), "tmp_quarantine_")
+	if err != nil {
+		return nil, fmt.Errorf("NewQuarantine: %w", err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "objects"), os.ModePerm); err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, fmt.Errorf("NewQuarantine: %w", err)
+	}
+	return &Quarantine{repoDir: repoDir, dir: dir}, nil
+}
+
+func (q *Quarantine) WriteObject(objType objecttype.ObjectType, data []byte) (string, error) {
+	hash, err := writeObjectFromAt(q.dir, objType, bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", fmt.Errorf("WriteObject: %w", err)
+	}
+	q.hashes = append(q.hashes, hash)
+	return hash, nil
+}
+
+// Commit moves the objects of the quarantine into the store and removes the quarantine.
+func (q *Quarantine) Commit() error {
+	for _, hash := range q.hashes {
+		if HasObjectAt(q.repoDir, hash) {
+			continue
+		}
+		file := objectPath(q.repoDir, hash)
+		if err := os.MkdirAll(filepath.Dir(file), os.ModePerm); err != nil {
+			return fmt.Errorf("Commit: %w", err)
+		}
+		if err := os.Rename(objectPath(q.dir, hash), file); err != nil {
+			return fmt.Errorf("Commit: %w", err)
+		}
+	}
+	return q.Discard()
+}
+
+// Discard removes the quarantine along with any objects still in it.
+func (q *Quarantine) Discard() error {
+	if err := os.RemoveAll(q.dir); err != nil {
+		return fmt.Errorf("Discard: %w", err)
+	}
+	return nil
+}
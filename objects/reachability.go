@@ -0,0 +1,92 @@
+package objects
+
+import (
+	"fmt"
+	"patchy/objects/objecttype"
+)
+
+// ReachableObjects lists every object reachable from the given commits in the repository at repoDir, stopping at
+// objects for which exclude returns true. Objects are ordered so that everything an object refers to comes before it.
+func ReachableObjects(repoDir string, tips []string, exclude func(hash string) bool) ([]string, error) {
+	walker := &reachabilityWalker{repoDir, exclude, make(map[string]bool), make([]string, 0)}
+	for _, tip := range tips {
+		if err := walker.walkCommits(tip); err != nil {
+			return nil, fmt.Errorf("ReachableObjects: %w", err)
+		}
+	}
+	return walker.objects, nil
+}
+
+type reachabilityWalker struct {
+	repoDir string
+	exclude func(hash string) bool
+	seen    map[string]bool
+	objects []string
+}
+
+func (w *reachabilityWalker) skip(hash string) bool {
+	return w.seen[hash] || (w.exclude != nil && w.exclude(hash))
+}
+
+func (w *reachabilityWalker) walkCommits(tip string) error {
+	chain := make([]string, 0)
+	trees := make([]string, 0)
+	hash := tip
+	for hash != "" && !w.skip(hash) {
+		w.seen[hash] = true
+		objType, data, err := ReadObjectAt(w.repoDir, hash)
+		if err != nil {
+			return err
+		}
+		if objType != objecttype.Commit {
+			return &ObjectTypeMismatch{hash, objecttype.Commit, objType}
+		}
+		commit, err := ParseCommit(hash, data)
+		if err != nil {
+			return err
+		}
+		chain = append(chain, hash)
+		trees = append(trees, commit.Tree)
+		hash = ""
+		if commit.Parent != nil {
+			hash = *commit.Parent
+		}
+	}
+	for i := len(chain) - 1; i >= 0; i-- {
+		if err := w.walkTree(trees[i]); err != nil {
+			return err
+		}
+		w.objects = append(w.objects, chain[i])
+	}
+	return nil
+}
+
+func (w *reachabilityWalker) walkTree(hash string) error {
+	if w.skip(hash) {
+		return nil
+	}
+	w.seen[hash] = true
+	objType, data, err := ReadObjectAt(w.repoDir, hash)
+	if err != nil {
+		return err
+	}
+	if objType != objecttype.Tree {
+		return &ObjectTypeMismatch{hash, objecttype.Tree, objType}
+	}
+	entries, err := ParseTree(hash, data)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.Mode == "040000" {
+			if err := w.walkTree(entry.Hash); err != nil {
+				return err
+			}
+		} else if !w.skip(entry.Hash) {
+			w.seen[entry.Hash] = true
+			w.objects = append(w.objects, entry.Hash)
+		}
+	}
+	w.objects = append(w.objects, hash)
+	return nil
+}
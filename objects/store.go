@@ -0,0 +1,146 @@
+package objects
+
+import (
+	"io"
+	"patchy/config"
+	"patchy/ignore"
+	"patchy/objects/objecttype"
+	"patchy/repo"
+	"time"
+)
+
+// Store reads and writes the objects of a repository, caching recently read ones.
+type Store struct {
+	repo   *repo.Repository
+	ignore *ignore.Matcher
+	cache  *ObjectCache
+}
+
+var defaultStore = &Store{ignore: ignore.DefaultMatcher(), cache: NewObjectCache(DefaultCacheBudget)}
+
+// NewStore creates the store of a repository, with a cache of the size configured for it. The default size is used if
+// the config cannot be read or the size is invalid, which commands report when they load the config themselves.
+func NewStore(r *repo.Repository, matcher *ignore.Matcher) *Store {
+	budget := DefaultCacheBudget
+	if cfg, err := config.LoadRepo(r); err == nil {
+		if configured, err := CacheBudget(cfg); err == nil {
+			budget = configured
+		}
+	}
+	return &Store{repo: r, ignore: matcher, cache: NewObjectCache(budget)}
+}
+
+// DefaultStore returns the store of the repository found from the working directory, which the package level
+// functions use.
+func DefaultStore() *Store {
+	return defaultStore
+}
+
+func (s *Store) Cache() *ObjectCache {
+	return s.cache
+}
+
+func WriteBlob(filename string) (string, error) {
+	return defaultStore.WriteBlob(filename)
+}
+
+func ReadBlob(hash string) ([]byte, error) {
+	return defaultStore.ReadBlob(hash)
+}
+
+func PrintBlob(hash string) error {
+	return defaultStore.PrintBlob(hash)
+}
+
+func WriteCommit(tree string, parent *string, message string) (string, error) {
+	return defaultStore.WriteCommit(tree, parent, message)
+}
+
+func WriteCommitWithAuthor(
+	tree string, parent *string, message string, author string, authorTime time.Time) (string, error) {
+	return defaultStore.WriteCommitWithAuthor(tree, parent, message, author, authorTime)
+}
+
+func ReadCommit(hash string) (*Commit, error) {
+	return defaultStore.ReadCommit(hash)
+}
+
+func PrintCommit(hash string) error {
+	return defaultStore.PrintCommit(hash)
+}
+
+func IsAncestor(ancestor string, descendant string) (bool, error) {
+	return defaultStore.IsAncestor(ancestor, descendant)
+}
+
+func CountDivergence(a string, b string) (int, int, error) {
+	return defaultStore.CountDivergence(a, b)
+}
+
+func MergeBase(a string, b string) (string, error) {
+	return defaultStore.MergeBase(a, b)
+}
+
+func HasObject(hash string) bool {
+	return defaultStore.HasObject(hash)
+}
+
+func WriteObject(objType objecttype.ObjectType, data []byte) (string, error) {
+	return defaultStore.WriteObject(objType, data)
+}
+
+func ReadObjectType(hash string) (objecttype.ObjectType, error) {
+	return defaultStore.ReadObjectType(hash)
+}
+
+func ReadObjectHeader(hash string) (objecttype.ObjectType, int, error) {
+	return defaultStore.ReadObjectHeader(hash)
+}
+
+func ReadObject(hash string) (objecttype.ObjectType, []byte, error) {
+	return defaultStore.ReadObject(hash)
+}
+
+func OpenObject(hash string) (*ObjectReader, error) {
+	return defaultStore.OpenObject(hash)
+}
+
+func WriteObjectFrom(objType objecttype.ObjectType, reader io.Reader, size int64) (string, error) {
+	return defaultStore.WriteObjectFrom(objType, reader, size)
+}
+
+func CheckoutBlob(hash string, file string) error {
+	return defaultStore.CheckoutBlob(hash, file)
+}
+
+func WriteTree(path string) (string, error) {
+	return defaultStore.WriteTree(path)
+}
+
+func BuildTree(entries []TreeEntry) (string, error) {
+	return defaultStore.BuildTree(entries)
+}
+
+func ReadTree(hash string) ([]TreeEntry, error) {
+	return defaultStore.ReadTree(hash)
+}
+
+func ReadTreeRecursive(hash string) ([]TreeEntry, error) {
+	return defaultStore.ReadTreeRecursive(hash)
+}
+
+func PrintTree(hash string) error {
+	return defaultStore.PrintTree(hash)
+}
+
+func UnpackTree(hash string, path string) error {
+	return defaultStore.UnpackTree(hash, path)
+}
+
+func CheckoutTree(fromTree string, toTree string, path string) error {
+	return defaultStore.CheckoutTree(fromTree, toTree, path)
+}
+
+func ResolveAndValidateObject(shortHash *string) error {
+	return defaultStore.ResolveAndValidateObject(shortHash)
+}
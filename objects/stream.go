@@ -0,0 +1,231 @@
+package objects
+
+import (
+	"bufio"
+	"compress/zlib"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"patchy/objects/objecttype"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// StreamThreshold is the size above which blobs are streamed to and from the object database instead of being held in
+// memory and cached.
+const StreamThreshold = 8 << 20
+
+// ObjectReader reads the contents of an object straight from the object database as they are inflated.
+type ObjectReader struct {
+	Type    objecttype.ObjectType
+	Size    int64
+	hash    string
+	read    int64
+	file    *os.File
+	inflate io.ReadCloser
+	content io.Reader
+}
+
+func (r *ObjectReader) Read(p []byte) (int, error) {
+	n, err := r.content.Read(p)
+	r.read += int64(n)
+	if errors.Is(err, io.EOF) && r.read != r.Size {
+		return n, &BadObject{r.hash, "header"}
+	}
+	return n, err
+}
+
+func (r *ObjectReader) Close() error {
+	inflateErr := r.inflate.Close()
+	if err := r.file.Close(); err != nil {
+		return err
+	}
+	return inflateErr
+}
+
+// OpenObject opens an object for reading without loading its contents. The reader must be closed once done with.
+func (s *Store) OpenObject(hash string) (*ObjectReader, error) {
+	repoDir, err := s.repo.Dir()
+	if err != nil {
+		return nil, fmt.Errorf("OpenObject: %w", err)
+	}
+	if err := s.ResolveAndValidateObject(&hash); err != nil {
+		return nil, fmt.Errorf("OpenObject: %w", err)
+	}
+	reader, err := openObjectAt(repoDir, hash)
+	if err != nil {
+		return nil, fmt.Errorf("OpenObject: %w", err)
+	}
+	return reader, nil
+}
+
+func openObjectAt(repoDir string, hash string) (*ObjectReader, error) {
+	f, err := os.Open(objectPath(repoDir, hash))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, &ObjectNotFound{hash}
+	} else if err != nil {
+		return nil, err
+	}
+	inflate, err := zlib.NewReader(bufio.NewReader(f))
+	if err != nil {
+		_ = f.Close()
+		return nil, &BadObject{hash, "format"}
+	}
+	reader := &ObjectReader{hash: hash, file: f, inflate: inflate}
+	if err := reader.readHeader(); err != nil {
+		_ = reader.Close()
+		return nil, err
+	}
+	reader.content = io.LimitReader(inflate, reader.Size)
+	return reader, nil
+}
+
+func (r *ObjectReader) readHeader() error {
+	headerBytes := make([]byte, 0, 16)
+	buf := make([]byte, 1)
+	for {
+		if _, err := io.ReadFull(r.inflate, buf); err != nil {
+			return &BadObject{r.hash, "format"}
+		}
+		if buf[0] == 0 {
+			break
+		}
+		headerBytes = append(headerBytes, buf[0])
+	}
+	header := strings.Split(string(headerBytes), " ")
+	if len(header) != 2 {
+		return &BadObject{r.hash, "header"}
+	}
+	size, err := strconv.ParseInt(header[1], 10, 64)
+	if err != nil || size < 0 {
+		return &BadObject{r.hash, "header"}
+	}
+	r.Type = objecttype.Parse(header[0])
+	if r.Type == objecttype.Unknown {
+		return &BadObject{r.hash, "type"}
+	}
+	r.Size = size
+	return nil
+}
+
+// WriteObjectFrom writes an object whose contents are read from reader, hashing and compressing them in a single pass
+// into a temporary file which is then moved into place. As with HashObject, reader must hold exactly size bytes.
+func (s *Store) WriteObjectFrom(objType objecttype.ObjectType, reader io.Reader, size int64) (string, error) {
+	repoDir, err := s.repo.Dir()
+	if err != nil {
+		return "", fmt.Errorf("WriteObjectFrom: %w", err)
+	}
+	hash, err := writeObjectFromAt(repoDir, objType, reader, size)
+	if err != nil {
+		return "", fmt.Errorf("WriteObjectFrom: %w", err)
+	}
+	return hash, nil
+}
+
+func writeObjectFromAt(repoDir string, objType objecttype.ObjectType, reader io.Reader, size int64) (string, error) {
+	temp, err := os.CreateTemp(filepath.Join(repoDir, "objects"), "tmp_obj_")
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = temp.Close()
+		_ = os.Remove(temp.Name())
+	}()
+
+	hasher := sha1.New()
+	buffered := bufio.NewWriter(temp)
+	deflate := zlib.NewWriter(buffered)
+	writer := io.MultiWriter(hasher, deflate)
+	if _, err := writer.Write(objectHeader(objType, size)); err != nil {
+		return "", err
+	}
+	copied, err := io.Copy(writer, io.LimitReader(reader, size+1))
+	if err != nil {
+		return "", err
+	}
+	if copied != size {
+		return "", fmt.Errorf("expected %d bytes of content, read %d", size, copied)
+	}
+	if err := deflate.Close(); err != nil {
+		return "", err
+	}
+	if err := buffered.Flush(); err != nil {
+		return "", err
+	}
+	if err := temp.Close(); err != nil {
+		return "", err
+	}
+
+	hash := fmt.Sprintf("%x", hasher.Sum(nil))
+	if HasObjectAt(repoDir, hash) {
+		return hash, nil
+	}
+	file := objectPath(repoDir, hash)
+	if err := os.MkdirAll(filepath.Dir(file), os.ModePerm); err != nil {
+		return "", err
+	}
+	if err := os.Rename(temp.Name(), file); err != nil {
+		return "", err
+	}
+	return hash, nil
+}
+
+// CheckoutBlob writes the contents of a blob to file, creating its directory if needed. Blobs larger than
+// StreamThreshold are streamed into a temporary file next to it which then replaces it.
+func (s *Store) CheckoutBlob(hash string, file string) error {
+	if err := os.MkdirAll(filepath.Dir(file), os.ModePerm); err != nil {
+		return fmt.Errorf("CheckoutBlob: %w", err)
+	}
+	objType, size, err := s.ReadObjectHeader(hash)
+	if err != nil {
+		return fmt.Errorf("CheckoutBlob: %w", err)
+	}
+	if objType != objecttype.Blob {
+		return fmt.Errorf("CheckoutBlob: %w", &ObjectTypeMismatch{hash, objecttype.Blob, objType})
+	}
+	if size <= StreamThreshold {
+		blob, err := s.ReadBlob(hash)
+		if err != nil {
+			return fmt.Errorf("CheckoutBlob: %w", err)
+		}
+		if err := os.WriteFile(file, blob, 0644); err != nil {
+			return fmt.Errorf("CheckoutBlob: %w", err)
+		}
+		return nil
+	}
+	if err := s.streamBlobToFile(hash, file); err != nil {
+		return fmt.Errorf("CheckoutBlob: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) streamBlobToFile(hash string, file string) error {
+	reader, err := s.OpenObject(hash)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+	temp, err := os.CreateTemp(filepath.Dir(file), "."+filepath.Base(file)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = temp.Close()
+		_ = os.Remove(temp.Name())
+	}()
+	if _, err := io.Copy(temp, reader); err != nil {
+		return err
+	}
+	if err := temp.Chmod(0644); err != nil {
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), file)
+}
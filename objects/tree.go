@@ -2,13 +2,14 @@ package objects
 
 import (
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"os"
-	"patchy/ignore"
 	"patchy/objects/objecttype"
-	"patchy/repo"
 	"patchy/util"
 	"path/filepath"
+	"sort"
+	"strings"
 	"text/tabwriter"
 
 	"github.com/fatih/color"
@@ -21,14 +22,14 @@ type TreeEntry struct {
 	Children []TreeEntry
 }
 
-func WriteTree(path string) (string, error) {
-	repoRoot, err := repo.FindRepoRoot()
+func (s *Store) WriteTree(path string) (string, error) {
+	repoRoot, err := s.repo.WorkTree()
 	if err != nil {
 		return "", fmt.Errorf("WriteTree: %w", err)
 	}
 
 	// Validate path
-	if err = repo.ValidateFileInRepo(path); err != nil {
+	if err = s.repo.ValidateFileInRepo(path); err != nil {
 		return "", fmt.Errorf("WriteTree: %w", err)
 	}
 	if isDir, err := util.IsDirectory(path); err != nil {
@@ -37,10 +38,6 @@ func WriteTree(path string) (string, error) {
 		return "", fmt.Errorf("WriteTree: file %s is not a directory", path)
 	}
 
-	ignoreList, err := ignore.ReadIgnoreFile()
-	if err != nil {
-		return "", fmt.Errorf("WriteTree: %w", err)
-	}
 	entries := make([]TreeEntry, 0)
 	err = filepath.Walk(path, func(file string, info os.FileInfo, err error) error {
 		if err != nil {
@@ -58,65 +55,101 @@ func WriteTree(path string) (string, error) {
 		if err != nil {
 			return err
 		}
-		if info.IsDir() {
-			relPath += "/"
-		}
-		for _, pattern := range ignoreList {
-			matched, err := filepath.Match(pattern, relPath)
-			if err != nil {
-				continue
-			}
-			if matched {
-				if info.IsDir() {
-					return filepath.SkipDir
-				} else {
-					return nil
-				}
+		if ignored, err := s.ignore.IsIgnored(relPath, info.IsDir()); err != nil {
+			return err
+		} else if ignored {
+			if info.IsDir() {
+				return filepath.SkipDir
 			}
+			return nil
 		}
 		name := filepath.Base(file)
 		if info.IsDir() {
-			hash, err := WriteTree(file)
+			hash, err := s.WriteTree(file)
 			if err != nil {
 				return err
 			}
 			entries = append(entries, TreeEntry{"040000", name, hash, []TreeEntry{}})
 			return filepath.SkipDir
 		}
-		hash, err := WriteBlob(file)
+		hash, err := s.WriteBlob(file)
+		if err != nil {
+			return err
+		}
 		entries = append(entries, TreeEntry{"100644", name, hash, []TreeEntry{}})
 		return nil
 	})
 	if err != nil {
 		return "", fmt.Errorf("WriteTree: %w", err)
 	}
+	hash, err := s.writeTreeObject(entries)
+	if err != nil {
+		return "", fmt.Errorf("WriteTree: %w", err)
+	}
+	return hash, nil
+}
+
+// BuildTree writes a tree from a flat list of file entries whose names are slash-separated paths relative to the root
+// of the tree, along with all the subtrees it needs. Entries are ordered the same way WriteTree orders them, so the
+// same files always produce the same tree.
+func (s *Store) BuildTree(entries []TreeEntry) (string, error) {
+	treeEntries := make([]TreeEntry, 0)
+	subdirs := make(map[string][]TreeEntry)
+	for _, entry := range entries {
+		if dir, rest, nested := strings.Cut(filepath.ToSlash(entry.Name), "/"); nested {
+			subdirs[dir] = append(subdirs[dir], TreeEntry{entry.Mode, rest, entry.Hash, []TreeEntry{}})
+		} else {
+			treeEntries = append(treeEntries, entry)
+		}
+	}
+	for dir, children := range subdirs {
+		hash, err := s.BuildTree(children)
+		if err != nil {
+			return "", err
+		}
+		treeEntries = append(treeEntries, TreeEntry{"040000", dir, hash, []TreeEntry{}})
+	}
+	sort.Slice(treeEntries, func(i, j int) bool {
+		return treeEntries[i].Name < treeEntries[j].Name
+	})
+	hash, err := s.writeTreeObject(treeEntries)
+	if err != nil {
+		return "", fmt.Errorf("BuildTree: %w", err)
+	}
+	return hash, nil
+}
+
+func (s *Store) writeTreeObject(entries []TreeEntry) (string, error) {
 	data := make([]byte, 0)
 	for _, entry := range entries {
 		entryData := []byte(fmt.Sprintf("%s\000%s\000", entry.Mode, entry.Name))
 		rawHash, err := hex.DecodeString(entry.Hash)
 		if err != nil {
-			return "", fmt.Errorf("WriteTree: %w", err)
+			return "", err
 		}
 		entryData = append(entryData, rawHash...)
 		data = append(data, entryData...)
 	}
-
-	hash, err := WriteObject(objecttype.Tree, data)
-	if err != nil {
-		return "", fmt.Errorf("WriteTree: %w", err)
-	}
-	return hash, nil
+	return s.WriteObject(objecttype.Tree, data)
 }
 
-func ReadTree(hash string) ([]TreeEntry, error) {
-	objType, data, err := ReadObject(hash)
+func (s *Store) ReadTree(hash string) ([]TreeEntry, error) {
+	objType, data, err := s.ReadObject(hash)
 	if err != nil {
-		return nil, fmt.Errorf("WriteTree: %w", err)
+		return nil, fmt.Errorf("ReadTree: %w", err)
 	}
 	if objType != objecttype.Tree {
 		return nil, fmt.Errorf(
-			"WriteTree: %w", &ObjectTypeMismatch{hash, objecttype.Tree, objType})
+			"ReadTree: %w", &ObjectTypeMismatch{hash, objecttype.Tree, objType})
 	}
+	entries, err := ParseTree(hash, data)
+	if err != nil {
+		return nil, fmt.Errorf("ReadTree: %w", err)
+	}
+	return entries, nil
+}
+
+func ParseTree(hash string, data []byte) ([]TreeEntry, error) {
 	entries := make([]TreeEntry, 0)
 	i := 0
 	for i < len(data) {
@@ -124,42 +157,45 @@ func ReadTree(hash string) ([]TreeEntry, error) {
 		for data[modeEnd] != 0 {
 			modeEnd++
 			if modeEnd >= len(data) {
-				return nil, fmt.Errorf("WriteTree: %w", &BadObject{hash, "format"})
+				return nil, &BadObject{hash, "format"}
 			}
 		}
 		mode := string(data[i:modeEnd])
 		i = modeEnd + 1
+		if i >= len(data) {
+			return nil, &BadObject{hash, "format"}
+		}
 
 		nameEnd := i
 		for data[nameEnd] != 0 {
 			nameEnd++
 			if nameEnd >= len(data) {
-				return nil, fmt.Errorf("WriteTree: %w", &BadObject{hash, "format"})
+				return nil, &BadObject{hash, "format"}
 			}
 		}
 		name := string(data[i:nameEnd])
 		i = nameEnd + 1
 
 		if i+20 > len(data) {
-			return nil, fmt.Errorf("WriteTree: %w", &BadObject{hash, "format"})
+			return nil, &BadObject{hash, "format"}
 		}
 		rawHash := data[i : i+20]
-		hash := hex.EncodeToString(rawHash)
+		entryHash := hex.EncodeToString(rawHash)
 		i += 20
 
-		entries = append(entries, TreeEntry{mode, name, hash, []TreeEntry{}})
+		entries = append(entries, TreeEntry{mode, name, entryHash, []TreeEntry{}})
 	}
 	return entries, nil
 }
 
-func ReadTreeRecursive(hash string) ([]TreeEntry, error) {
-	entries, err := ReadTree(hash)
+func (s *Store) ReadTreeRecursive(hash string) ([]TreeEntry, error) {
+	entries, err := s.ReadTree(hash)
 	if err != nil {
 		return nil, err
 	}
 	for i, entry := range entries {
 		if entry.Mode == "040000" {
-			entries[i].Children, err = ReadTreeRecursive(entry.Hash)
+			entries[i].Children, err = s.ReadTreeRecursive(entry.Hash)
 			if err != nil {
 				return nil, err
 			}
@@ -184,13 +220,13 @@ func FlattenTreeEntries(entries []TreeEntry) []TreeEntry {
 	return flatEntries
 }
 
-func PrintTree(hash string) error {
-	entries, err := ReadTree(hash)
+func (s *Store) PrintTree(hash string) error {
+	entries, err := s.ReadTree(hash)
 	if err != nil {
 		return fmt.Errorf("PrintTree: %w", err)
 	}
 
-	util.ColorPrintf(color.FgCyan, "[tree %s]\n", resolveObject(hash))
+	util.ColorPrintf(color.FgCyan, "[tree %s]\n", s.resolveObject(hash))
 	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
 	for _, entry := range entries {
 		util.Fprintf(writer, "%s\t%s  \t%s\n", entry.Mode, entry.Hash, entry.Name)
@@ -198,9 +234,9 @@ func PrintTree(hash string) error {
 	return writer.Flush()
 }
 
-func UnpackTree(hash string, path string) error {
+func (s *Store) UnpackTree(hash string, path string) error {
 	// Validate path
-	if err := repo.ValidateFileInRepo(path); err != nil {
+	if err := s.repo.ValidateFileInRepo(path); err != nil {
 		return fmt.Errorf("UnpackTree: %w", err)
 	}
 	if isDir, err := util.IsDirectory(path); err != nil {
@@ -209,19 +245,69 @@ func UnpackTree(hash string, path string) error {
 		return fmt.Errorf("UnpackTree: file %s is not a directory", path)
 	}
 
-	tree, err := ReadTreeRecursive(hash)
+	tree, err := s.ReadTreeRecursive(hash)
 	if err != nil {
 		return fmt.Errorf("UnpackTree: %w", err)
 	}
 	entries := FlattenTreeEntries(tree)
 	for _, entry := range entries {
 		file := filepath.Join(path, entry.Name)
-		blob, err := ReadBlob(entry.Hash)
-		if err != nil {
+		if err := s.CheckoutBlob(entry.Hash, file); err != nil {
 			return fmt.Errorf("UnpackTree: %w", err)
 		}
-		if err = os.WriteFile(file, blob, 0644); err != nil {
-			return fmt.Errorf("UnpackTree: %w", err)
+	}
+	return nil
+}
+
+// CheckoutTree updates the files under path, which are expected to match fromTree, so that they match toTree. Unlike
+// UnpackTree, files missing from toTree are removed along with any directories they leave empty, and files which are
+// the same in both trees are left untouched. An empty fromTree means nothing is checked out yet.
+func (s *Store) CheckoutTree(fromTree string, toTree string, path string) error {
+	if err := s.repo.ValidateFileInRepo(path); err != nil {
+		return fmt.Errorf("CheckoutTree: %w", err)
+	}
+	path = filepath.Clean(path)
+	fromEntries := make(map[string]string)
+	if fromTree != "" {
+		tree, err := s.ReadTreeRecursive(fromTree)
+		if err != nil {
+			return fmt.Errorf("CheckoutTree: %w", err)
+		}
+		for _, entry := range FlattenTreeEntries(tree) {
+			fromEntries[entry.Name] = entry.Hash
+		}
+	}
+	tree, err := s.ReadTreeRecursive(toTree)
+	if err != nil {
+		return fmt.Errorf("CheckoutTree: %w", err)
+	}
+	toEntries := FlattenTreeEntries(tree)
+	toNames := make(map[string]bool)
+	for _, entry := range toEntries {
+		toNames[entry.Name] = true
+	}
+
+	for name := range fromEntries {
+		if toNames[name] {
+			continue
+		}
+		file := filepath.Join(path, name)
+		if err := os.Remove(file); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("CheckoutTree: %w", err)
+		}
+		for dir := filepath.Dir(file); dir != path && strings.HasPrefix(dir, path); dir = filepath.Dir(dir) {
+			if err := os.Remove(dir); err != nil {
+				break
+			}
+		}
+	}
+	for _, entry := range toEntries {
+		if fromEntries[entry.Name] == entry.Hash {
+			continue
+		}
+		file := filepath.Join(path, entry.Name)
+		if err := s.CheckoutBlob(entry.Hash, file); err != nil {
+			return fmt.Errorf("CheckoutTree: %w", err)
 		}
 	}
 	return nil
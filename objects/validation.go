@@ -3,14 +3,19 @@ package objects
 import (
 	"encoding/hex"
 	"io/fs"
-	"patchy/repo"
 	"patchy/util"
 	"path/filepath"
 	"strings"
 )
 
-func validateObject(hash string) error {
-	repoDir, err := repo.FindRepoDir()
+// IsHash reports whether hash is a full object ID, forty lowercase hexadecimal digits, as opposed to a short or
+// malformed one.
+func IsHash(hash string) bool {
+	return len(hash) == 40 && strings.Trim(hash, "0123456789abcdef") == ""
+}
+
+func (s *Store) validateObject(hash string) error {
+	repoDir, err := s.repo.Dir()
 	if err != nil {
 		return err
 	}
@@ -25,8 +30,8 @@ func validateObject(hash string) error {
 	return nil
 }
 
-func resolveObject(shortHash string) string {
-	repoDir, err := repo.FindRepoDir()
+func (s *Store) resolveObject(shortHash string) string {
+	repoDir, err := s.repo.Dir()
 	if err != nil {
 		return ""
 	}
@@ -54,11 +59,21 @@ func resolveObject(shortHash string) string {
 	return ""
 }
 
-func ResolveAndValidateObject(shortHash *string) error {
-	repoDir, err := repo.FindRepoDir()
+func (s *Store) ResolveAndValidateObject(shortHash *string) error {
+	repoDir, err := s.repo.Dir()
 	if err != nil {
 		return err
 	}
+	// Full hashes can be checked directly instead of searching for matches
+	if len(*shortHash) == 40 {
+		if _, err := hex.DecodeString(*shortHash); err != nil {
+			return &BadObjectID{*shortHash}
+		}
+		if !HasObjectAt(repoDir, *shortHash) {
+			return &ObjectNotFound{*shortHash}
+		}
+		return nil
+	}
 	decodeCheckString := *shortHash
 	if len(decodeCheckString)%2 != 0 {
 		decodeCheckString += "0"
@@ -1,49 +1,61 @@
 package refs
 
 import (
+	"errors"
 	"fmt"
 	"io/fs"
 	"os"
-	"patchy/repo"
+	"patchy/config"
 	"path/filepath"
+	"strings"
 )
 
 type Branch struct {
 	Name       string
 	CommitHash string
+	Upstream   string
 }
 
-func NewBranch(name string, revSpec string) error {
-	repoDir, err := repo.FindRepoDir()
+func (s *Store) NewBranch(name string, revSpec string) error {
+	repoDir, err := s.repo.Dir()
 	if err != nil {
 		return fmt.Errorf("NewBranch: %w", err)
 	}
-	branches, err := ListBranches()
+	if err := ValidateBranchName(name); err != nil {
+		return fmt.Errorf("NewBranch: %w", err)
+	}
+	branches, err := s.ListBranches()
 	if err != nil {
 		return fmt.Errorf("NewBranch: %w", err)
 	}
 	for _, branch := range branches {
 		if branch.Name == name {
-			return fmt.Errorf("NewBranch: branch %s already exists", name)
+			return fmt.Errorf("NewBranch: %w", &BranchExists{name})
 		}
 	}
-	commitHash, err := ParseRev(revSpec)
+	commitHash, err := s.ParseRev(revSpec)
 	if err != nil {
 		return fmt.Errorf("NewBranch: %w", err)
 	}
 	branchPath := filepath.Join(repoDir, "refs", "heads", name)
-	branchDir := filepath.Dir(branchPath)
-	if err := os.MkdirAll(branchDir, os.ModePerm); err != nil {
-		return fmt.Errorf("NewBranch: %w", err)
-	}
-	if err := os.WriteFile(branchPath, []byte(commitHash), 0644); err != nil {
+	err = s.transaction("refs/heads/"+name, "", commitHash, func() error {
+		if err := os.MkdirAll(filepath.Dir(branchPath), os.ModePerm); err != nil {
+			return err
+		}
+		return os.WriteFile(branchPath, []byte(commitHash), 0644)
+	})
+	if err != nil {
 		return fmt.Errorf("NewBranch: %w", err)
 	}
 	return nil
 }
 
-func ListBranches() ([]Branch, error) {
-	repoDir, err := repo.FindRepoDir()
+func (s *Store) ListBranches() ([]Branch, error) {
+	repoDir, err := s.repo.Dir()
+	if err != nil {
+		return nil, fmt.Errorf("ListBranches: %w", err)
+	}
+	cfg, err := config.LoadRepo(s.repo)
 	if err != nil {
 		return nil, fmt.Errorf("ListBranches: %w", err)
 	}
@@ -65,8 +77,9 @@ func ListBranches() ([]Branch, error) {
 			return err
 		}
 		branches = append(branches, Branch{
-			Name:       relPath,
+			Name:       filepath.ToSlash(relPath),
 			CommitHash: string(data),
+			Upstream:   upstreamRef(cfg, filepath.ToSlash(relPath)),
 		})
 		return nil
 	})
@@ -75,3 +88,191 @@ func ListBranches() ([]Branch, error) {
 	}
 	return branches, nil
 }
+
+// ResetBranch points a branch at the given revision, creating it if it does not exist yet.
+func (s *Store) ResetBranch(name string, revSpec string) error {
+	if err := ValidateBranchName(name); err != nil {
+		return fmt.Errorf("ResetBranch: %w", err)
+	}
+	if err := s.checkNotCheckedOut(name); err != nil {
+		return fmt.Errorf("ResetBranch: %w", err)
+	}
+	commitHash, err := s.ParseRev(revSpec)
+	if err != nil {
+		return fmt.Errorf("ResetBranch: %w", err)
+	}
+	if err := s.UpdateRef("refs/heads/"+name, commitHash); err != nil {
+		return fmt.Errorf("ResetBranch: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) RenameBranch(oldName string, newName string, force bool) error {
+	if err := s.copyBranch(oldName, newName, force); err != nil {
+		return fmt.Errorf("RenameBranch: %w", err)
+	}
+	if oldName == newName {
+		return nil
+	}
+	cfg, err := config.LoadRepo(s.repo)
+	if err != nil {
+		return fmt.Errorf("RenameBranch: %w", err)
+	}
+	if cfg.RenameSection("branch", oldName, newName) {
+		if err := cfg.Save(); err != nil {
+			return fmt.Errorf("RenameBranch: %w", err)
+		}
+	}
+	if err := s.DeleteRef("refs/heads/" + oldName); err != nil {
+		return fmt.Errorf("RenameBranch: %w", err)
+	}
+	headState, err := s.ReadHead()
+	if err != nil {
+		return fmt.Errorf("RenameBranch: %w", err)
+	}
+	if !headState.Detached && headState.Ref == "refs/heads/"+oldName {
+		if err := s.UpdateHead(newName); err != nil {
+			return fmt.Errorf("RenameBranch: %w", err)
+		}
+	}
+	// Another working tree may have the branch checked out as well, which follows it to its new name
+	checkedOut, err := s.CheckedOutBranches()
+	if err != nil {
+		return fmt.Errorf("RenameBranch: %w", err)
+	}
+	if workTree, ok := checkedOut["refs/heads/"+oldName]; ok {
+		head := []byte("ref: refs/heads/" + newName)
+		if err := os.WriteFile(filepath.Join(workTree.LocalDir, "HEAD"), head, 0666); err != nil {
+			return fmt.Errorf("RenameBranch: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *Store) CopyBranch(oldName string, newName string, force bool) error {
+	if err := s.copyBranch(oldName, newName, force); err != nil {
+		return fmt.Errorf("CopyBranch: %w", err)
+	}
+	cfg, err := config.LoadRepo(s.repo)
+	if err != nil {
+		return fmt.Errorf("CopyBranch: %w", err)
+	}
+	if cfg.CopySection("branch", oldName, newName) {
+		if err := cfg.Save(); err != nil {
+			return fmt.Errorf("CopyBranch: %w", err)
+		}
+	}
+	return nil
+}
+
+// DeleteBranch removes a branch along with its config. Unless force is set, the branch must be merged into its
+// upstream, or into HEAD if it has none.
+func (s *Store) DeleteBranch(name string, force bool) error {
+	commitHash, err := s.ResolveRef("refs/heads/" + name)
+	if err != nil {
+		return fmt.Errorf("DeleteBranch: %w", err)
+	}
+	if err := s.checkNotCheckedOut(name); err != nil {
+		return fmt.Errorf("DeleteBranch: %w", err)
+	}
+	if !force {
+		if merged, err := s.isMerged(name, commitHash); err != nil {
+			return fmt.Errorf("DeleteBranch: %w", err)
+		} else if !merged {
+			return fmt.Errorf("DeleteBranch: %w", &BranchNotMerged{name})
+		}
+	}
+	if err := s.DeleteRef("refs/heads/" + name); err != nil {
+		return fmt.Errorf("DeleteBranch: %w", err)
+	}
+	cfg, err := config.LoadRepo(s.repo)
+	if err != nil {
+		return fmt.Errorf("DeleteBranch: %w", err)
+	}
+	if cfg.RemoveSection("branch", name) {
+		if err := cfg.Save(); err != nil {
+			return fmt.Errorf("DeleteBranch: %w", err)
+		}
+	}
+	return nil
+}
+
+// isMerged reports whether a branch's commit is merged into its upstream. A branch without an upstream, or whose
+// upstream no longer exists, is checked against HEAD instead, and is never merged while HEAD is unborn.
+func (s *Store) isMerged(name string, commitHash string) (bool, error) {
+	upstream, err := s.Upstream(name)
+	if err != nil {
+		return false, err
+	}
+	for _, revSpec := range []string{upstream, "HEAD"} {
+		if revSpec == "" {
+			continue
+		}
+		target, err := s.ParseRev(revSpec)
+		if errors.As(err, &ErrInvalidRevSpec) {
+			continue
+		} else if err != nil {
+			return false, err
+		}
+		return s.objects.IsAncestor(commitHash, target)
+	}
+	return false, nil
+}
+
+func ValidateBranchName(name string) error {
+	if name == "" || name == "HEAD" || strings.HasPrefix(name, "-") || strings.HasPrefix(name, "/") ||
+		strings.HasSuffix(name, "/") || strings.HasSuffix(name, ".") || strings.Contains(name, "..") ||
+		strings.Contains(name, "//") || strings.Contains(name, "@{") || strings.ContainsAny(name, " \t\n~^:?*[\\") {
+		return &InvalidBranchName{name}
+	}
+	return nil
+}
+
+func (s *Store) copyBranch(oldName string, newName string, force bool) error {
+	commitHash, err := s.ResolveRef("refs/heads/" + oldName)
+	if err != nil {
+		return err
+	}
+	if err := ValidateBranchName(newName); err != nil {
+		return err
+	}
+	if oldName == newName {
+		return nil
+	}
+	if _, err := s.ResolveRef("refs/heads/" + newName); err == nil {
+		if !force {
+			return &BranchExists{newName}
+		}
+		if err := s.checkNotCheckedOut(newName); err != nil {
+			return err
+		}
+	}
+	return s.UpdateRef("refs/heads/"+newName, commitHash)
+}
+
+func (s *Store) checkNotCheckedOut(name string) error {
+	headState, err := s.ReadHead()
+	if err != nil {
+		return err
+	}
+	if !headState.Detached && headState.Ref == "refs/heads/"+name {
+		return &BranchCheckedOut{name, ""}
+	}
+	return s.checkNotCheckedOutElsewhere(name)
+}
+
+// checkNotCheckedOutElsewhere fails if a branch is checked out in any working tree other than this one.
+func (s *Store) checkNotCheckedOutElsewhere(name string) error {
+	checkedOut, err := s.CheckedOutBranches()
+	if err != nil {
+		return err
+	}
+	localDir, err := s.repo.LocalDir()
+	if err != nil {
+		return err
+	}
+	if workTree, ok := checkedOut["refs/heads/"+name]; ok && workTree.LocalDir != localDir {
+		return &BranchCheckedOut{name, workTree.Path}
+	}
+	return nil
+}
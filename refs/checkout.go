@@ -1,33 +1,209 @@
 package refs
 
 import (
+	"errors"
 	"fmt"
+	"os"
 	"patchy/objects"
 	"patchy/repo"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
 )
 
-func Checkout(revSpec string) error {
-	repoRoot, err := repo.FindRepoRoot()
+func (s *Store) Checkout(revSpec string) error {
+	repoRoot, err := s.repo.WorkTree()
 	if err != nil {
 		return fmt.Errorf("Checkout: %w", err)
 	}
 
-	// Update HEAD to point to the specified revision
-	err = UpdateHead(revSpec)
+	// Find the commit hash for the specified revision before HEAD moves, as the revision may be relative to it
+	commitHash, err := s.ParseRev(revSpec)
 	if err != nil {
 		return fmt.Errorf("Checkout: %w", err)
 	}
-
-	// Find the commit hash for the specified revision
-	commitHash, err := ParseRev(revSpec)
+	commit, err := s.objects.ReadCommit(commitHash)
 	if err != nil {
 		return fmt.Errorf("Checkout: %w", err)
 	}
-	commit, err := objects.ReadCommit(commitHash)
-	if err != nil {
+
+	// Remember what is checked out now, so that files which are not in the new tree can be removed
+	fromTree := ""
+	if headState, err := s.ReadHead(); err != nil {
+		return fmt.Errorf("Checkout: %w", err)
+	} else if headState.Commit != "" {
+		headCommit, err := s.objects.ReadCommit(headState.Commit)
+		if err != nil {
+			return fmt.Errorf("Checkout: %w", err)
+		}
+		fromTree = headCommit.Tree
+	}
+
+	// Update HEAD to point to the specified revision
+	headTarget := commitHash
+	if _, err := s.ResolveRef("refs/heads/" + revSpec); err == nil {
+		headTarget = revSpec
+	}
+	if err := s.UpdateHead(headTarget); err != nil {
 		return fmt.Errorf("Checkout: %w", err)
 	}
 
 	// Update the working directory to match the commit's tree
-	return objects.UnpackTree(commit.Tree, repoRoot)
+	return s.objects.CheckoutTree(fromTree, commit.Tree, repoRoot)
+}
+
+// CheckoutPaths copies the files matching the given pathspecs out of a revision into the working tree, and removes the
+// files matching them which are in HEAD but not in the revision. A pathspec is a file or directory relative to the
+// current directory, or a glob pattern. Files with changes since HEAD are only overwritten or removed with force.
+// Returns the paths, relative to the root of the repository, which were changed.
+func (s *Store) CheckoutPaths(revSpec string, pathspecs []string, force bool) ([]string, error) {
+	repoRoot, err := s.repo.WorkTree()
+	if err != nil {
+		return nil, fmt.Errorf("CheckoutPaths: %w", err)
+	}
+	commitHash, err := s.ParseRev(revSpec)
+	if err != nil {
+		return nil, fmt.Errorf("CheckoutPaths: %w", err)
+	}
+	sourceFiles, err := s.commitFiles(commitHash)
+	if err != nil {
+		return nil, fmt.Errorf("CheckoutPaths: %w", err)
+	}
+	headState, err := s.ReadHead()
+	if err != nil {
+		return nil, fmt.Errorf("CheckoutPaths: %w", err)
+	}
+	headFiles, err := s.commitFiles(headState.Commit)
+	if err != nil {
+		return nil, fmt.Errorf("CheckoutPaths: %w", err)
+	}
+
+	patterns := make([]string, 0, len(pathspecs))
+	for _, pathspec := range pathspecs {
+		pattern, err := repoRelativePath(repoRoot, pathspec)
+		if err != nil {
+			return nil, fmt.Errorf("CheckoutPaths: %w", err)
+		}
+		patterns = append(patterns, pattern)
+	}
+	candidates := make([]string, 0)
+	isCandidate := make(map[string]bool)
+	for i, pattern := range patterns {
+		matched := false
+		for _, files := range []map[string]string{sourceFiles, headFiles} {
+			for name := range files {
+				if matchesPathspec(pattern, name) {
+					matched = true
+					if !isCandidate[name] {
+						isCandidate[name] = true
+						candidates = append(candidates, name)
+					}
+				}
+			}
+		}
+		if !matched {
+			return nil, fmt.Errorf("CheckoutPaths: %w", &PathspecNoMatch{pathspecs[i]})
+		}
+	}
+	sort.Strings(candidates)
+
+	// Work out every change up front, so that nothing is touched if any file would lose local modifications
+	changed := make([]string, 0)
+	modified := make([]string, 0)
+	for _, name := range candidates {
+		current, err := objects.HashFile(filepath.Join(repoRoot, filepath.FromSlash(name)))
+		exists := err == nil
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("CheckoutPaths: %w", err)
+		}
+		sourceHash, inSource := sourceFiles[name]
+		if inSource && exists {
+			if sourceHash == current {
+				continue
+			}
+		} else if !inSource && !exists {
+			continue
+		}
+		changed = append(changed, name)
+		if !exists {
+			continue
+		}
+		if headHash, inHead := headFiles[name]; !inHead || headHash != current {
+			modified = append(modified, name)
+		}
+	}
+	if len(modified) > 0 && !force {
+		return nil, fmt.Errorf("CheckoutPaths: %w", &LocalModifications{modified})
+	}
+
+	for _, name := range changed {
+		file := filepath.Join(repoRoot, filepath.FromSlash(name))
+		if sourceHash, inSource := sourceFiles[name]; inSource {
+			if err := s.objects.CheckoutBlob(sourceHash, file); err != nil {
+				return nil, fmt.Errorf("CheckoutPaths: %w", err)
+			}
+			continue
+		}
+		if err := os.Remove(file); err != nil {
+			return nil, fmt.Errorf("CheckoutPaths: %w", err)
+		}
+		for dir := filepath.Dir(file); dir != repoRoot && strings.HasPrefix(dir, repoRoot); dir = filepath.Dir(dir) {
+			if err := os.Remove(dir); err != nil {
+				break
+			}
+		}
+	}
+	return changed, nil
+}
+
+// commitFiles maps the slash-separated path of every file in a commit to its blob. An empty commit hash has no files.
+func (s *Store) commitFiles(commitHash string) (map[string]string, error) {
+	files := make(map[string]string)
+	if commitHash == "" {
+		return files, nil
+	}
+	commit, err := s.objects.ReadCommit(commitHash)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := s.objects.ReadTreeRecursive(commit.Tree)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range objects.FlattenTreeEntries(entries) {
+		files[filepath.ToSlash(entry.Name)] = entry.Hash
+	}
+	return files, nil
+}
+
+// repoRelativePath turns a path relative to the current directory into a slash-separated path relative to the root
+// of the repository, which is empty for the root itself.
+func repoRelativePath(repoRoot string, file string) (string, error) {
+	absPath, err := filepath.Abs(file)
+	if err != nil {
+		return "", err
+	}
+	relPath, err := filepath.Rel(repoRoot, absPath)
+	if err != nil || relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+		return "", &repo.FileNotInRepo{Path: file}
+	}
+	if relPath == "." {
+		return "", nil
+	}
+	return filepath.ToSlash(relPath), nil
+}
+
+// matchesPathspec reports whether a file is named by a pathspec, either directly, by being inside the directory it
+// names, or by it or one of its directories matching it as a glob pattern.
+func matchesPathspec(pattern string, name string) bool {
+	if pattern == "" || name == pattern || strings.HasPrefix(name, pattern+"/") {
+		return true
+	}
+	for prefix := name; prefix != "."; prefix = path.Dir(prefix) {
+		if matched, err := path.Match(pattern, prefix); err == nil && matched {
+			return true
+		}
+	}
+	return false
 }
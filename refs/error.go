@@ -1,5 +1,7 @@
 package refs
 
+import "strings"
+
 type InvalidRef struct {
 	Ref string
 }
@@ -16,7 +18,95 @@ func (e *InvalidRevSpec) Error() string {
 	return "unknown revision '" + e.RevSpec + "'"
 }
 
+type InvalidUpstream struct {
+	Upstream string
+}
+
+func (e *InvalidUpstream) Error() string {
+	return "the requested upstream branch '" + e.Upstream + "' does not exist"
+}
+
+type NoUpstream struct {
+	Branch string
+}
+
+func (e *NoUpstream) Error() string {
+	return "branch '" + e.Branch + "' has no upstream information"
+}
+
+type InvalidBranchName struct {
+	Name string
+}
+
+func (e *InvalidBranchName) Error() string {
+	return "'" + e.Name + "' is not a valid branch name"
+}
+
+type BranchExists struct {
+	Name string
+}
+
+func (e *BranchExists) Error() string {
+	return "branch " + e.Name + " already exists"
+}
+
+type BranchCheckedOut struct {
+	Name string
+	// WorkTree is the working tree the branch is checked out in, if not the current one
+	WorkTree string
+}
+
+func (e *BranchCheckedOut) Error() string {
+	if e.WorkTree != "" {
+		return "branch '" + e.Name + "' is checked out at '" + e.WorkTree + "'"
+	}
+	return "branch '" + e.Name + "' is checked out"
+}
+
+type BranchNotMerged struct {
+	Name string
+}
+
+func (e *BranchNotMerged) Error() string {
+	return "the branch '" + e.Name + "' is not fully merged"
+}
+
+type PathspecNoMatch struct {
+	Pathspec string
+}
+
+func (e *PathspecNoMatch) Error() string {
+	return "pathspec '" + e.Pathspec + "' did not match any files"
+}
+
+type PathNotInRev struct {
+	Path    string
+	RevSpec string
+}
+
+func (e *PathNotInRev) Error() string {
+	return "path '" + e.Path + "' does not exist in '" + e.RevSpec + "'"
+}
+
+type LocalModifications struct {
+	Paths []string
+}
+
+func (e *LocalModifications) Error() string {
+	return "your local changes to the following files would be overwritten:\n    " +
+		strings.Join(e.Paths, "\n    ") + "\nuse --force to discard them"
+}
+
 var (
-	ErrInvalidRef     *InvalidRef
-	ErrInvalidRevSpec *InvalidRevSpec
+	ErrInvalidRef         *InvalidRef
+	ErrInvalidRevSpec     *InvalidRevSpec
+	ErrInvalidUpstream    *InvalidUpstream
+	ErrNoUpstream         *NoUpstream
+	ErrInvalidBranchName  *InvalidBranchName
+	ErrBranchExists       *BranchExists
+	ErrBranchCheckedOut   *BranchCheckedOut
+	ErrBranchNotMerged    *BranchNotMerged
+	ErrPathspecNoMatch    *PathspecNoMatch
+	ErrPathNotInRev       *PathNotInRev
+	ErrLocalModifications *LocalModifications
 )
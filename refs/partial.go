@@ -0,0 +1,70 @@
+package refs
+
+import (
+	"fmt"
+	"patchy/objects"
+	"path/filepath"
+)
+
+// PartialTree builds the tree for committing only the files matching the given pathspecs: those are taken from
+// workTree, a tree of the whole working tree as written by WriteTree, and every other file is taken from HEAD.
+// Pathspecs are interpreted the same way as by CheckoutPaths, and each must match a file in either tree.
+func (s *Store) PartialTree(workTree string, pathspecs []string) (string, error) {
+	repoRoot, err := s.repo.WorkTree()
+	if err != nil {
+		return "", fmt.Errorf("PartialTree: %w", err)
+	}
+	headState, err := s.ReadHead()
+	if err != nil {
+		return "", fmt.Errorf("PartialTree: %w", err)
+	}
+	headFiles, err := s.commitFiles(headState.Commit)
+	if err != nil {
+		return "", fmt.Errorf("PartialTree: %w", err)
+	}
+	entries, err := s.objects.ReadTreeRecursive(workTree)
+	if err != nil {
+		return "", fmt.Errorf("PartialTree: %w", err)
+	}
+	workFiles := make(map[string]string)
+	for _, entry := range objects.FlattenTreeEntries(entries) {
+		workFiles[filepath.ToSlash(entry.Name)] = entry.Hash
+	}
+
+	files := make(map[string]string, len(headFiles))
+	for name, hash := range headFiles {
+		files[name] = hash
+	}
+	for _, pathspec := range pathspecs {
+		pattern, err := repoRelativePath(repoRoot, pathspec)
+		if err != nil {
+			return "", fmt.Errorf("PartialTree: %w", err)
+		}
+		matched := false
+		for name := range headFiles {
+			if matchesPathspec(pattern, name) {
+				matched = true
+				delete(files, name)
+			}
+		}
+		for name, hash := range workFiles {
+			if matchesPathspec(pattern, name) {
+				matched = true
+				files[name] = hash
+			}
+		}
+		if !matched {
+			return "", fmt.Errorf("PartialTree: %w", &PathspecNoMatch{pathspec})
+		}
+	}
+
+	treeEntries := make([]objects.TreeEntry, 0, len(files))
+	for name, hash := range files {
+		treeEntries = append(treeEntries, objects.TreeEntry{Mode: "100644", Name: name, Hash: hash})
+	}
+	tree, err := s.objects.BuildTree(treeEntries)
+	if err != nil {
+		return "", fmt.Errorf("PartialTree: %w", err)
+	}
+	return tree, nil
+}
@@ -3,10 +3,14 @@ package refs
 import (
 	"errors"
 	"fmt"
+	"io/fs"
 	"os"
+	"patchy/hooks"
 	"patchy/objects"
 	"patchy/objects/objecttype"
 	"patchy/repo"
+	"patchy/util"
+	"path"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -18,14 +22,14 @@ type HeadState struct {
 	Commit   string
 }
 
-func ResolveRef(ref string) (string, error) {
-	repoDir, err := repo.FindRepoDir()
+func (s *Store) ResolveRef(ref string) (string, error) {
+	repoDir, err := s.repo.Dir()
 	if err != nil {
 		return "", fmt.Errorf("ResolveRef: %w", err)
 	}
 	if data, err := os.ReadFile(filepath.Join(repoDir, ref)); err == nil {
 		hash := string(data)
-		if objType, err := objects.ReadObjectType(hash); err == nil && objType != objecttype.Commit {
+		if objType, err := s.objects.ReadObjectType(hash); err == nil && objType != objecttype.Commit {
 			return "", fmt.Errorf(
 				"ResolveRef: %w",
 				&objects.ObjectTypeMismatch{Hash: hash, Expected: objecttype.Commit, Actual: objType})
@@ -40,39 +44,43 @@ func ResolveRef(ref string) (string, error) {
 	}
 }
 
-func ParseRev(revSpec string) (string, error) { // TODO make better name
-	commit, err := ResolveRef("refs/heads/" + revSpec)
-	if err == nil {
-		return commit, nil
+// ParseRev resolves a revision to a commit hash. A revision is a ref, a branch, tag or remote-tracking branch name,
+// HEAD (or @), or a possibly abbreviated commit hash, optionally followed by any number of ~<n> and ^ suffixes which
+// select the n-th ancestor and the parent respectively.
+func (s *Store) ParseRev(revSpec string) (string, error) { // TODO make better name
+	base, suffix := revSpec, ""
+	if i := strings.IndexAny(revSpec, "~^"); i != -1 {
+		base, suffix = revSpec[:i], revSpec[i:]
 	}
-	prefix := ""
-	if strings.HasPrefix(revSpec, "HEAD") {
-		prefix = "HEAD"
-	} else if strings.HasPrefix(revSpec, "@") {
-		prefix = "@"
+	currentHash, err := s.resolveRevBase(base)
+	if err != nil {
+		return "", fmt.Errorf("ParseRev: %w", err)
 	}
-	if prefix != "" {
-		suffix := strings.TrimPrefix(revSpec, prefix)
-		head, err := ReadHead()
-		if err != nil {
-			return "", fmt.Errorf("ParseRev: %w", err)
-		}
-		if len(suffix) == 0 {
-			return head.Commit, nil
-		} else if !strings.HasPrefix(suffix, "~") || strings.HasPrefix(suffix, "^") {
-			return "", fmt.Errorf("ParseRev: %w", &InvalidRevSpec{RevSpec: revSpec})
+	if suffix == "" {
+		return currentHash, nil
+	}
+	for len(suffix) > 0 {
+		op := suffix[0]
+		numEnd := 1
+		for numEnd < len(suffix) && suffix[numEnd] >= '0' && suffix[numEnd] <= '9' {
+			numEnd++
 		}
-		numStr := suffix[1:]
 		num := 1
-		if len(numStr) > 0 {
-			num, err = strconv.Atoi(numStr)
-			if err != nil || num < 0 {
+		if numEnd > 1 {
+			num, err = strconv.Atoi(suffix[1:numEnd])
+			if err != nil || (op == '^' && num > 1) {
 				return "", fmt.Errorf("ParseRev: %w", &InvalidRevSpec{RevSpec: revSpec})
 			}
 		}
-		currentHash := head.Commit
+		if numEnd < len(suffix) && suffix[numEnd] != '~' && suffix[numEnd] != '^' {
+			return "", fmt.Errorf("ParseRev: %w", &InvalidRevSpec{RevSpec: revSpec})
+		}
+		suffix = suffix[numEnd:]
 		for i := 0; i < num; i++ {
-			commitObj, err := objects.ReadCommit(currentHash)
+			if currentHash == "" {
+				return "", fmt.Errorf("ParseRev: %w", &InvalidRevSpec{RevSpec: revSpec})
+			}
+			commitObj, err := s.objects.ReadCommit(currentHash)
 			if err != nil {
 				return "", fmt.Errorf("ParseRev: %w", err)
 			}
@@ -81,29 +89,92 @@ func ParseRev(revSpec string) (string, error) { // TODO make better name
 			}
 			currentHash = *commitObj.Parent
 		}
-		return currentHash, nil
+	}
+	return currentHash, nil
+}
+
+// ResolveObject resolves an object name to the hash of any object: a revision as understood by ParseRev, a possibly
+// abbreviated object hash, or <rev>:<path> for the blob or tree at a path from the root of a revision's tree. An empty
+// revision means HEAD, and an empty path the whole tree.
+func (s *Store) ResolveObject(name string) (string, error) {
+	revSpec, filePath, hasPath := strings.Cut(name, ":")
+	if !hasPath {
+		if hash, err := s.ParseRev(name); err == nil {
+			return hash, nil
+		}
+		hash := name
+		if err := s.objects.ResolveAndValidateObject(&hash); err != nil {
+			return "", fmt.Errorf("ResolveObject: %w", &InvalidRevSpec{RevSpec: name})
+		}
+		return hash, nil
+	}
+
+	if revSpec == "" {
+		revSpec = "HEAD"
+	}
+	commitHash, err := s.ParseRev(revSpec)
+	if err != nil {
+		return "", fmt.Errorf("ResolveObject: %w", err)
+	}
+	commit, err := s.objects.ReadCommit(commitHash)
+	if err != nil {
+		return "", fmt.Errorf("ResolveObject: %w", err)
+	}
+	hash := commit.Tree
+	for _, part := range strings.Split(filePath, "/") {
+		if part == "" || part == "." {
+			continue
+		}
+		entries, err := s.objects.ReadTree(hash)
+		if err != nil {
+			return "", fmt.Errorf("ResolveObject: %w", &PathNotInRev{filePath, revSpec})
+		}
+		found := false
+		for _, entry := range entries {
+			if entry.Name == part {
+				hash, found = entry.Hash, true
+				break
+			}
+		}
+		if !found {
+			return "", fmt.Errorf("ResolveObject: %w", &PathNotInRev{filePath, revSpec})
+		}
+	}
+	return hash, nil
+}
+
+func (s *Store) resolveRevBase(revSpec string) (string, error) {
+	for _, ref := range refCandidates(revSpec) {
+		if commit, err := s.ResolveRef(ref); err == nil {
+			return commit, nil
+		}
+	}
+	if revSpec == "HEAD" || revSpec == "@" {
+		head, err := s.ReadHead()
+		if err != nil {
+			return "", err
+		}
+		return head.Commit, nil
 	}
 	hash := revSpec
-	if err := objects.ResolveAndValidateObject(&hash); err == nil {
-		if objType, err := objects.ReadObjectType(hash); err == nil && objType == objecttype.Commit {
+	if err := s.objects.ResolveAndValidateObject(&hash); err == nil {
+		if objType, err := s.objects.ReadObjectType(hash); err == nil && objType == objecttype.Commit {
 			return hash, nil
 		} else if err != nil {
-			return "", fmt.Errorf("ParseRev: %w", err)
+			return "", err
 		} else {
-			return "", fmt.Errorf(
-				"ParseRev: %w",
-				&objects.ObjectTypeMismatch{Hash: revSpec, Expected: objecttype.Commit, Actual: objType})
+			return "", &objects.ObjectTypeMismatch{Hash: revSpec, Expected: objecttype.Commit, Actual: objType}
 		}
 	}
-	return "", fmt.Errorf("ParseRev: %w", &InvalidRevSpec{RevSpec: revSpec})
+	return "", &InvalidRevSpec{RevSpec: revSpec}
 }
 
-func UpdateRef(ref string, commitHash string) error {
-	repoDir, err := repo.FindRepoDir()
+func (s *Store) UpdateRef(ref string, commitHash string) error {
+	repoDir, err := s.repo.Dir()
 	if err != nil {
 		return fmt.Errorf("UpdateRef: %w", err)
 	}
-	if objType, err := objects.ReadObjectType(commitHash); err == nil && objType != objecttype.Commit {
+	if objType, err := s.objects.ReadObjectType(commitHash); err == nil && objType != objecttype.Commit {
 		return fmt.Errorf(
 			"UpdateRef: %w",
 			&objects.ObjectTypeMismatch{Hash: commitHash, Expected: objecttype.Commit, Actual: objType})
@@ -111,60 +182,237 @@ func UpdateRef(ref string, commitHash string) error {
 		return fmt.Errorf("UpdateRef: %w", err)
 	}
 
-	if err := os.WriteFile(filepath.Join(repoDir, ref), []byte(commitHash), 0644); err != nil {
+	oldHash, err := ReadRefAt(repoDir, ref)
+	if err != nil {
+		return fmt.Errorf("UpdateRef: %w", err)
+	}
+	err = s.transaction(ref, oldHash, commitHash, func() error {
+		return UpdateRefAt(repoDir, ref, commitHash)
+	})
+	if err != nil {
 		return fmt.Errorf("UpdateRef: %w", err)
 	}
 	return nil
 }
 
-func ReadHead() (*HeadState, error) {
-	repoDir, err := repo.FindRepoDir()
+// transaction runs the reference-transaction hook around an update of ref from oldHash to newHash, where an empty hash
+// stands for a ref which does not exist. The hook is run with "prepared" first, and can refuse the update by failing,
+// then with "committed" once apply has made the update, or "aborted" if it did not happen.
+func (s *Store) transaction(ref string, oldHash string, newHash string, apply func() error) error {
+	return transaction(s.repo, ref, oldHash, newHash, apply)
+}
+
+// TransactionAt is the same as UpdateRef's handling of the reference-transaction hook, for the repository at repoDir.
+func TransactionAt(repoDir string, ref string, oldHash string, newHash string, apply func() error) error {
+	r, err := repo.Open(repoDir)
+	if err != nil {
+		return err
+	}
+	return transaction(r, ref, oldHash, newHash, apply)
+}
+
+func transaction(r *repo.Repository, ref string, oldHash string, newHash string, apply func() error) error {
+	input := hooks.OrZeroHash(oldHash) + " " + hooks.OrZeroHash(newHash) + " " + ref + "\n"
+	if err := hooks.Run(r, hooks.ReferenceTransaction, input, "prepared"); err != nil {
+		_ = hooks.Run(r, hooks.ReferenceTransaction, input, "aborted")
+		return err
+	}
+	if err := apply(); err != nil {
+		_ = hooks.Run(r, hooks.ReferenceTransaction, input, "aborted")
+		return err
+	}
+	// The update has happened by now, so the hook can no longer refuse it
+	_ = hooks.Run(r, hooks.ReferenceTransaction, input, "committed")
+	return nil
+}
+
+func ReadRefAt(repoDir string, ref string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(repoDir, filepath.FromSlash(ref)))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+func UpdateRefAt(repoDir string, ref string, commitHash string) error {
+	refPath := filepath.Join(repoDir, filepath.FromSlash(ref))
+	if err := os.MkdirAll(filepath.Dir(refPath), os.ModePerm); err != nil {
+		return err
+	}
+	return os.WriteFile(refPath, []byte(commitHash), 0644)
+}
+
+func (s *Store) DeleteRef(ref string) error {
+	repoDir, err := s.repo.Dir()
+	if err != nil {
+		return fmt.Errorf("DeleteRef: %w", err)
+	}
+	oldHash, err := ReadRefAt(repoDir, ref)
+	if err != nil {
+		return fmt.Errorf("DeleteRef: %w", err)
+	} else if oldHash == "" {
+		return fmt.Errorf("DeleteRef: %w", &InvalidRef{Ref: ref})
+	}
+	err = s.transaction(ref, oldHash, "", func() error {
+		return DeleteRefAt(repoDir, ref)
+	})
+	if err != nil {
+		return fmt.Errorf("DeleteRef: %w", err)
+	}
+	return nil
+}
+
+func DeleteRefAt(repoDir string, ref string) error {
+	refPath := filepath.Join(repoDir, filepath.FromSlash(ref))
+	if err := os.Remove(refPath); errors.Is(err, os.ErrNotExist) {
+		return &InvalidRef{Ref: ref}
+	} else if err != nil {
+		return err
+	}
+	// Clean up directories left empty by namespaced refs, keeping the top-level refs/<kind> directories
+	for dir := path.Dir(ref); strings.Count(dir, "/") >= 2; dir = path.Dir(dir) {
+		if err := os.Remove(filepath.Join(repoDir, filepath.FromSlash(dir))); err != nil {
+			break
+		}
+	}
+	return nil
+}
+
+func (s *Store) ListRefs(prefix string) (map[string]string, error) {
+	repoDir, err := s.repo.Dir()
+	if err != nil {
+		return nil, fmt.Errorf("ListRefs: %w", err)
+	}
+	refs, err := ListRefsAt(repoDir, prefix)
+	if err != nil {
+		return nil, fmt.Errorf("ListRefs: %w", err)
+	}
+	return refs, nil
+}
+
+func ListRefsAt(repoDir string, prefix string) (map[string]string, error) {
+	refs := make(map[string]string)
+	root := filepath.Join(repoDir, filepath.FromSlash(prefix))
+	if exists, err := util.DoesFileExist(root); err != nil {
+		return nil, err
+	} else if !exists {
+		return refs, nil
+	}
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		relPath, err := filepath.Rel(repoDir, path)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		refs[filepath.ToSlash(relPath)] = strings.TrimSpace(string(data))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return refs, nil
+}
+
+func (s *Store) ReadHead() (*HeadState, error) {
+	localDir, err := s.repo.LocalDir()
 	if err != nil {
 		return nil, fmt.Errorf("ReadHead: %w", err)
 	}
-	data, err := os.ReadFile(filepath.Join(repoDir, "HEAD"))
+	head, err := s.readHeadIn(localDir)
 	if err != nil {
 		return nil, fmt.Errorf("ReadHead: %w", err)
+	}
+	return head, nil
+}
 
+// ReadWorkTreeHead reads the HEAD of another working tree of the repository.
+func (s *Store) ReadWorkTreeHead(workTree repo.WorkTreeInfo) (*HeadState, error) {
+	head, err := s.readHeadIn(workTree.LocalDir)
+	if err != nil {
+		return nil, fmt.Errorf("ReadWorkTreeHead: %w", err)
+	}
+	return head, nil
+}
+
+func (s *Store) readHeadIn(localDir string) (*HeadState, error) {
+	data, err := os.ReadFile(filepath.Join(localDir, "HEAD"))
+	if err != nil {
+		return nil, err
 	}
 	content := strings.Split(string(data), "\n")[0]
 	if strings.HasPrefix(content, "ref: ") {
 		ref := strings.TrimPrefix(content, "ref: ")
-		hash, err := ResolveRef(ref)
+		hash, err := s.ResolveRef(ref)
 		if err != nil && !errors.As(err, &ErrInvalidRef) {
-			return nil, fmt.Errorf("ReadHead: %w", err)
+			return nil, err
 		}
 		return &HeadState{false, ref, hash}, nil
 	}
 
-	if objType, err := objects.ReadObjectType(content); err == nil && objType != objecttype.Commit {
-		return nil, fmt.Errorf(
-			"ReadHead: %w",
-			&objects.ObjectTypeMismatch{Hash: content, Expected: objecttype.Commit, Actual: objType})
+	if objType, err := s.objects.ReadObjectType(content); err == nil && objType != objecttype.Commit {
+		return nil, &objects.ObjectTypeMismatch{Hash: content, Expected: objecttype.Commit, Actual: objType}
 	} else if err != nil {
-		return nil, fmt.Errorf("ReadHead: %w", err)
+		return nil, err
+	}
+	return &HeadState{true, "", content}, nil
+}
+
+func ReadHeadAt(repoDir string) (*HeadState, error) {
+	data, err := os.ReadFile(filepath.Join(repoDir, "HEAD"))
+	if err != nil {
+		return nil, err
+	}
+	content := strings.Split(string(data), "\n")[0]
+	if strings.HasPrefix(content, "ref: ") {
+		ref := strings.TrimPrefix(content, "ref: ")
+		hash, err := ReadRefAt(repoDir, ref)
+		if err != nil {
+			return nil, err
+		}
+		return &HeadState{false, ref, hash}, nil
 	}
 	return &HeadState{true, "", content}, nil
 }
 
-func UpdateHead(revSpec string) error {
-	repoDir, err := repo.FindRepoDir()
+func refCandidates(revSpec string) []string {
+	if strings.HasPrefix(revSpec, "refs/") {
+		return []string{revSpec}
+	}
+	return []string{"refs/heads/" + revSpec, "refs/tags/" + revSpec, "refs/remotes/" + revSpec}
+}
+
+func (s *Store) UpdateHead(revSpec string) error {
+	localDir, err := s.repo.LocalDir()
 	if err != nil {
 		return fmt.Errorf("UpdateHead: %w", err)
 	}
-	if _, err := ResolveRef("refs/heads/" + revSpec); err == nil {
-		// branch
-		if err := os.WriteFile(filepath.Join(repoDir, "HEAD"), []byte("ref: refs/heads/"+revSpec), 0666); err != nil {
+	if _, err := s.ResolveRef("refs/heads/" + revSpec); err == nil {
+		// branch, which may only be checked out in one working tree at a time
+		if err := s.checkNotCheckedOutElsewhere(revSpec); err != nil {
+			return fmt.Errorf("UpdateHead: %w", err)
+		}
+		if err := os.WriteFile(filepath.Join(localDir, "HEAD"), []byte("ref: refs/heads/"+revSpec), 0666); err != nil {
 			return fmt.Errorf("UpdateHead: %w", err)
 		}
 		return nil
 	}
 	// commit hash
-	hash, err := ParseRev(revSpec)
+	hash, err := s.ParseRev(revSpec)
 	if err != nil {
 		return fmt.Errorf("UpdateHead: %w", err)
 	}
-	if err := os.WriteFile(filepath.Join(repoDir, "HEAD"), []byte(hash), 0666); err != nil {
+	if err := os.WriteFile(filepath.Join(localDir, "HEAD"), []byte(hash), 0666); err != nil {
 		return fmt.Errorf("UpdateHead: %w", err)
 	}
 	return nil
@@ -0,0 +1,55 @@
+package refs
+
+import (
+	"fmt"
+)
+
+type ResetMode int
+
+const (
+	ResetSoft ResetMode = iota
+	ResetMixed
+	ResetHard
+)
+
+// Reset moves the current branch, or HEAD itself if it is detached, to the given revision and returns the commit it
+// now points at. A hard reset also makes the working tree match the commit, discarding every change made to it. There
+// is no index to reset, so soft and mixed resets both leave the working tree alone.
+func (s *Store) Reset(revSpec string, mode ResetMode) (string, error) {
+	headState, err := s.ReadHead()
+	if err != nil {
+		return "", fmt.Errorf("Reset: %w", err)
+	}
+	commitHash, err := s.ParseRev(revSpec)
+	if err != nil {
+		return "", fmt.Errorf("Reset: %w", err)
+	}
+	commit, err := s.objects.ReadCommit(commitHash)
+	if err != nil {
+		return "", fmt.Errorf("Reset: %w", err)
+	}
+
+	if mode == ResetHard {
+		repoRoot, err := s.repo.WorkTree()
+		if err != nil {
+			return "", fmt.Errorf("Reset: %w", err)
+		}
+		currentTree, err := s.objects.WriteTree(repoRoot)
+		if err != nil {
+			return "", fmt.Errorf("Reset: %w", err)
+		}
+		if err := s.objects.CheckoutTree(currentTree, commit.Tree, repoRoot); err != nil {
+			return "", fmt.Errorf("Reset: %w", err)
+		}
+	}
+
+	if headState.Detached {
+		err = s.UpdateHead(commitHash)
+	} else {
+		err = s.UpdateRef(headState.Ref, commitHash)
+	}
+	if err != nil {
+		return "", fmt.Errorf("Reset: %w", err)
+	}
+	return commitHash, nil
+}
@@ -0,0 +1,124 @@
+package refs
+
+import (
+	"patchy/objects"
+	"patchy/repo"
+)
+
+// Store reads and updates the refs and HEAD of a repository, and the working tree when checking them out.
+type Store struct {
+	repo    *repo.Repository
+	objects *objects.Store
+}
+
+var defaultStore = &Store{objects: objects.DefaultStore()}
+
+func NewStore(r *repo.Repository, objectStore *objects.Store) *Store {
+	return &Store{repo: r, objects: objectStore}
+}
+
+// DefaultStore returns the store of the repository found from the working directory, which the package level
+// functions use.
+func DefaultStore() *Store {
+	return defaultStore
+}
+
+func NewBranch(name string, revSpec string) error {
+	return defaultStore.NewBranch(name, revSpec)
+}
+
+func ListBranches() ([]Branch, error) {
+	return defaultStore.ListBranches()
+}
+
+func ResetBranch(name string, revSpec string) error {
+	return defaultStore.ResetBranch(name, revSpec)
+}
+
+func RenameBranch(oldName string, newName string, force bool) error {
+	return defaultStore.RenameBranch(oldName, newName, force)
+}
+
+func CopyBranch(oldName string, newName string, force bool) error {
+	return defaultStore.CopyBranch(oldName, newName, force)
+}
+
+func DeleteBranch(name string, force bool) error {
+	return defaultStore.DeleteBranch(name, force)
+}
+
+func Checkout(revSpec string) error {
+	return defaultStore.Checkout(revSpec)
+}
+
+func CheckoutPaths(revSpec string, pathspecs []string, force bool) ([]string, error) {
+	return defaultStore.CheckoutPaths(revSpec, pathspecs, force)
+}
+
+func PartialTree(workTree string, pathspecs []string) (string, error) {
+	return defaultStore.PartialTree(workTree, pathspecs)
+}
+
+func ResolveRef(ref string) (string, error) {
+	return defaultStore.ResolveRef(ref)
+}
+
+func ParseRev(revSpec string) (string, error) {
+	return defaultStore.ParseRev(revSpec)
+}
+
+func ResolveObject(name string) (string, error) {
+	return defaultStore.ResolveObject(name)
+}
+
+func UpdateRef(ref string, commitHash string) error {
+	return defaultStore.UpdateRef(ref, commitHash)
+}
+
+func DeleteRef(ref string) error {
+	return defaultStore.DeleteRef(ref)
+}
+
+func ListRefs(prefix string) (map[string]string, error) {
+	return defaultStore.ListRefs(prefix)
+}
+
+func ReadHead() (*HeadState, error) {
+	return defaultStore.ReadHead()
+}
+
+func ReadWorkTreeHead(workTree repo.WorkTreeInfo) (*HeadState, error) {
+	return defaultStore.ReadWorkTreeHead(workTree)
+}
+
+func CheckedOutBranches() (map[string]repo.WorkTreeInfo, error) {
+	return defaultStore.CheckedOutBranches()
+}
+
+func UpdateHead(revSpec string) error {
+	return defaultStore.UpdateHead(revSpec)
+}
+
+func Reset(revSpec string, mode ResetMode) (string, error) {
+	return defaultStore.Reset(revSpec, mode)
+}
+
+func SetUpstream(branch string, upstream string) error {
+	return defaultStore.SetUpstream(branch, upstream)
+}
+
+func UnsetUpstream(branch string) error {
+	return defaultStore.UnsetUpstream(branch)
+}
+
+func Upstream(branch string) (string, error) {
+	return defaultStore.Upstream(branch)
+}
+
+func UpstreamRemote(branch string) (string, error) {
+	return defaultStore.UpstreamRemote(branch)
+}
+
+func GetUpstreamStatus(branch Branch) (*UpstreamStatus, error) {
+	return defaultStore.GetUpstreamStatus(branch)
+}
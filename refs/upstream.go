@@ -0,0 +1,123 @@
+package refs
+
+import (
+	"fmt"
+	"patchy/config"
+	"strings"
+)
+
+type UpstreamStatus struct {
+	Upstream string
+	Gone     bool
+	Ahead    int
+	Behind   int
+}
+
+func (s *Store) SetUpstream(branch string, upstream string) error {
+	if _, err := s.ResolveRef("refs/heads/" + branch); err != nil {
+		return fmt.Errorf("SetUpstream: %w", err)
+	}
+	cfg, err := config.LoadRepo(s.repo)
+	if err != nil {
+		return fmt.Errorf("SetUpstream: %w", err)
+	}
+	remoteName, mergeRef, err := s.parseUpstream(cfg, upstream)
+	if err != nil {
+		return fmt.Errorf("SetUpstream: %w", err)
+	}
+	cfg.Set("branch."+branch+".remote", remoteName)
+	cfg.Set("branch."+branch+".merge", mergeRef)
+	if err := cfg.Save(); err != nil {
+		return fmt.Errorf("SetUpstream: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) UnsetUpstream(branch string) error {
+	cfg, err := config.LoadRepo(s.repo)
+	if err != nil {
+		return fmt.Errorf("UnsetUpstream: %w", err)
+	}
+	removedRemote := cfg.Unset("branch." + branch + ".remote")
+	removedMerge := cfg.Unset("branch." + branch + ".merge")
+	if !removedRemote && !removedMerge {
+		return fmt.Errorf("UnsetUpstream: %w", &NoUpstream{branch})
+	}
+	if err := cfg.Save(); err != nil {
+		return fmt.Errorf("UnsetUpstream: %w", err)
+	}
+	return nil
+}
+
+// Upstream returns the ref tracked by a branch, such as refs/remotes/origin/main, or an empty string if the branch has
+// no upstream configured.
+func (s *Store) Upstream(branch string) (string, error) {
+	cfg, err := config.LoadRepo(s.repo)
+	if err != nil {
+		return "", fmt.Errorf("Upstream: %w", err)
+	}
+	return upstreamRef(cfg, branch), nil
+}
+
+func (s *Store) UpstreamRemote(branch string) (string, error) {
+	cfg, err := config.LoadRepo(s.repo)
+	if err != nil {
+		return "", fmt.Errorf("UpstreamRemote: %w", err)
+	}
+	remoteName, _ := cfg.Get("branch." + branch + ".remote")
+	return remoteName, nil
+}
+
+func (s *Store) GetUpstreamStatus(branch Branch) (*UpstreamStatus, error) {
+	if branch.Upstream == "" {
+		return nil, nil
+	}
+	status := &UpstreamStatus{Upstream: branch.Upstream}
+	upstreamHash, err := s.ResolveRef(branch.Upstream)
+	if err != nil {
+		status.Gone = true
+		return status, nil
+	}
+	status.Ahead, status.Behind, err = s.objects.CountDivergence(branch.CommitHash, upstreamHash)
+	if err != nil {
+		return nil, fmt.Errorf("GetUpstreamStatus: %w", err)
+	}
+	return status, nil
+}
+
+func ShortRefName(ref string) string {
+	for _, prefix := range []string{"refs/heads/", "refs/remotes/", "refs/tags/"} {
+		if strings.HasPrefix(ref, prefix) {
+			return strings.TrimPrefix(ref, prefix)
+		}
+	}
+	return ref
+}
+
+func upstreamRef(cfg *config.Config, branch string) string {
+	remoteName, hasRemote := cfg.Get("branch." + branch + ".remote")
+	mergeRef, hasMerge := cfg.Get("branch." + branch + ".merge")
+	if !hasRemote || !hasMerge {
+		return ""
+	}
+	if remoteName == "." {
+		return mergeRef
+	}
+	return "refs/remotes/" + remoteName + "/" + strings.TrimPrefix(mergeRef, "refs/heads/")
+}
+
+// parseUpstream turns an upstream given as <remote>/<branch> or as a local branch name into the remote and merge
+// values stored in the branch's config section.
+func (s *Store) parseUpstream(cfg *config.Config, upstream string) (string, string, error) {
+	name := strings.TrimPrefix(upstream, "refs/remotes/")
+	if remoteName, branch, found := strings.Cut(name, "/"); found && cfg.HasSection("remote", remoteName) {
+		if _, err := s.ResolveRef("refs/remotes/" + name); err == nil {
+			return remoteName, "refs/heads/" + branch, nil
+		}
+	}
+	name = strings.TrimPrefix(upstream, "refs/heads/")
+	if _, err := s.ResolveRef("refs/heads/" + name); err == nil {
+		return ".", "refs/heads/" + name, nil
+	}
+	return "", "", &InvalidUpstream{upstream}
+}
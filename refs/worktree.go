@@ -0,0 +1,65 @@
+package refs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"patchy/repo"
+	"path/filepath"
+	"strings"
+)
+
+// CheckedOutBranches maps each branch checked out in one of the working trees of the repository, by its full ref name,
+// to that working tree. The HEAD of a bare repository does not count as checked out.
+func (s *Store) CheckedOutBranches() (map[string]repo.WorkTreeInfo, error) {
+	checkedOut, err := checkedOutBranches(s.repo)
+	if err != nil {
+		return nil, fmt.Errorf("CheckedOutBranches: %w", err)
+	}
+	return checkedOut, nil
+}
+
+// CheckedOutBranchesAt is CheckedOutBranches for the repository at repoDir.
+func CheckedOutBranchesAt(repoDir string) (map[string]repo.WorkTreeInfo, error) {
+	r, err := repo.Open(repoDir)
+	if err != nil {
+		return nil, err
+	}
+	return checkedOutBranches(r)
+}
+
+func checkedOutBranches(r *repo.Repository) (map[string]repo.WorkTreeInfo, error) {
+	workTrees, err := r.ListWorkTrees()
+	if err != nil {
+		return nil, err
+	}
+	checkedOut := make(map[string]repo.WorkTreeInfo)
+	for _, workTree := range workTrees {
+		if workTree.Path == "" {
+			continue
+		}
+		ref, err := readHeadRef(workTree.LocalDir)
+		if err != nil {
+			return nil, err
+		}
+		if ref != "" {
+			checkedOut[ref] = workTree
+		}
+	}
+	return checkedOut, nil
+}
+
+// readHeadRef returns the ref the HEAD in dir points to, or an empty string if it is detached or missing.
+func readHeadRef(dir string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "HEAD"))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	content := strings.Split(string(data), "\n")[0]
+	if !strings.HasPrefix(content, "ref: ") {
+		return "", nil
+	}
+	return strings.TrimPrefix(content, "ref: "), nil
+}
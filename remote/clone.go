@@ -0,0 +1,129 @@
+package remote
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"patchy/ignore"
+	"patchy/objects"
+	"patchy/refs"
+	"patchy/repo"
+	"path/filepath"
+	"strings"
+)
+
+type CloneResult struct {
+	RepoDir string
+	Branch  string
+}
+
+// Clone creates a new repository in dir, fetches everything from url into it and checks out the remote's current
+// branch. The new repository is worked on through its own stores, leaving the working directory of the process and the
+// default repository as they were. If the clone fails, dir is removed if Clone created it, or emptied again otherwise.
+func Clone(url string, dir string) (*CloneResult, error) {
+	url = normalizeURL(url)
+	t, err := Open(url)
+	if err != nil {
+		return nil, fmt.Errorf("Clone: %w", err)
+	}
+	ad, err := t.Advertise()
+	_ = t.Close()
+	if err != nil {
+		return nil, fmt.Errorf("Clone: %w", err)
+	}
+
+	if dir == "" {
+		dir = defaultCloneDir(url)
+	}
+	entries, err := os.ReadDir(dir)
+	if err == nil && len(entries) > 0 {
+		return nil, fmt.Errorf("Clone: destination path '%s' already exists and is not an empty directory", dir)
+	}
+	created := errors.Is(err, fs.ErrNotExist)
+	if created {
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			return nil, fmt.Errorf("Clone: %w", err)
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("Clone: %w", err)
+	}
+	result, err := cloneInto(url, dir, ad)
+	if err != nil {
+		if created {
+			_ = os.RemoveAll(dir)
+		} else {
+			emptyDir(dir)
+		}
+		return nil, fmt.Errorf("Clone: %w", err)
+	}
+	return result, nil
+}
+
+func cloneInto(url string, dir string, ad *Advertisement) (*CloneResult, error) {
+	repoDir, err := repo.InitRepo(dir)
+	if err != nil {
+		return nil, err
+	}
+	r, err := repo.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	objectStore := objects.NewStore(r, ignore.NewMatcher(r))
+	refStore := refs.NewStore(r, objectStore)
+	c := NewClient(r, objectStore, refStore)
+	// Credentials are only used for the initial fetch, rather than written to the config in plain text
+	if err := c.AddRemote("origin", withoutCredentials(url)); err != nil {
+		return nil, err
+	}
+	if _, err := c.fetchFrom(&Remote{"origin", url}, false); err != nil {
+		return nil, err
+	}
+
+	result := &CloneResult{RepoDir: repoDir}
+	headRef := ad.Head
+	if _, ok := ad.Refs[headRef]; !ok {
+		headRef = "refs/heads/main"
+	}
+	hash, ok := ad.Refs[headRef]
+	if !ok {
+		return result, nil
+	}
+	result.Branch = strings.TrimPrefix(headRef, "refs/heads/")
+	// Check out the commit while HEAD is still unborn, so that every file is written out, then attach HEAD to the branch
+	if err := refStore.Checkout(hash); err != nil {
+		return nil, err
+	}
+	if err := refStore.NewBranch(result.Branch, hash); err != nil {
+		return nil, err
+	}
+	if err := refStore.SetUpstream(result.Branch, "origin/"+result.Branch); err != nil {
+		return nil, err
+	}
+	if err := refStore.UpdateHead(result.Branch); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// emptyDir removes everything inside dir, but not dir itself.
+func emptyDir(dir string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		_ = os.RemoveAll(filepath.Join(dir, entry.Name()))
+	}
+}
+
+func defaultCloneDir(url string) string {
+	path := strings.TrimRight(filepath.ToSlash(url), "/")
+	path = strings.TrimSuffix(path, "/.patchy")
+	name := path[strings.LastIndexAny(path, "/:")+1:]
+	name = strings.TrimSuffix(name, ".patchy")
+	if name == "" {
+		return "repo"
+	}
+	return name
+}
@@ -0,0 +1,241 @@
+package remote
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// connTransport speaks the smart protocol over an arbitrary byte stream, such as the standard input and output of a
+// spawned `patchy serve` process.
+type connTransport struct {
+	local *Client
+	r     *bufio.Reader
+	w     *bufio.Writer
+	close func() error
+	ad    *Advertisement
+	used  bool
+}
+
+// NewConnTransport speaks the protocol over in and out, fetching into and pushing from the repository of the client.
+func (c *Client) NewConnTransport(in io.Reader, out io.Writer, close func() error) (Transport, error) {
+	t := &connTransport{local: c, r: bufio.NewReader(in), w: bufio.NewWriter(out), close: close}
+	ad, err := readAdvertisement(t.r)
+	if err != nil {
+		_ = t.close()
+		return nil, fmt.Errorf("NewConnTransport: %w", err)
+	}
+	t.ad = ad
+	return t, nil
+}
+
+func (c *Client) openCommand(args []string) (Transport, error) {
+	if len(args) == 0 {
+		return nil, errors.New("openCommand: empty command")
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("openCommand: %w", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("openCommand: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("openCommand: %w", err)
+	}
+	t, err := c.NewConnTransport(stdout, stdin, func() error {
+		_ = stdin.Close()
+		return cmd.Wait()
+	})
+	if err != nil {
+		return nil, fmt.Errorf("openCommand: %w", err)
+	}
+	return t, nil
+}
+
+// sshCommand turns ssh://[user@]host[:port]/path into the command line that runs `patchy serve` on that host.
+func sshCommand(rawURL string) ([]string, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Host == "" {
+		return nil, &UnsupportedURL{rawURL}
+	}
+	args := []string{"ssh"}
+	if parsed.Port() != "" {
+		args = append(args, "-p", parsed.Port())
+	}
+	host := parsed.Hostname()
+	if parsed.User != nil {
+		host = parsed.User.Username() + "@" + host
+	}
+	path := strings.TrimPrefix(parsed.Path, "/")
+	if path == "" {
+		path = "."
+	}
+	return append(args, host, "patchy", "serve", "'"+strings.ReplaceAll(path, "'", `'\''`)+"'"), nil
+}
+
+func (t *connTransport) Advertise() (*Advertisement, error) {
+	return t.ad, nil
+}
+
+func (t *connTransport) Fetch(wants []string) error {
+	if err := t.begin("upload"); err != nil {
+		return fmt.Errorf("Fetch: %w", err)
+	}
+	haves, err := t.local.localTips()
+	if err != nil {
+		return fmt.Errorf("Fetch: %w", err)
+	}
+	if err := writeHashes(t.w, "want", wants); err != nil {
+		return fmt.Errorf("Fetch: %w", err)
+	}
+	if err := writeHashes(t.w, "have", haves); err != nil {
+		return fmt.Errorf("Fetch: %w", err)
+	}
+	if err := t.w.Flush(); err != nil {
+		return fmt.Errorf("Fetch: %w", err)
+	}
+
+	if _, err := readSection(t.r); err != nil {
+		return fmt.Errorf("Fetch: %w", err)
+	}
+	if _, err := readPack(t.r, t.local.objects); err != nil {
+		return fmt.Errorf("Fetch: %w", err)
+	}
+	return nil
+}
+
+func (t *connTransport) Push(updates []RefUpdate) (map[string]error, error) {
+	if err := t.begin("receive"); err != nil {
+		return nil, fmt.Errorf("Push: %w", err)
+	}
+	if err := writeUpdates(t.w, updates); err != nil {
+		return nil, fmt.Errorf("Push: %w", err)
+	}
+	if err := t.local.writePushPack(t.w, t.ad, updates); err != nil {
+		return nil, fmt.Errorf("Push: %w", err)
+	}
+	if err := t.w.Flush(); err != nil {
+		return nil, fmt.Errorf("Push: %w", err)
+	}
+	rejected, err := readPushReport(t.r)
+	if err != nil {
+		return nil, fmt.Errorf("Push: %w", err)
+	}
+	return rejected, nil
+}
+
+func (t *connTransport) Close() error {
+	if !t.used {
+		_ = writeFlush(t.w)
+		_ = t.w.Flush()
+	}
+	return t.close()
+}
+
+func (t *connTransport) begin(service string) error {
+	if t.used {
+		return errors.New("connection already used")
+	}
+	t.used = true
+	return writePkt(t.w, "%s\n", service)
+}
+
+func writeHashes(w io.Writer, keyword string, hashes []string) error {
+	for _, hash := range hashes {
+		if err := writePkt(w, "%s %s\n", keyword, hash); err != nil {
+			return err
+		}
+	}
+	return writeFlush(w)
+}
+
+func writeUpdates(w io.Writer, updates []RefUpdate) error {
+	for _, update := range updates {
+		oldHash, newHash := update.Old, update.New
+		if oldHash == "" {
+			oldHash = zeroHash
+		}
+		if newHash == "" {
+			newHash = zeroHash
+		}
+		line := fmt.Sprintf("update %s %s %s", oldHash, newHash, update.Ref)
+		if update.Force {
+			line += " force"
+		}
+		if err := writePkt(w, "%s\n", line); err != nil {
+			return err
+		}
+	}
+	return writeFlush(w)
+}
+
+// writePushPack sends every object needed by the updates that is not reachable from a ref the remote advertised.
+func (c *Client) writePushPack(w io.Writer, ad *Advertisement, updates []RefUpdate) error {
+	localDir, err := c.repo.Dir()
+	if err != nil {
+		return err
+	}
+	wants := make([]string, 0, len(updates))
+	for _, update := range updates {
+		if update.New != "" {
+			wants = append(wants, update.New)
+		}
+	}
+	common := make([]string, 0, len(ad.Refs))
+	for _, hash := range ad.Refs {
+		if c.objects.HasObject(hash) {
+			common = append(common, hash)
+		}
+	}
+	missing, err := missingObjects(localDir, wants, common)
+	if err != nil {
+		return err
+	}
+	return writePack(w, localDir, missing)
+}
+
+func readPushReport(r *bufio.Reader) (map[string]error, error) {
+	lines, err := readSection(r)
+	if err != nil {
+		return nil, err
+	}
+	rejected := make(map[string]error)
+	for _, line := range lines {
+		fields := strings.SplitN(line, " ", 3)
+		switch {
+		case len(fields) == 2 && fields[0] == "ok":
+		case len(fields) == 3 && fields[0] == "ng":
+			rejected[fields[1]] = &RefRejected{fields[1], fields[2]}
+		default:
+			return nil, &ProtocolError{"bad report line " + line}
+		}
+	}
+	return rejected, nil
+}
+
+// localTips lists the commits at the tips of all local refs, which the remote can use to avoid sending history this
+// repository already has.
+func (c *Client) localTips() ([]string, error) {
+	localRefs, err := c.refs.ListRefs("refs/")
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	tips := make([]string, 0, len(localRefs))
+	for _, hash := range localRefs {
+		if !seen[hash] && c.objects.HasObject(hash) {
+			seen[hash] = true
+			tips = append(tips, hash)
+		}
+	}
+	return tips, nil
+}
@@ -0,0 +1,106 @@
+package remote_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"patchy/remote"
+	"patchy/repository"
+	"strings"
+	"testing"
+)
+
+// connect serves the server repository to a new connection of the client over a pair of pipes, as `patchy serve` does
+// over its standard input and output.
+func connect(t *testing.T, server *repository.Repository, client *repository.Repository) remote.Transport {
+	t.Helper()
+	requests, requestWriter := io.Pipe()
+	responses, responseWriter := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		err := remote.Serve(server.Repository, requests, responseWriter)
+		_ = requests.CloseWithError(io.ErrClosedPipe)
+		_ = responseWriter.CloseWithError(io.EOF)
+		done <- err
+	}()
+	transport, err := client.Remotes.NewConnTransport(responses, requestWriter, func() error {
+		_ = requestWriter.Close()
+		return <-done
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return transport
+}
+
+func TestConnFetchPush(t *testing.T) {
+	server := newBareRepo(t)
+	first := commitFile(t, server, "main", "file.txt", "one\n")
+	// The client is worked on through its handle only, from a working directory outside of it
+	t.Chdir(t.TempDir())
+	client := newRepo(t)
+
+	transport := connect(t, server, client)
+	ad, err := transport.Advertise()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ad.Head != "refs/heads/main" || ad.Refs["refs/heads/main"] != first {
+		t.Errorf("advertised %+v, want main at %s", ad, first)
+	}
+	if err := transport.Fetch([]string{first}); err != nil {
+		t.Fatal(err)
+	}
+	if err := transport.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Objects.ReadCommit(first); err != nil {
+		t.Fatalf("fetched commit is missing: %v", err)
+	}
+
+	if err := client.Refs.UpdateRef("refs/heads/main", first); err != nil {
+		t.Fatal(err)
+	}
+	second := commitFile(t, client, "main", "file.txt", "two\n")
+	transport = connect(t, server, client)
+	rejected, err := transport.Push([]remote.RefUpdate{
+		{Ref: "refs/heads/main", Old: first, New: second},
+		{Ref: "refs/heads/../../../escaped", New: second},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := transport.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := rejected["refs/heads/main"]; ok || len(rejected) != 1 {
+		t.Errorf("push rejected %v, want only the update of the bad ref name", rejected)
+	}
+	if got := resolveRef(t, server, "refs/heads/main"); got != second {
+		t.Errorf("server main is %s after push, want %s", got, second)
+	}
+	if _, err := server.Objects.ReadCommit(second); err != nil {
+		t.Errorf("pushed commit is missing on the server: %v", err)
+	}
+}
+
+func TestConnRejectsBadAdvertisement(t *testing.T) {
+	hash := strings.Repeat("a", 40)
+	for _, line := range []string{
+		hash + " refs/heads/../../../escaped",
+		hash + " HEAD",
+		"head refs/heads/../escaped",
+		"abc refs/heads/main",
+		strings.ToUpper(hash) + " refs/heads/main",
+	} {
+		var ad bytes.Buffer
+		fmt.Fprintf(&ad, "%04x%s\n0000", len(line)+5, line)
+		_, err := remote.NewConnTransport(&ad, io.Discard, func() error {
+			return nil
+		})
+		if !errors.As(err, &remote.ErrProtocolError) {
+			t.Errorf("advertisement %q gave error %v, want a protocol error", line, err)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package remote
+
+type NoSuchRemote struct {
+	Name string
+}
+
+func (e *NoSuchRemote) Error() string {
+	return "no such remote '" + e.Name + "'"
+}
+
+type RemoteExists struct {
+	Name string
+}
+
+func (e *RemoteExists) Error() string {
+	return "remote " + e.Name + " already exists"
+}
+
+type BadRemoteName struct {
+	Name string
+}
+
+func (e *BadRemoteName) Error() string {
+	return "'" + e.Name + "' is not a valid remote name"
+}
+
+type UnsupportedURL struct {
+	URL string
+}
+
+func (e *UnsupportedURL) Error() string {
+	return "don't know how to talk to '" + e.URL + "'"
+}
+
+type RefRejected struct {
+	Ref    string
+	Reason string
+}
+
+func (e *RefRejected) Error() string {
+	return "rejected " + e.Ref + " (" + e.Reason + ")"
+}
+
+type ProtocolError struct {
+	Description string
+}
+
+func (e *ProtocolError) Error() string {
+	return "protocol error: " + e.Description
+}
+
+type RemoteError struct {
+	Message string
+}
+
+func (e *RemoteError) Error() string {
+	return "remote error: " + e.Message
+}
+
+var (
+	ErrNoSuchRemote   *NoSuchRemote
+	ErrRemoteExists   *RemoteExists
+	ErrBadRemoteName  *BadRemoteName
+	ErrUnsupportedURL *UnsupportedURL
+	ErrRefRejected    *RefRejected
+	ErrProtocolError  *ProtocolError
+	ErrRemoteError    *RemoteError
+)
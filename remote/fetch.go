@@ -0,0 +1,84 @@
+package remote
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type TrackingUpdate struct {
+	RemoteRef string
+	LocalRef  string
+	Old       string
+	New       string
+}
+
+func (c *Client) Fetch(remoteName string, prune bool) ([]TrackingUpdate, error) {
+	r, err := c.GetRemote(remoteName)
+	if err != nil {
+		return nil, fmt.Errorf("Fetch: %w", err)
+	}
+	return c.fetchFrom(r, prune)
+}
+
+// fetchFrom fetches the branches of a remote into its remote-tracking refs, which need not be configured with the same
+// URL as the one given.
+func (c *Client) fetchFrom(r *Remote, prune bool) ([]TrackingUpdate, error) {
+	t, err := c.Open(r.URL)
+	if err != nil {
+		return nil, fmt.Errorf("Fetch: %w", err)
+	}
+	defer func() {
+		_ = t.Close()
+	}()
+	ad, err := t.Advertise()
+	if err != nil {
+		return nil, fmt.Errorf("Fetch: %w", err)
+	}
+
+	wants := make([]string, 0)
+	branches := make(map[string]string)
+	for ref, hash := range ad.Refs {
+		if strings.HasPrefix(ref, "refs/heads/") {
+			branches[ref] = hash
+			wants = append(wants, hash)
+		}
+	}
+	if len(wants) > 0 {
+		if err := t.Fetch(wants); err != nil {
+			return nil, fmt.Errorf("Fetch: %w", err)
+		}
+	}
+
+	existing, err := c.refs.ListRefs(trackingPrefix(r.Name))
+	if err != nil {
+		return nil, fmt.Errorf("Fetch: %w", err)
+	}
+	updates := make([]TrackingUpdate, 0)
+	for ref, hash := range branches {
+		localRef := trackingPrefix(r.Name) + strings.TrimPrefix(ref, "refs/heads/")
+		if existing[localRef] == hash {
+			continue
+		}
+		if err := c.refs.UpdateRef(localRef, hash); err != nil {
+			return nil, fmt.Errorf("Fetch: %w", err)
+		}
+		updates = append(updates, TrackingUpdate{ref, localRef, existing[localRef], hash})
+	}
+	if prune {
+		for localRef, hash := range existing {
+			ref := "refs/heads/" + strings.TrimPrefix(localRef, trackingPrefix(r.Name))
+			if _, ok := branches[ref]; ok {
+				continue
+			}
+			if err := c.refs.DeleteRef(localRef); err != nil {
+				return nil, fmt.Errorf("Fetch: %w", err)
+			}
+			updates = append(updates, TrackingUpdate{ref, localRef, hash, ""})
+		}
+	}
+	sort.Slice(updates, func(i, j int) bool {
+		return updates[i].LocalRef < updates[j].LocalRef
+	})
+	return updates, nil
+}
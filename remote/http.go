@@ -0,0 +1,231 @@
+package remote
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"patchy/ignore"
+	"patchy/objects"
+	"patchy/repo"
+	"strings"
+	"sync"
+)
+
+// Over HTTP every protocol exchange is a request of its own:
+//
+//	GET  <url>/info/refs  responds with the ref advertisement
+//	POST <url>/upload     takes the wants and haves, responds with the acknowledgements and a pack
+//	POST <url>/receive    takes the ref updates and a pack, responds with the report
+
+const protocolContentType = "application/x-patchy"
+
+type httpHandler struct {
+	repoDir  string
+	objects  *objects.Store
+	username string
+	password string
+	// Pushes are applied one at a time so that concurrent ref updates cannot interleave
+	receiveLock sync.Mutex
+}
+
+// NewHTTPHandler serves the repository r, or the default repository if it is nil. When username is not empty, every
+// request must carry matching basic auth credentials.
+func NewHTTPHandler(r *repo.Repository, username string, password string) (http.Handler, error) {
+	repoDir, err := r.Dir()
+	if err != nil {
+		return nil, fmt.Errorf("NewHTTPHandler: %w", err)
+	}
+	return &httpHandler{
+		repoDir:  repoDir,
+		objects:  objects.NewStore(r, ignore.NewMatcher(r)),
+		username: username,
+		password: password,
+	}, nil
+}
+
+func (h *httpHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !h.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="patchy"`)
+		http.Error(w, "authentication required", http.StatusUnauthorized)
+		return
+	}
+	var handle func(body *bufio.Reader, out io.Writer) error
+	switch {
+	case r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/info/refs"):
+		handle = func(_ *bufio.Reader, out io.Writer) error {
+			return writeAdvertisement(out, h.repoDir)
+		}
+	case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/upload"):
+		handle = func(body *bufio.Reader, out io.Writer) error {
+			return serveUpload(h.repoDir, body, out)
+		}
+	case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/receive"):
+		handle = func(body *bufio.Reader, out io.Writer) error {
+			h.receiveLock.Lock()
+			defer h.receiveLock.Unlock()
+			return serveReceive(h.repoDir, h.objects, body, out)
+		}
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", protocolContentType)
+	out := bufio.NewWriter(w)
+	if err := handle(bufio.NewReader(r.Body), out); err != nil {
+		_ = writePkt(out, "ERR %s\n", err)
+	}
+	_ = out.Flush()
+}
+
+func (h *httpHandler) authorized(r *http.Request) bool {
+	if h.username == "" {
+		return true
+	}
+	username, password, ok := r.BasicAuth()
+	usernameMatches := subtle.ConstantTimeCompare([]byte(username), []byte(h.username)) == 1
+	passwordMatches := subtle.ConstantTimeCompare([]byte(password), []byte(h.password)) == 1
+	return ok && usernameMatches && passwordMatches
+}
+
+type httpTransport struct {
+	local    *Client
+	baseURL  string
+	username string
+	password string
+	client   *http.Client
+	ad       *Advertisement
+}
+
+// NewHTTPTransport connects to a repository served by NewHTTPHandler. Credentials are taken from the url, with the
+// password falling back to the PATCHY_HTTP_PASSWORD environment variable so that it need not be stored in the config.
+func (c *Client) NewHTTPTransport(rawURL string, client *http.Client) (Transport, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Host == "" {
+		return nil, fmt.Errorf("NewHTTPTransport: %w", &UnsupportedURL{rawURL})
+	}
+	t := &httpTransport{local: c, client: client}
+	if parsed.User != nil {
+		t.username = parsed.User.Username()
+		if password, ok := parsed.User.Password(); ok {
+			t.password = password
+		} else {
+			t.password = os.Getenv("PATCHY_HTTP_PASSWORD")
+		}
+		parsed.User = nil
+	}
+	t.baseURL = strings.TrimSuffix(parsed.String(), "/")
+
+	resp, err := t.do(http.MethodGet, "/info/refs", nil)
+	if err != nil {
+		return nil, fmt.Errorf("NewHTTPTransport: %w", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	ad, err := readAdvertisement(bufio.NewReader(resp.Body))
+	if err != nil {
+		return nil, fmt.Errorf("NewHTTPTransport: %w", err)
+	}
+	t.ad = ad
+	return t, nil
+}
+
+func (t *httpTransport) Advertise() (*Advertisement, error) {
+	return t.ad, nil
+}
+
+func (t *httpTransport) Fetch(wants []string) error {
+	haves, err := t.local.localTips()
+	if err != nil {
+		return fmt.Errorf("Fetch: %w", err)
+	}
+	var body bytes.Buffer
+	if err := writeHashes(&body, "want", wants); err != nil {
+		return fmt.Errorf("Fetch: %w", err)
+	}
+	if err := writeHashes(&body, "have", haves); err != nil {
+		return fmt.Errorf("Fetch: %w", err)
+	}
+
+	resp, err := t.do(http.MethodPost, "/upload", &body)
+	if err != nil {
+		return fmt.Errorf("Fetch: %w", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	r := bufio.NewReader(resp.Body)
+	if _, err := readSection(r); err != nil {
+		return fmt.Errorf("Fetch: %w", err)
+	}
+	if _, err := readPack(r, t.local.objects); err != nil {
+		return fmt.Errorf("Fetch: %w", err)
+	}
+	return nil
+}
+
+func (t *httpTransport) Push(updates []RefUpdate) (map[string]error, error) {
+	// Stream the pack into the request body instead of building it in memory
+	bodyReader, bodyWriter := io.Pipe()
+	go func() {
+		w := bufio.NewWriter(bodyWriter)
+		err := writeUpdates(w, updates)
+		if err == nil {
+			err = t.local.writePushPack(w, t.ad, updates)
+		}
+		if err == nil {
+			err = w.Flush()
+		}
+		_ = bodyWriter.CloseWithError(err)
+	}()
+
+	resp, err := t.do(http.MethodPost, "/receive", bodyReader)
+	_ = bodyReader.Close()
+	if err != nil {
+		return nil, fmt.Errorf("Push: %w", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	rejected, err := readPushReport(bufio.NewReader(resp.Body))
+	if err != nil {
+		return nil, fmt.Errorf("Push: %w", err)
+	}
+	return rejected, nil
+}
+
+func (t *httpTransport) Close() error {
+	return nil
+}
+
+func (t *httpTransport) do(method string, path string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(method, t.baseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", protocolContentType)
+	}
+	if t.username != "" {
+		req.SetBasicAuth(t.username, t.password)
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		_ = resp.Body.Close()
+		if resp.StatusCode == http.StatusUnauthorized {
+			return nil, errors.New("authentication failed for " + t.baseURL)
+		}
+		return nil, fmt.Errorf("unexpected response from %s: %s", t.baseURL, resp.Status)
+	}
+	return resp, nil
+}
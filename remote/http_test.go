@@ -0,0 +1,165 @@
+package remote_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"patchy/remote"
+	"patchy/repository"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHTTPCloneFetchPush(t *testing.T) {
+	server := newBareRepo(t)
+	first := commitFile(t, server, "main", "file.txt", "one\n")
+	handler, err := remote.NewHTTPHandler(server.Repository, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpServer := httptest.NewServer(handler)
+	defer httpServer.Close()
+
+	chdirTemp(t)
+	result, err := remote.Clone(httpServer.URL, "clone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := repository.Open(result.RepoDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Branch != "main" {
+		t.Errorf("cloned branch %q, want main", result.Branch)
+	}
+	if got := resolveRef(t, client, "refs/heads/main"); got != first {
+		t.Errorf("main is %s after clone, want %s", got, first)
+	}
+	if got := readFile(t, filepath.Join("clone", "file.txt")); got != "one\n" {
+		t.Errorf("file.txt is %q after clone, want %q", got, "one\n")
+	}
+
+	second := commitFile(t, server, "main", "file.txt", "two\n")
+	updates, err := client.Remotes.Fetch("origin", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(updates) != 1 || updates[0].New != second {
+		t.Errorf("fetch made updates %+v, want origin/main at %s", updates, second)
+	}
+	if _, err := client.Objects.ReadCommit(second); err != nil {
+		t.Errorf("fetched commit is missing: %v", err)
+	}
+
+	if err := client.Refs.UpdateRef("refs/heads/main", second); err != nil {
+		t.Fatal(err)
+	}
+	third := commitFile(t, client, "main", "file.txt", "three\n")
+	results, err := client.Remotes.Push("origin", []string{"main"}, false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Err != nil {
+		t.Fatalf("push results %+v, want a single successful update", results)
+	}
+	if got := resolveRef(t, server, "refs/heads/main"); got != third {
+		t.Errorf("server main is %s after push, want %s", got, third)
+	}
+	if _, err := server.Objects.ReadCommit(third); err != nil {
+		t.Errorf("pushed commit is missing on the server: %v", err)
+	}
+
+	// A push which would lose history the server has gained since is refused without --force
+	commitFile(t, server, "main", "file.txt", "four\n")
+	results, err = client.Remotes.Push("origin", []string{"main"}, false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || !errors.As(results[0].Err, &remote.ErrRefRejected) {
+		t.Errorf("push results %+v, want the update to be rejected", results)
+	}
+}
+
+func TestHTTPAuth(t *testing.T) {
+	server := newBareRepo(t)
+	commitFile(t, server, "main", "file.txt", "one\n")
+	handler, err := remote.NewHTTPHandler(server.Repository, "user", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpServer := httptest.NewServer(handler)
+	defer httpServer.Close()
+
+	chdirTemp(t)
+	if _, err := remote.Clone(httpServer.URL, "anonymous"); err == nil {
+		t.Error("clone without credentials succeeded")
+	}
+	if _, err := remote.Clone("http://user:wrong@"+httpServer.Listener.Addr().String(), "wrong"); err == nil {
+		t.Error("clone with a wrong password succeeded")
+	}
+	if _, err := remote.Clone("http://user:secret@"+httpServer.Listener.Addr().String(), "authenticated"); err != nil {
+		t.Fatal(err)
+	}
+	cloned, err := repository.Open("authenticated")
+	if err != nil {
+		t.Fatal(err)
+	}
+	origin, err := cloned.Remotes.GetRemote("origin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if origin.URL != httpServer.URL {
+		t.Errorf("origin URL saved as %q, want %q", origin.URL, httpServer.URL)
+	}
+}
+
+// TestCloneFailure clones from a server which advertises its refs but then fails to send them, which must leave no
+// trace of the clone.
+func TestCloneFailure(t *testing.T) {
+	server := newBareRepo(t)
+	commitFile(t, server, "main", "file.txt", "one\n")
+	handler, err := remote.NewHTTPHandler(server.Repository, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/upload") {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer httpServer.Close()
+
+	chdirTemp(t)
+	startDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := remote.Clone(httpServer.URL, "created"); err == nil {
+		t.Fatal("clone succeeded")
+	}
+	if _, err := os.Stat("created"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("directory created by the clone was left behind: %v", err)
+	}
+
+	// A directory which existed beforehand is kept, as empty as it was
+	if err := os.Mkdir("existing", os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := remote.Clone(httpServer.URL, "existing"); err == nil {
+		t.Fatal("clone succeeded")
+	}
+	entries, err := os.ReadDir("existing")
+	if err != nil {
+		t.Fatalf("existing directory was removed: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("existing directory holds %v after the clone failed, want nothing", entries)
+	}
+	if dir, err := os.Getwd(); err != nil || dir != startDir {
+		t.Errorf("working directory is %q after the clone, want %q", dir, startDir)
+	}
+}
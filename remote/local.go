@@ -0,0 +1,80 @@
+package remote
+
+import (
+	"fmt"
+	"patchy/objects"
+	"patchy/repo"
+)
+
+type localTransport struct {
+	local   *Client
+	repoDir string
+}
+
+func (c *Client) openLocal(path string) (*localTransport, error) {
+	repoDir, err := repo.OpenRepoDir(path)
+	if err != nil {
+		return nil, fmt.Errorf("openLocal: %w", err)
+	}
+	return &localTransport{c, repoDir}, nil
+}
+
+func (t *localTransport) Advertise() (*Advertisement, error) {
+	ad, err := advertiseAt(t.repoDir)
+	if err != nil {
+		return nil, fmt.Errorf("Advertise: %w", err)
+	}
+	return ad, nil
+}
+
+func (t *localTransport) Fetch(wants []string) error {
+	localDir, err := t.local.repo.Dir()
+	if err != nil {
+		return fmt.Errorf("Fetch: %w", err)
+	}
+	if err := copyObjects(t.repoDir, localDir, wants); err != nil {
+		return fmt.Errorf("Fetch: %w", err)
+	}
+	return nil
+}
+
+func (t *localTransport) Push(updates []RefUpdate) (map[string]error, error) {
+	localDir, err := t.local.repo.Dir()
+	if err != nil {
+		return nil, fmt.Errorf("Push: %w", err)
+	}
+	tips := make([]string, 0, len(updates))
+	for _, update := range updates {
+		if update.New != "" {
+			tips = append(tips, update.New)
+		}
+	}
+	if err := copyObjects(localDir, t.repoDir, tips); err != nil {
+		return nil, fmt.Errorf("Push: %w", err)
+	}
+
+	rejected, err := applyRefUpdates(t.repoDir, updates)
+	if err != nil {
+		return nil, fmt.Errorf("Push: %w", err)
+	}
+	return rejected, nil
+}
+
+func (t *localTransport) Close() error {
+	return nil
+}
+
+func copyObjects(srcRepoDir string, dstRepoDir string, tips []string) error {
+	missing, err := objects.ReachableObjects(srcRepoDir, tips, func(hash string) bool {
+		return objects.HasObjectAt(dstRepoDir, hash)
+	})
+	if err != nil {
+		return err
+	}
+	for _, hash := range missing {
+		if err := objects.CopyObject(srcRepoDir, dstRepoDir, hash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package remote
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/binary"
+	"hash"
+	"io"
+	"patchy/objects"
+	"patchy/objects/objecttype"
+	"strconv"
+)
+
+// A pack is a stream of objects: the magic "PACK", a version and an object count, then for every object its type, its
+// length as a uvarint and its zlib-compressed contents, followed by the SHA-1 of everything before it.
+
+const packVersion = 1
+
+func writePack(w io.Writer, repoDir string, hashes []string) error {
+	checksum := sha1.New()
+	out := io.MultiWriter(w, checksum)
+	header := make([]byte, 12)
+	copy(header, "PACK")
+	binary.BigEndian.PutUint32(header[4:], packVersion)
+	binary.BigEndian.PutUint32(header[8:], uint32(len(hashes)))
+	if _, err := out.Write(header); err != nil {
+		return err
+	}
+
+	for _, hash := range hashes {
+		objType, data, err := objects.ReadObjectAt(repoDir, hash)
+		if err != nil {
+			return err
+		}
+		entryHeader := binary.AppendUvarint([]byte{byte(objType)}, uint64(len(data)))
+		if _, err := out.Write(entryHeader); err != nil {
+			return err
+		}
+		compressor := zlib.NewWriter(out)
+		if _, err := compressor.Write(data); err != nil {
+			_ = compressor.Close()
+			return err
+		}
+		if err := compressor.Close(); err != nil {
+			return err
+		}
+	}
+	_, err := w.Write(checksum.Sum(nil))
+	return err
+}
+
+// readPack stores every object of the pack read from r in store and returns how many it contained. Objects are checked
+// to be well formed and kept in a quarantine until the checksum of the whole pack has been verified.
+func readPack(r *bufio.Reader, store *objects.Store) (int, error) {
+	quarantine, err := store.NewQuarantine()
+	if err != nil {
+		return 0, err
+	}
+	count, err := readPackInto(r, quarantine)
+	if err != nil {
+		_ = quarantine.Discard()
+		return 0, err
+	}
+	if err := quarantine.Commit(); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func readPackInto(r *bufio.Reader, quarantine *objects.Quarantine) (int, error) {
+	in := &checksumReader{r, sha1.New()}
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(in, header); err != nil {
+		return 0, err
+	}
+	if string(header[:4]) != "PACK" {
+		return 0, &ProtocolError{"bad pack signature"}
+	}
+	if version := binary.BigEndian.Uint32(header[4:]); version != packVersion {
+		return 0, &ProtocolError{"unsupported pack version " + strconv.Itoa(int(version))}
+	}
+	count := int(binary.BigEndian.Uint32(header[8:]))
+
+	for i := 0; i < count; i++ {
+		typeByte, err := in.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		objType := objecttype.ObjectType(typeByte)
+		if objType.String() == "unknown" {
+			return 0, &ProtocolError{"bad object type in pack"}
+		}
+		size, err := binary.ReadUvarint(in)
+		if err != nil {
+			return 0, err
+		}
+		decompressor, err := zlib.NewReader(in)
+		if err != nil {
+			return 0, err
+		}
+		data, err := io.ReadAll(io.LimitReader(decompressor, int64(size)+1))
+		_ = decompressor.Close()
+		if err != nil {
+			return 0, err
+		}
+		if uint64(len(data)) != size {
+			return 0, &ProtocolError{"object size mismatch in pack"}
+		}
+		if err := objects.ValidateObject(objType, data); err != nil {
+			return 0, err
+		}
+		if _, err := quarantine.WriteObject(objType, data); err != nil {
+			return 0, err
+		}
+	}
+
+	expected := in.checksum.Sum(nil)
+	trailer := make([]byte, len(expected))
+	if _, err := io.ReadFull(r, trailer); err != nil {
+		return 0, err
+	}
+	if !bytes.Equal(trailer, expected) {
+		return 0, &ProtocolError{"pack checksum mismatch"}
+	}
+	return count, nil
+}
+
+// checksumReader hashes exactly the bytes consumed from the underlying reader. It implements io.ByteReader so that
+// the zlib decompressor does not read past the end of each compressed object.
+type checksumReader struct {
+	r        *bufio.Reader
+	checksum hash.Hash
+}
+
+func (c *checksumReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.checksum.Write(p[:n])
+	return n, err
+}
+
+func (c *checksumReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.checksum.Write([]byte{b})
+	}
+	return b, err
+}
@@ -0,0 +1,133 @@
+package remote_test
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"patchy/objects"
+	"patchy/objects/objecttype"
+	"patchy/repository"
+	"testing"
+)
+
+type packedObject struct {
+	objType objecttype.ObjectType
+	data    []byte
+}
+
+func (o packedObject) hash(t *testing.T) string {
+	t.Helper()
+	hash, err := objects.HashObject(o.objType, bytes.NewReader(o.data), int64(len(o.data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hash
+}
+
+// buildPack encodes objects the way the other side of a fetch sends them, checksum included.
+func buildPack(t *testing.T, packed ...packedObject) []byte {
+	t.Helper()
+	var pack bytes.Buffer
+	pack.WriteString("PACK")
+	_ = binary.Write(&pack, binary.BigEndian, uint32(1))
+	_ = binary.Write(&pack, binary.BigEndian, uint32(len(packed)))
+	for _, o := range packed {
+		pack.Write(binary.AppendUvarint([]byte{byte(o.objType)}, uint64(len(o.data))))
+		compressor := zlib.NewWriter(&pack)
+		if _, err := compressor.Write(o.data); err != nil {
+			t.Fatal(err)
+		}
+		if err := compressor.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	checksum := sha1.Sum(pack.Bytes())
+	pack.Write(checksum[:])
+	return pack.Bytes()
+}
+
+func treeWithEntry(t *testing.T, mode string, name string, hash string) packedObject {
+	t.Helper()
+	rawHash, err := hex.DecodeString(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := append([]byte(mode+"\x00"+name+"\x00"), rawHash...)
+	return packedObject{objecttype.Tree, data}
+}
+
+// fetchPack fetches want from a server which answers with the given pack, into a new repository.
+func fetchPack(t *testing.T, want string, pack []byte) (*repository.Repository, error) {
+	t.Helper()
+	client := newRepo(t)
+	var responses bytes.Buffer
+	for _, line := range []string{want + " refs/heads/main", "", "NAK", ""} {
+		if line == "" {
+			responses.WriteString("0000")
+		} else {
+			fmt.Fprintf(&responses, "%04x%s\n", len(line)+5, line)
+		}
+	}
+	responses.Write(pack)
+	transport, err := client.Remotes.NewConnTransport(&responses, io.Discard, func() error {
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client, transport.Fetch([]string{want})
+}
+
+func TestFetchPack(t *testing.T) {
+	blob := packedObject{objecttype.Blob, []byte("contents\n")}
+	tests := []struct {
+		name    string
+		pack    func() ([]byte, string)
+		wantErr bool
+	}{
+		{"well formed", func() ([]byte, string) {
+			tree := treeWithEntry(t, "100644", "file.txt", blob.hash(t))
+			return buildPack(t, blob, tree), tree.hash(t)
+		}, false},
+		{"tree entry leading out of the working tree", func() ([]byte, string) {
+			tree := treeWithEntry(t, "100644", "..", blob.hash(t))
+			return buildPack(t, blob, tree), tree.hash(t)
+		}, true},
+		{"tree entry into the repository directory", func() ([]byte, string) {
+			tree := treeWithEntry(t, "100644", ".patchy", blob.hash(t))
+			return buildPack(t, blob, tree), tree.hash(t)
+		}, true},
+		{"tree entry with a bad mode", func() ([]byte, string) {
+			tree := treeWithEntry(t, "120000", "link", blob.hash(t))
+			return buildPack(t, blob, tree), tree.hash(t)
+		}, true},
+		{"truncated", func() ([]byte, string) {
+			pack := buildPack(t, blob)
+			return pack[:len(pack)-5], blob.hash(t)
+		}, true},
+		{"corrupted checksum", func() ([]byte, string) {
+			pack := buildPack(t, blob)
+			pack[len(pack)-1] ^= 1
+			return pack, blob.hash(t)
+		}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pack, want := test.pack()
+			client, err := fetchPack(t, want, pack)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("fetch gave error %v, want an error: %v", err, test.wantErr)
+			}
+			// Nothing from a rejected pack may be left in the repository
+			for _, hash := range []string{blob.hash(t), want} {
+				if client.Objects.HasObject(hash) == test.wantErr {
+					t.Errorf("object %s stored: %v, want %v", hash, !test.wantErr, !test.wantErr)
+				}
+			}
+		})
+	}
+}
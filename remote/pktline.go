@@ -0,0 +1,70 @@
+package remote
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Protocol messages are framed as pkt-lines: four hex digits giving the length of the line including the prefix,
+// followed by the payload. The special line 0000 (a flush) marks the end of a section.
+
+const maxPktLen = 65520
+
+func writePkt(w io.Writer, format string, a ...any) error {
+	payload := fmt.Sprintf(format, a...)
+	if len(payload)+4 > maxPktLen {
+		return fmt.Errorf("writePkt: line too long")
+	}
+	_, err := fmt.Fprintf(w, "%04x%s", len(payload)+4, payload)
+	return err
+}
+
+func writeFlush(w io.Writer) error {
+	_, err := io.WriteString(w, "0000")
+	return err
+}
+
+// readPkt reads a single pkt-line without its trailing newline. A flush is reported as ok == false.
+func readPkt(r *bufio.Reader) (line string, ok bool, err error) {
+	prefix := make([]byte, 4)
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		return "", false, err
+	}
+	length, err := strconv.ParseUint(string(prefix), 16, 16)
+	if err != nil {
+		return "", false, &ProtocolError{"bad pkt-line length " + strconv.Quote(string(prefix))}
+	}
+	if length == 0 {
+		return "", false, nil
+	}
+	if length < 4 {
+		return "", false, &ProtocolError{"bad pkt-line length " + strconv.Quote(string(prefix))}
+	}
+	payload := make([]byte, length-4)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return "", false, err
+	}
+	line = strings.TrimSuffix(string(payload), "\n")
+	if strings.HasPrefix(line, "ERR ") {
+		return "", false, &RemoteError{strings.TrimPrefix(line, "ERR ")}
+	}
+	return line, true, nil
+}
+
+// readSection reads pkt-lines up to the next flush.
+func readSection(r *bufio.Reader) ([]string, error) {
+	lines := make([]string, 0)
+	for {
+		line, ok, err := readPkt(r)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return lines, nil
+		}
+		lines = append(lines, line)
+	}
+}
@@ -0,0 +1,166 @@
+package remote
+
+import (
+	"errors"
+	"fmt"
+	"patchy/hooks"
+	"patchy/refs"
+	"strings"
+)
+
+type PushResult struct {
+	Src string
+	Ref string
+	Old string
+	New string
+	Err error
+}
+
+type pushSpec struct {
+	src   string
+	dst   string
+	force bool
+}
+
+// Push updates refs of a remote to the local revisions given by specs, sending the objects they need. Unless noVerify is
+// set, the pre-push hook is run first and can refuse the whole push.
+func (c *Client) Push(nameOrURL string, specs []string, force bool, noVerify bool) ([]PushResult, error) {
+	r, err := c.resolveRemote(nameOrURL)
+	if err != nil {
+		return nil, fmt.Errorf("Push: %w", err)
+	}
+	parsedSpecs := make([]pushSpec, 0, len(specs))
+	for _, spec := range specs {
+		parsed, err := c.parsePushSpec(spec)
+		if err != nil {
+			return nil, fmt.Errorf("Push: %w", err)
+		}
+		parsed.force = parsed.force || force
+		parsedSpecs = append(parsedSpecs, *parsed)
+	}
+
+	t, err := c.Open(r.URL)
+	if err != nil {
+		return nil, fmt.Errorf("Push: %w", err)
+	}
+	defer func() {
+		_ = t.Close()
+	}()
+	ad, err := t.Advertise()
+	if err != nil {
+		return nil, fmt.Errorf("Push: %w", err)
+	}
+
+	results := make([]PushResult, 0, len(parsedSpecs))
+	updates := make([]RefUpdate, 0, len(parsedSpecs))
+	var hookInput strings.Builder
+	for _, spec := range parsedSpecs {
+		result := PushResult{Src: spec.src, Ref: spec.dst, Old: ad.Refs[spec.dst]}
+		if spec.src != "" {
+			if result.New, err = c.refs.ParseRev(spec.src); err != nil {
+				return nil, fmt.Errorf("Push: %w", err)
+			}
+		} else if result.Old == "" {
+			result.Err = &RefRejected{spec.dst, "remote ref does not exist"}
+		}
+		if result.Err == nil && result.Old != result.New && !spec.force {
+			result.Err = c.checkFastForward(spec.dst, result.Old, result.New)
+		}
+		if result.Err == nil && result.Old != result.New {
+			updates = append(updates, RefUpdate{spec.dst, result.Old, result.New, spec.force})
+			hookInput.WriteString(c.localRefName(spec.src) + " " + hooks.OrZeroHash(result.New) + " " + spec.dst + " " +
+				hooks.OrZeroHash(result.Old) + "\n")
+		}
+		results = append(results, result)
+	}
+	if len(updates) == 0 {
+		return results, nil
+	}
+	if !noVerify {
+		name := r.Name
+		if name == "" {
+			name = r.URL
+		}
+		if err := hooks.Run(c.repo, hooks.PrePush, hookInput.String(), name, r.URL); err != nil {
+			return nil, fmt.Errorf("Push: %w", err)
+		}
+	}
+
+	rejected, err := t.Push(updates)
+	if err != nil {
+		return nil, fmt.Errorf("Push: %w", err)
+	}
+	for i, result := range results {
+		if err, ok := rejected[result.Ref]; ok {
+			results[i].Err = err
+			continue
+		}
+		if result.Err != nil || r.Name == "" || !strings.HasPrefix(result.Ref, "refs/heads/") {
+			continue
+		}
+		trackingRef := trackingPrefix(r.Name) + strings.TrimPrefix(result.Ref, "refs/heads/")
+		if result.New == "" {
+			if err := c.refs.DeleteRef(trackingRef); err != nil && !errors.As(err, &refs.ErrInvalidRef) {
+				return nil, fmt.Errorf("Push: %w", err)
+			}
+		} else if err := c.refs.UpdateRef(trackingRef, result.New); err != nil {
+			return nil, fmt.Errorf("Push: %w", err)
+		}
+	}
+	return results, nil
+}
+
+// localRefName is how the pre-push hook is told about the source of an update: the full name of a branch, the
+// revision as given otherwise, or (delete) for deletions.
+func (c *Client) localRefName(src string) string {
+	if src == "" {
+		return "(delete)"
+	}
+	if _, err := c.refs.ResolveRef("refs/heads/" + src); err == nil && !strings.HasPrefix(src, "refs/") {
+		return "refs/heads/" + src
+	}
+	return src
+}
+
+func (c *Client) checkFastForward(ref string, old string, new string) error {
+	if old == "" || new == "" {
+		return nil
+	}
+	if !c.objects.HasObject(old) {
+		return &RefRejected{ref, "fetch first"}
+	}
+	isAncestor, err := c.objects.IsAncestor(old, new)
+	if err != nil {
+		return err
+	}
+	if !isAncestor {
+		return &RefRejected{ref, "non-fast-forward"}
+	}
+	return nil
+}
+
+func (c *Client) parsePushSpec(spec string) (*pushSpec, error) {
+	parsed := &pushSpec{}
+	if strings.HasPrefix(spec, "+") {
+		parsed.force = true
+		spec = spec[1:]
+	}
+	src, dst, hasDst := strings.Cut(spec, ":")
+	parsed.src = src
+	if !hasDst {
+		dst = src
+		if !strings.HasPrefix(src, "refs/") {
+			if _, err := c.refs.ResolveRef("refs/heads/" + src); err != nil {
+				return nil, fmt.Errorf("destination required for '%s'", spec)
+			}
+		}
+	}
+	if dst == "" {
+		return nil, fmt.Errorf("invalid refspec '%s'", spec)
+	}
+	if !strings.HasPrefix(dst, "refs/") {
+		dst = "refs/heads/" + dst
+	}
+	parsed.dst = dst
+	return parsed, nil
+}
@@ -0,0 +1,100 @@
+package remote
+
+import (
+	"errors"
+	"patchy/hooks"
+	"patchy/objects"
+	"patchy/objects/objecttype"
+	"patchy/refs"
+	"strings"
+)
+
+func advertiseAt(repoDir string) (*Advertisement, error) {
+	ad := &Advertisement{Refs: make(map[string]string)}
+	for _, prefix := range []string{"refs/heads/", "refs/tags/"} {
+		repoRefs, err := refs.ListRefsAt(repoDir, prefix)
+		if err != nil {
+			return nil, err
+		}
+		for ref, hash := range repoRefs {
+			ad.Refs[ref] = hash
+		}
+	}
+	head, err := refs.ReadHeadAt(repoDir)
+	if err != nil {
+		return nil, err
+	}
+	if !head.Detached {
+		ad.Head = head.Ref
+	}
+	return ad, nil
+}
+
+// applyRefUpdates applies pushed ref updates to the repository at repoDir, whose object store must already contain
+// the new commits. Updates that are refused are returned keyed by ref and leave the ref untouched.
+func applyRefUpdates(repoDir string, updates []RefUpdate) (map[string]error, error) {
+	checkedOut, err := refs.CheckedOutBranchesAt(repoDir)
+	if err != nil {
+		return nil, err
+	}
+	rejected := make(map[string]error)
+	for _, update := range updates {
+		if reason, err := checkRefUpdate(repoDir, update); err != nil {
+			return nil, err
+		} else if reason != "" {
+			rejected[update.Ref] = &RefRejected{update.Ref, reason}
+			continue
+		}
+		if _, ok := checkedOut[update.Ref]; ok {
+			rejected[update.Ref] = &RefRejected{update.Ref, "branch is currently checked out"}
+			continue
+		}
+		err := refs.TransactionAt(repoDir, update.Ref, update.Old, update.New, func() error {
+			if update.New == "" {
+				return refs.DeleteRefAt(repoDir, update.Ref)
+			}
+			return refs.UpdateRefAt(repoDir, update.Ref, update.New)
+		})
+		if errors.As(err, &hooks.ErrHookFailed) {
+			rejected[update.Ref] = &RefRejected{update.Ref, "hook declined"}
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	return rejected, nil
+}
+
+// isValidRef reports whether ref is a full ref name which is safe to use as a path inside a repository.
+func isValidRef(ref string) bool {
+	name, found := strings.CutPrefix(ref, "refs/")
+	return found && refs.ValidateBranchName(name) == nil
+}
+
+func checkRefUpdate(repoDir string, update RefUpdate) (string, error) {
+	if !isValidRef(update.Ref) {
+		return "invalid ref name", nil
+	}
+	current, err := refs.ReadRefAt(repoDir, update.Ref)
+	if err != nil {
+		return "", err
+	}
+	if current != update.Old {
+		return "stale info", nil
+	}
+	if update.New == "" {
+		return "", nil
+	}
+	if objType, _, err := objects.ReadObjectAt(repoDir, update.New); err != nil {
+		return "missing objects", nil
+	} else if objType != objecttype.Commit {
+		return "not a commit", nil
+	}
+	if update.Old != "" && !update.Force {
+		if isAncestor, err := objects.IsAncestorAt(repoDir, update.Old, update.New); err != nil {
+			return "", err
+		} else if !isAncestor {
+			return "non-fast-forward", nil
+		}
+	}
+	return "", nil
+}
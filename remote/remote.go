@@ -0,0 +1,205 @@
+package remote
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"patchy/config"
+	"patchy/objects"
+	"patchy/refs"
+	"patchy/repo"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+type Remote struct {
+	Name string
+	URL  string
+}
+
+// Client manages the remotes of a repository, and fetches from and pushes to them.
+type Client struct {
+	repo    *repo.Repository
+	objects *objects.Store
+	refs    *refs.Store
+}
+
+var defaultClient = &Client{objects: objects.DefaultStore(), refs: refs.DefaultStore()}
+
+func NewClient(r *repo.Repository, objectStore *objects.Store, refStore *refs.Store) *Client {
+	return &Client{repo: r, objects: objectStore, refs: refStore}
+}
+
+func AddRemote(name string, url string) error {
+	return defaultClient.AddRemote(name, url)
+}
+
+func RemoveRemote(name string) error {
+	return defaultClient.RemoveRemote(name)
+}
+
+func ListRemotes() ([]Remote, error) {
+	return defaultClient.ListRemotes()
+}
+
+func GetRemote(name string) (*Remote, error) {
+	return defaultClient.GetRemote(name)
+}
+
+func DefaultRemote() string {
+	return defaultClient.DefaultRemote()
+}
+
+func Fetch(remoteName string, prune bool) ([]TrackingUpdate, error) {
+	return defaultClient.Fetch(remoteName, prune)
+}
+
+func Push(nameOrURL string, specs []string, force bool, noVerify bool) ([]PushResult, error) {
+	return defaultClient.Push(nameOrURL, specs, force, noVerify)
+}
+
+func Open(url string) (Transport, error) {
+	return defaultClient.Open(url)
+}
+
+func NewConnTransport(in io.Reader, out io.Writer, close func() error) (Transport, error) {
+	return defaultClient.NewConnTransport(in, out, close)
+}
+
+func NewHTTPTransport(rawURL string, httpClient *http.Client) (Transport, error) {
+	return defaultClient.NewHTTPTransport(rawURL, httpClient)
+}
+
+func (c *Client) AddRemote(name string, url string) error {
+	if err := validateRemoteName(name); err != nil {
+		return fmt.Errorf("AddRemote: %w", err)
+	}
+	cfg, err := config.LoadRepo(c.repo)
+	if err != nil {
+		return fmt.Errorf("AddRemote: %w", err)
+	}
+	if cfg.HasSection("remote", name) {
+		return fmt.Errorf("AddRemote: %w", &RemoteExists{name})
+	}
+	cfg.Set("remote."+name+".url", normalizeURL(url))
+	if err := cfg.Save(); err != nil {
+		return fmt.Errorf("AddRemote: %w", err)
+	}
+	return nil
+}
+
+func (c *Client) RemoveRemote(name string) error {
+	cfg, err := config.LoadRepo(c.repo)
+	if err != nil {
+		return fmt.Errorf("RemoveRemote: %w", err)
+	}
+	if !cfg.RemoveSection("remote", name) {
+		return fmt.Errorf("RemoveRemote: %w", &NoSuchRemote{name})
+	}
+	if err := cfg.Save(); err != nil {
+		return fmt.Errorf("RemoveRemote: %w", err)
+	}
+	trackingRefs, err := c.refs.ListRefs(trackingPrefix(name))
+	if err != nil {
+		return fmt.Errorf("RemoveRemote: %w", err)
+	}
+	for ref := range trackingRefs {
+		if err := c.refs.DeleteRef(ref); err != nil {
+			return fmt.Errorf("RemoveRemote: %w", err)
+		}
+	}
+	return nil
+}
+
+func (c *Client) ListRemotes() ([]Remote, error) {
+	cfg, err := config.LoadRepo(c.repo)
+	if err != nil {
+		return nil, fmt.Errorf("ListRemotes: %w", err)
+	}
+	remotes := make([]Remote, 0)
+	for _, name := range cfg.Subsections("remote") {
+		url, _ := cfg.Get("remote." + name + ".url")
+		remotes = append(remotes, Remote{name, url})
+	}
+	sort.Slice(remotes, func(i, j int) bool {
+		return remotes[i].Name < remotes[j].Name
+	})
+	return remotes, nil
+}
+
+func (c *Client) GetRemote(name string) (*Remote, error) {
+	cfg, err := config.LoadRepo(c.repo)
+	if err != nil {
+		return nil, fmt.Errorf("GetRemote: %w", err)
+	}
+	url, ok := cfg.Get("remote." + name + ".url")
+	if !ok {
+		return nil, fmt.Errorf("GetRemote: %w", &NoSuchRemote{name})
+	}
+	return &Remote{name, url}, nil
+}
+
+// DefaultRemote is the remote of the current branch's upstream, falling back to origin.
+func (c *Client) DefaultRemote() string {
+	headState, err := c.refs.ReadHead()
+	if err != nil || headState.Detached {
+		return "origin"
+	}
+	remoteName, err := c.refs.UpstreamRemote(strings.TrimPrefix(headState.Ref, "refs/heads/"))
+	if err != nil || remoteName == "" || remoteName == "." {
+		return "origin"
+	}
+	return remoteName
+}
+
+// resolveRemote accepts either the name of a configured remote or a repository URL. The returned name is empty when a
+// URL was given directly, in which case no remote-tracking refs are maintained.
+func (c *Client) resolveRemote(nameOrURL string) (*Remote, error) {
+	if r, err := c.GetRemote(nameOrURL); err == nil {
+		return r, nil
+	}
+	if isSupportedURL(nameOrURL) {
+		return &Remote{"", nameOrURL}, nil
+	}
+	if _, err := repo.OpenRepoDir(nameOrURL); isLocalURL(nameOrURL) && err == nil {
+		return &Remote{"", nameOrURL}, nil
+	}
+	return nil, &NoSuchRemote{nameOrURL}
+}
+
+func trackingPrefix(name string) string {
+	return "refs/remotes/" + name + "/"
+}
+
+func validateRemoteName(name string) error {
+	if name == "" || strings.HasPrefix(name, "-") || strings.ContainsAny(name, " \t\n\\/:\"[]") ||
+		strings.Contains(name, "..") {
+		return &BadRemoteName{name}
+	}
+	return nil
+}
+
+func normalizeURL(url string) string {
+	if isLocalURL(url) {
+		if absPath, err := filepath.Abs(url); err == nil {
+			return absPath
+		}
+	}
+	return url
+}
+
+// withoutCredentials removes the user name and password from an HTTP URL, so that it can be saved in the config. SSH
+// URLs are left alone, as the user name is needed to log in and there is no password in them.
+func withoutCredentials(rawURL string) string {
+	if !strings.HasPrefix(rawURL, "http://") && !strings.HasPrefix(rawURL, "https://") {
+		return rawURL
+	}
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.User == nil {
+		return rawURL
+	}
+	parsed.User = nil
+	return parsed.String()
+}
@@ -0,0 +1,89 @@
+package remote_test
+
+import (
+	"os"
+	"patchy/objects"
+	"patchy/objects/objecttype"
+	"patchy/repo"
+	"patchy/repository"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newBareRepo creates an empty bare repository to serve, so that pushes to its checked out branch are not refused.
+func newBareRepo(t *testing.T) *repository.Repository {
+	t.Helper()
+	repoDir, err := repo.InitBareRepo(filepath.Join(t.TempDir(), "server.patchy"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := repository.Open(repoDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+// newRepo creates an empty repository with a working tree, which is reached only through the returned handle.
+func newRepo(t *testing.T) *repository.Repository {
+	t.Helper()
+	dir := t.TempDir()
+	if _, err := repo.InitRepo(dir); err != nil {
+		t.Fatal(err)
+	}
+	r, err := repository.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+// chdirTemp moves into a new temporary directory for the rest of the test, in which repositories can be cloned.
+func chdirTemp(t *testing.T) {
+	t.Helper()
+	t.Chdir(t.TempDir())
+}
+
+// commitFile commits a tree holding a single file on top of the branch's current commit and returns the new commit.
+func commitFile(t *testing.T, r *repository.Repository, branch string, name string, content string) string {
+	t.Helper()
+	blob, err := r.Objects.WriteObject(objecttype.Blob, []byte(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := r.Objects.BuildTree([]objects.TreeEntry{{Mode: "100644", Name: name, Hash: blob}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var parent *string
+	if current, err := r.Refs.ResolveRef("refs/heads/" + branch); err == nil {
+		parent = &current
+	}
+	commit, err := r.Objects.WriteCommitWithAuthor(tree, parent, "change "+name, "tester", time.Unix(1700000000, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Refs.UpdateRef("refs/heads/"+branch, commit); err != nil {
+		t.Fatal(err)
+	}
+	return commit
+}
+
+func resolveRef(t *testing.T, r *repository.Repository, ref string) string {
+	t.Helper()
+	hash, err := r.Refs.ResolveRef(ref)
+	if err != nil {
+		t.Fatalf("resolving %s: %v", ref, err)
+	}
+	return hash
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
@@ -0,0 +1,241 @@
+package remote
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"patchy/ignore"
+	"patchy/objects"
+	"patchy/repo"
+	"sort"
+	"strings"
+)
+
+// The smart protocol is a single exchange per connection. The server first advertises its refs:
+//
+//	head <ref>            (only when HEAD is a symbolic ref)
+//	<hash> <ref>          (one line per ref)
+//	flush
+//
+// The client then names a service, or sends a flush to hang up:
+//
+//	upload:  want <hash>... flush have <hash>... flush
+//	         server replies ACK <hash>... (or NAK) flush, followed by a pack of the objects the client lacks
+//	receive: update <old> <new> <ref> [force]... flush, followed by a pack of the objects the server lacks
+//	         server replies ok <ref> or ng <ref> <reason> for every update, then flush
+//
+// Missing old or new hashes are sent as forty zeros.
+
+const zeroHash = "0000000000000000000000000000000000000000"
+
+// Serve speaks the protocol over in and out on behalf of the repository r, or the default repository if it is nil.
+func Serve(r *repo.Repository, in io.Reader, out io.Writer) error {
+	w := bufio.NewWriter(out)
+	err := serve(r, bufio.NewReader(in), w)
+	if err != nil {
+		_ = writePkt(w, "ERR %s\n", err)
+	}
+	if flushErr := w.Flush(); err == nil {
+		err = flushErr
+	}
+	if err != nil {
+		return fmt.Errorf("Serve: %w", err)
+	}
+	return nil
+}
+
+func serve(target *repo.Repository, r *bufio.Reader, w *bufio.Writer) error {
+	repoDir, err := target.Dir()
+	if err != nil {
+		return err
+	}
+	if err := writeAdvertisement(w, repoDir); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	service, ok, err := readPkt(r)
+	if err == io.EOF || (err == nil && !ok) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	switch service {
+	case "upload":
+		return serveUpload(repoDir, r, w)
+	case "receive":
+		return serveReceive(repoDir, objects.NewStore(target, ignore.NewMatcher(target)), r, w)
+	default:
+		return &ProtocolError{"unknown service " + service}
+	}
+}
+
+func writeAdvertisement(w io.Writer, repoDir string) error {
+	ad, err := advertiseAt(repoDir)
+	if err != nil {
+		return err
+	}
+	if ad.Head != "" {
+		if err := writePkt(w, "head %s\n", ad.Head); err != nil {
+			return err
+		}
+	}
+	names := make([]string, 0, len(ad.Refs))
+	for ref := range ad.Refs {
+		names = append(names, ref)
+	}
+	sort.Strings(names)
+	for _, ref := range names {
+		if err := writePkt(w, "%s %s\n", ad.Refs[ref], ref); err != nil {
+			return err
+		}
+	}
+	return writeFlush(w)
+}
+
+func readAdvertisement(r *bufio.Reader) (*Advertisement, error) {
+	lines, err := readSection(r)
+	if err != nil {
+		return nil, err
+	}
+	ad := &Advertisement{Refs: make(map[string]string)}
+	for _, line := range lines {
+		first, second, found := strings.Cut(line, " ")
+		if !found {
+			return nil, &ProtocolError{"bad advertisement line " + line}
+		}
+		// The names and hashes end up in paths in the local repository, so nothing is taken on trust
+		if !isValidRef(second) {
+			return nil, &ProtocolError{"bad ref name " + second}
+		}
+		if first == "head" {
+			ad.Head = second
+		} else if objects.IsHash(first) {
+			ad.Refs[second] = first
+		} else {
+			return nil, &ProtocolError{"bad object id " + first}
+		}
+	}
+	return ad, nil
+}
+
+func serveUpload(repoDir string, r *bufio.Reader, w io.Writer) error {
+	wants, err := readHashes(r, "want")
+	if err != nil {
+		return err
+	}
+	haves, err := readHashes(r, "have")
+	if err != nil {
+		return err
+	}
+	for _, want := range wants {
+		if !objects.HasObjectAt(repoDir, want) {
+			return &ProtocolError{"not our ref " + want}
+		}
+	}
+
+	common := make([]string, 0)
+	for _, have := range haves {
+		if objects.HasObjectAt(repoDir, have) {
+			common = append(common, have)
+			if err := writePkt(w, "ACK %s\n", have); err != nil {
+				return err
+			}
+		}
+	}
+	if len(common) == 0 {
+		if err := writePkt(w, "NAK\n"); err != nil {
+			return err
+		}
+	}
+	if err := writeFlush(w); err != nil {
+		return err
+	}
+	missing, err := missingObjects(repoDir, wants, common)
+	if err != nil {
+		return err
+	}
+	return writePack(w, repoDir, missing)
+}
+
+// serveReceive applies a push to the repository at repoDir, storing the objects it sends in store, which must belong to
+// the same repository.
+func serveReceive(repoDir string, store *objects.Store, r *bufio.Reader, w io.Writer) error {
+	lines, err := readSection(r)
+	if err != nil {
+		return err
+	}
+	updates := make([]RefUpdate, 0, len(lines))
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) < 4 || fields[0] != "update" || !objects.IsHash(fields[1]) || !objects.IsHash(fields[2]) {
+			return &ProtocolError{"bad update line " + line}
+		}
+		update := RefUpdate{Ref: fields[3], Old: fields[1], New: fields[2], Force: len(fields) > 4 && fields[4] == "force"}
+		if update.Old == zeroHash {
+			update.Old = ""
+		}
+		if update.New == zeroHash {
+			update.New = ""
+		}
+		updates = append(updates, update)
+	}
+	if _, err := readPack(r, store); err != nil {
+		return err
+	}
+
+	rejected, err := applyRefUpdates(repoDir, updates)
+	if err != nil {
+		return err
+	}
+	for _, update := range updates {
+		if err, ok := rejected[update.Ref]; ok {
+			reason := err.Error()
+			var refErr *RefRejected
+			if errors.As(err, &refErr) {
+				reason = refErr.Reason
+			}
+			err = writePkt(w, "ng %s %s\n", update.Ref, reason)
+		} else {
+			err = writePkt(w, "ok %s\n", update.Ref)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return writeFlush(w)
+}
+
+func readHashes(r *bufio.Reader, keyword string) ([]string, error) {
+	lines, err := readSection(r)
+	if err != nil {
+		return nil, err
+	}
+	hashes := make([]string, 0, len(lines))
+	for _, line := range lines {
+		hash, found := strings.CutPrefix(line, keyword+" ")
+		if !found || !objects.IsHash(hash) {
+			return nil, &ProtocolError{"expected " + keyword + ", got " + line}
+		}
+		hashes = append(hashes, hash)
+	}
+	return hashes, nil
+}
+
+// missingObjects lists the objects reachable from wants but not from any of the commits the other side already has.
+func missingObjects(repoDir string, wants []string, common []string) ([]string, error) {
+	known, err := objects.ReachableObjects(repoDir, common, nil)
+	if err != nil {
+		return nil, err
+	}
+	knownSet := make(map[string]bool, len(known))
+	for _, hash := range known {
+		knownSet[hash] = true
+	}
+	return objects.ReachableObjects(repoDir, wants, func(hash string) bool {
+		return knownSet[hash]
+	})
+}
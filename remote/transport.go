@@ -0,0 +1,62 @@
+package remote
+
+import (
+	"net/http"
+	"strings"
+)
+
+type Advertisement struct {
+	Refs map[string]string
+	Head string
+}
+
+type RefUpdate struct {
+	Ref   string
+	Old   string
+	New   string
+	Force bool
+}
+
+type Transport interface {
+	Advertise() (*Advertisement, error)
+	Fetch(wants []string) error
+	// Push sends the objects needed by the updates and applies them. Updates refused by the remote are reported in the
+	// returned map, keyed by ref.
+	Push(updates []RefUpdate) (map[string]error, error)
+	Close() error
+}
+
+// Open connects to the repository at url, which is either a path on the local filesystem, an http(s):// URL served by
+// `patchy http-serve`, an ssh://[user@]host/path URL served by `patchy serve` on that host, or ext::<command> to talk
+// to the standard input and output of an arbitrary command, e.g. "ext::ssh host patchy serve repos/project".
+func (c *Client) Open(url string) (Transport, error) {
+	switch {
+	case strings.HasPrefix(url, "ext::"):
+		return c.openCommand(strings.Fields(strings.TrimPrefix(url, "ext::")))
+	case strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://"):
+		return c.NewHTTPTransport(url, http.DefaultClient)
+	case strings.HasPrefix(url, "ssh://"):
+		args, err := sshCommand(url)
+		if err != nil {
+			return nil, err
+		}
+		return c.openCommand(args)
+	case isLocalURL(url):
+		return c.openLocal(url)
+	default:
+		return nil, &UnsupportedURL{url}
+	}
+}
+
+func isLocalURL(url string) bool {
+	return !strings.Contains(url, "://") && !strings.HasPrefix(url, "ext::")
+}
+
+func isSupportedURL(url string) bool {
+	for _, prefix := range []string{"ext::", "ssh://", "http://", "https://"} {
+		if strings.HasPrefix(url, prefix) {
+			return true
+		}
+	}
+	return false
+}
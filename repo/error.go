@@ -10,8 +10,27 @@ func (e *FileNotInRepo) Error() string {
 	return "file " + e.Path + " is not inside this repository"
 }
 
+type NotARepo struct {
+	Path string
+}
+
+func (e *NotARepo) Error() string {
+	return e.Path + " is not a repository"
+}
+
+type AlreadyARepo struct {
+	Path string
+}
+
+func (e *AlreadyARepo) Error() string {
+	return e.Path + " is already a repository"
+}
+
 var (
-	ErrAlreadyInRepo = errors.New("current directory is already part of a repository")
+	ErrAlreadyInRepo = errors.New("directory is already part of a repository")
 	ErrNotInRepo     = errors.New("current directory is not inside of a repository")
+	ErrNoWorkTree    = errors.New("this operation must be run in a work tree")
 	ErrFileNotInRepo *FileNotInRepo
+	ErrNotARepo      *NotARepo
+	ErrAlreadyARepo  *AlreadyARepo
 )
@@ -6,8 +6,9 @@ import (
 	"path/filepath"
 )
 
+// InitRepo creates a repository with its working tree at path, which must not be inside another repository already.
 func InitRepo(path string) (string, error) {
-	if _, e := FindRepoDir(); e == nil {
+	if _, e := Discover(path); e == nil {
 		return "", fmt.Errorf("InitRepo: %w", ErrAlreadyInRepo)
 	}
 
@@ -16,23 +17,49 @@ func InitRepo(path string) (string, error) {
 		return "", fmt.Errorf("InitRepo: %w", err)
 	}
 
-	if err = os.MkdirAll(filepath.Join(repoPath, "objects"), os.ModePerm); err != nil {
+	if err = createLayout(repoPath); err != nil {
 		_ = os.RemoveAll(repoPath)
 		return "", fmt.Errorf("InitRepo: %w", err)
 	}
-	if err = os.MkdirAll(filepath.Join(repoPath, "refs", "heads"), os.ModePerm); err != nil {
-		_ = os.RemoveAll(repoPath)
-		return "", fmt.Errorf("InitRepo: %w", err)
+
+	return repoPath, nil
+}
+
+// InitBareRepo creates a repository without a working tree, laying out its objects and refs directly in path.
+func InitBareRepo(path string) (string, error) {
+	repoPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("InitBareRepo: %w", err)
 	}
-	if err = os.MkdirAll(filepath.Join(repoPath, "refs", "tags"), os.ModePerm); err != nil {
-		_ = os.RemoveAll(repoPath)
-		return "", fmt.Errorf("InitRepo: %w", err)
+	if filepath.Base(repoPath) == ".patchy" {
+		return "", fmt.Errorf("InitBareRepo: bare repository cannot be named .patchy")
+	}
+	if isRepoDir(repoPath) {
+		return "", fmt.Errorf("InitBareRepo: %w", &AlreadyARepo{Path: path})
 	}
 
-	if err = os.WriteFile(filepath.Join(repoPath, "HEAD"), []byte("ref: refs/heads/main"), 0644); err != nil {
-		_ = os.RemoveAll(repoPath)
-		return "", fmt.Errorf("InitRepo: %w", err)
+	if err = createLayout(repoPath); err != nil {
+		for _, name := range []string{"objects", "refs", "hooks", "HEAD"} {
+			_ = os.RemoveAll(filepath.Join(repoPath, name))
+		}
+		return "", fmt.Errorf("InitBareRepo: %w", err)
 	}
 
 	return repoPath, nil
 }
+
+func createLayout(repoPath string) error {
+	if err := os.MkdirAll(filepath.Join(repoPath, "objects"), os.ModePerm); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Join(repoPath, "refs", "heads"), os.ModePerm); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Join(repoPath, "refs", "tags"), os.ModePerm); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Join(repoPath, "hooks"), os.ModePerm); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(repoPath, "HEAD"), []byte("ref: refs/heads/main"), 0644)
+}
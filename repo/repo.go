@@ -5,46 +5,126 @@ import (
 	"os"
 	"patchy/util"
 	"path/filepath"
+	"sync"
 )
 
-var foundRepoDir = false
-var repoDir string
+// Repository holds the locations of a repository's directory and working tree. A nil *Repository stands for the
+// repository found from the working directory of the process, which is what the package level functions use. Bare
+// repositories have no working tree. Linked working trees share the directory of the repository they were added to, but
+// keep their own HEAD in a local directory under it.
+type Repository struct {
+	dir      string
+	localDir string
+	workTree string
+}
 
-func FindRepoDir() (string, error) {
-	if foundRepoDir {
-		return repoDir, nil
+// Environment variables which override where the default repository and its working tree are
+const (
+	DirEnv      = "PATCHY_DIR"
+	WorkTreeEnv = "PATCHY_WORK_TREE"
+)
+
+var defaultRepo *Repository
+var defaultRepoLock sync.Mutex
+
+// Open opens the repository at path, which is either a working tree containing a .patchy directory or the repository
+// directory itself.
+func Open(path string) (*Repository, error) {
+	if r, err := openLinked(path); err != nil {
+		return nil, fmt.Errorf("Open: %w", err)
+	} else if r != nil {
+		return r, nil
 	}
+	dir, err := OpenRepoDir(path)
+	if err != nil {
+		return nil, fmt.Errorf("Open: %w", err)
+	}
+	return newRepository(dir), nil
+}
 
-	dir, err := os.Getwd()
+// Discover finds the repository containing dir, searching its parents in turn. A directory which is itself a bare
+// repository is found as well.
+func Discover(dir string) (*Repository, error) {
+	dir, err := filepath.Abs(dir)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	for dir != filepath.Dir(dir) {
+		if r, err := openLinked(dir); err != nil {
+			return nil, err
+		} else if r != nil {
+			return r, nil
+		}
 		hasRepoDir, err := util.DoesFileExist(filepath.Join(dir, ".patchy"))
 		if err != nil {
-			return "", err
+			return nil, err
 		}
-
 		if hasRepoDir {
-			foundRepoDir = true
-			repoDir = filepath.Join(dir, ".patchy")
-			return repoDir, nil
+			repoDir := filepath.Join(dir, ".patchy")
+			return &Repository{dir: repoDir, localDir: repoDir, workTree: dir}, nil
+		}
+		if IsBareDir(dir) && isRepoDir(dir) {
+			return &Repository{dir: dir, localDir: dir}, nil
 		}
 		dir = filepath.Dir(dir)
 	}
-	return "", ErrNotInRepo
+	return nil, ErrNotInRepo
 }
 
-func FindRepoRoot() (string, error) {
-	repoDir, err := FindRepoDir()
-	if err != nil {
-		return "", err
+func newRepository(dir string) *Repository {
+	if IsBareDir(dir) {
+		return &Repository{dir: dir, localDir: dir}
 	}
-	return filepath.Dir(repoDir), nil
+	return &Repository{dir: dir, localDir: dir, workTree: filepath.Dir(dir)}
 }
 
-func IsFileInRepo(path string) (bool, error) {
-	repoRoot, err := FindRepoRoot()
+// IsBareDir reports whether a repository directory belongs to a bare repository, which is any repository directory not
+// named .patchy.
+func IsBareDir(dir string) bool {
+	return filepath.Base(dir) != ".patchy"
+}
+
+// Dir returns the directory holding the objects, refs and config of the repository, which all of its working trees
+// share.
+func (r *Repository) Dir() (string, error) {
+	if r == nil {
+		return FindRepoDir()
+	}
+	return r.dir, nil
+}
+
+// LocalDir returns the directory holding the HEAD of the working tree and the state of operations in progress in it.
+// It is the same as Dir except in linked working trees.
+func (r *Repository) LocalDir() (string, error) {
+	if r == nil {
+		return FindLocalDir()
+	}
+	return r.localDir, nil
+}
+
+// WorkTree returns the root of the working tree, failing with ErrNoWorkTree for bare repositories.
+func (r *Repository) WorkTree() (string, error) {
+	if r == nil {
+		return FindRepoRoot()
+	}
+	if r.workTree == "" {
+		return "", ErrNoWorkTree
+	}
+	return r.workTree, nil
+}
+
+func (r *Repository) IsBare() (bool, error) {
+	if r == nil {
+		var err error
+		if r, err = findDefault(); err != nil {
+			return false, err
+		}
+	}
+	return r.workTree == "", nil
+}
+
+func (r *Repository) IsFileInRepo(path string) (bool, error) {
+	repoRoot, err := r.WorkTree()
 	if err != nil {
 		return false, err
 	}
@@ -58,16 +138,125 @@ func IsFileInRepo(path string) (bool, error) {
 	return true, nil
 }
 
-func ValidateFileInRepo(path string) error {
+func (r *Repository) ValidateFileInRepo(path string) error {
 	if exists, err := util.DoesFileExist(path); err == nil && !exists {
 		return fmt.Errorf("file %s does not exist", path)
 	} else if !exists {
 		return err
 	}
-	if inRepo, err := IsFileInRepo(path); err != nil {
+	if inRepo, err := r.IsFileInRepo(path); err != nil {
 		return err
 	} else if !inRepo {
 		return &FileNotInRepo{Path: path}
 	}
 	return nil
 }
+
+func FindRepoDir() (string, error) {
+	r, err := findDefault()
+	if err != nil {
+		return "", err
+	}
+	return r.dir, nil
+}
+
+func FindLocalDir() (string, error) {
+	r, err := findDefault()
+	if err != nil {
+		return "", err
+	}
+	return r.localDir, nil
+}
+
+// findDefault finds the repository the package level functions work on. PATCHY_DIR and PATCHY_WORK_TREE name its
+// directory and working tree explicitly; otherwise it is searched for from the working directory of the process. With
+// only PATCHY_DIR set, the working directory is taken to be the working tree unless the repository is bare.
+func findDefault() (*Repository, error) {
+	defaultRepoLock.Lock()
+	defer defaultRepoLock.Unlock()
+	if defaultRepo != nil {
+		return defaultRepo, nil
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	var r *Repository
+	if dirEnv := os.Getenv(DirEnv); dirEnv != "" {
+		dir, err := filepath.Abs(dirEnv)
+		if err != nil {
+			return nil, err
+		}
+		if commonDir, ok := linkedCommonDir(dir); ok {
+			r = &Repository{dir: commonDir, localDir: dir, workTree: cwd}
+		} else if !isRepoDir(dir) {
+			return nil, &NotARepo{Path: dirEnv}
+		} else {
+			r = &Repository{dir: dir, localDir: dir, workTree: cwd}
+			if IsBareDir(dir) {
+				r.workTree = ""
+			}
+		}
+	} else if r, err = Discover(cwd); err != nil {
+		return nil, err
+	}
+	if workTreeEnv := os.Getenv(WorkTreeEnv); workTreeEnv != "" {
+		if r.workTree, err = filepath.Abs(workTreeEnv); err != nil {
+			return nil, err
+		}
+	}
+	defaultRepo = r
+	return r, nil
+}
+
+func OpenRepoDir(path string) (string, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	candidates := []string{filepath.Join(absPath, ".patchy"), absPath}
+	for _, dir := range candidates {
+		if isRepoDir(dir) {
+			return dir, nil
+		}
+	}
+	return "", &NotARepo{Path: path}
+}
+
+func isRepoDir(dir string) bool {
+	hasHead, err := util.DoesFileExist(filepath.Join(dir, "HEAD"))
+	if err != nil {
+		return false
+	}
+	hasObjects, err := util.DoesFileExist(filepath.Join(dir, "objects"))
+	return err == nil && hasHead && hasObjects
+}
+
+func FindRepoRoot() (string, error) {
+	r, err := findDefault()
+	if err != nil {
+		return "", err
+	}
+	return r.WorkTree()
+}
+
+func IsFileInRepo(path string) (bool, error) {
+	return (*Repository)(nil).IsFileInRepo(path)
+}
+
+func ValidateFileInRepo(path string) error {
+	return (*Repository)(nil).ValidateFileInRepo(path)
+}
+
+func ListWorkTrees() ([]WorkTreeInfo, error) {
+	return (*Repository)(nil).ListWorkTrees()
+}
+
+func AddWorkTree(path string) (*Repository, error) {
+	return (*Repository)(nil).AddWorkTree(path)
+}
+
+func RemoveWorkTree(name string) error {
+	return (*Repository)(nil).RemoveWorkTree(name)
+}
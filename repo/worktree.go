@@ -0,0 +1,177 @@
+package repo
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"patchy/util"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Linked working trees are registered in a directory of their own under the repository directory, which holds their
+// HEAD and the path of the .patchy file in the working tree that points back at it.
+const (
+	workTreesDir = "worktrees"
+	linkFile     = "patchydir"
+	linkPrefix   = "patchydir: "
+)
+
+// WorkTreeInfo describes one of the working trees of a repository.
+type WorkTreeInfo struct {
+	// Name is empty for the main working tree
+	Name string
+	// Path is the root of the working tree, or empty for the main working tree of a bare repository
+	Path string
+	// LocalDir holds the HEAD of the working tree
+	LocalDir string
+	// Prunable is set for linked working trees whose directory has gone missing
+	Prunable bool
+}
+
+// openLinked opens the linked working tree rooted at workTree, returning nil if workTree is not one.
+func openLinked(workTree string) (*Repository, error) {
+	workTree, err := filepath.Abs(workTree)
+	if err != nil {
+		return nil, err
+	}
+	link := filepath.Join(workTree, ".patchy")
+	info, err := os.Stat(link)
+	if errors.Is(err, os.ErrNotExist) || (err == nil && info.IsDir()) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(link)
+	if err != nil {
+		return nil, err
+	}
+	content := strings.TrimSpace(string(data))
+	if !strings.HasPrefix(content, linkPrefix) {
+		return nil, &NotARepo{Path: workTree}
+	}
+	localDir := strings.TrimPrefix(content, linkPrefix)
+	commonDir, ok := linkedCommonDir(localDir)
+	if !ok {
+		return nil, &NotARepo{Path: workTree}
+	}
+	return &Repository{dir: commonDir, localDir: localDir, workTree: workTree}, nil
+}
+
+// linkedCommonDir returns the repository directory a linked working tree's local directory belongs to.
+func linkedCommonDir(localDir string) (string, bool) {
+	if filepath.Base(filepath.Dir(localDir)) != workTreesDir {
+		return "", false
+	}
+	commonDir := filepath.Dir(filepath.Dir(localDir))
+	hasHead, err := util.DoesFileExist(filepath.Join(localDir, "HEAD"))
+	return commonDir, err == nil && hasHead && isRepoDir(commonDir)
+}
+
+// ListWorkTrees lists the working trees of the repository, starting with the main one.
+func (r *Repository) ListWorkTrees() ([]WorkTreeInfo, error) {
+	repoDir, err := r.Dir()
+	if err != nil {
+		return nil, fmt.Errorf("ListWorkTrees: %w", err)
+	}
+	main := WorkTreeInfo{LocalDir: repoDir}
+	if !IsBareDir(repoDir) {
+		main.Path = filepath.Dir(repoDir)
+	}
+	workTrees := []WorkTreeInfo{main}
+
+	entries, err := os.ReadDir(filepath.Join(repoDir, workTreesDir))
+	if errors.Is(err, os.ErrNotExist) {
+		return workTrees, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("ListWorkTrees: %w", err)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		localDir := filepath.Join(repoDir, workTreesDir, entry.Name())
+		data, err := os.ReadFile(filepath.Join(localDir, linkFile))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("ListWorkTrees: %w", err)
+		}
+		link := strings.TrimSpace(string(data))
+		workTree := WorkTreeInfo{Name: entry.Name(), LocalDir: localDir, Prunable: true}
+		if link != "" {
+			workTree.Path = filepath.Dir(link)
+			exists, err := util.DoesFileExist(link)
+			if err != nil {
+				return nil, fmt.Errorf("ListWorkTrees: %w", err)
+			}
+			workTree.Prunable = !exists
+		}
+		workTrees = append(workTrees, workTree)
+	}
+	return workTrees, nil
+}
+
+// AddWorkTree registers a new linked working tree rooted at path, which must either not exist yet or be an empty
+// directory, and returns the repository as seen from it. The HEAD of the new working tree is left for the caller to
+// write.
+func (r *Repository) AddWorkTree(path string) (*Repository, error) {
+	repoDir, err := r.Dir()
+	if err != nil {
+		return nil, fmt.Errorf("AddWorkTree: %w", err)
+	}
+	workTree, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("AddWorkTree: %w", err)
+	}
+	if entries, err := os.ReadDir(workTree); err == nil && len(entries) > 0 {
+		return nil, fmt.Errorf("AddWorkTree: '%s' already exists and is not an empty directory", path)
+	}
+
+	name := filepath.Base(workTree)
+	localDir := filepath.Join(repoDir, workTreesDir, name)
+	for i := 1; ; i++ {
+		if exists, err := util.DoesFileExist(localDir); err != nil {
+			return nil, fmt.Errorf("AddWorkTree: %w", err)
+		} else if !exists {
+			break
+		}
+		localDir = filepath.Join(repoDir, workTreesDir, name+strconv.Itoa(i))
+	}
+
+	if err := os.MkdirAll(localDir, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("AddWorkTree: %w", err)
+	}
+	if err := os.MkdirAll(workTree, os.ModePerm); err != nil {
+		_ = os.RemoveAll(localDir)
+		return nil, fmt.Errorf("AddWorkTree: %w", err)
+	}
+	link := filepath.Join(workTree, ".patchy")
+	if err := os.WriteFile(filepath.Join(localDir, linkFile), []byte(link+"\n"), 0644); err != nil {
+		_ = os.RemoveAll(localDir)
+		return nil, fmt.Errorf("AddWorkTree: %w", err)
+	}
+	if err := os.WriteFile(link, []byte(linkPrefix+localDir+"\n"), 0644); err != nil {
+		_ = os.RemoveAll(localDir)
+		return nil, fmt.Errorf("AddWorkTree: %w", err)
+	}
+	return &Repository{dir: repoDir, localDir: localDir, workTree: workTree}, nil
+}
+
+// RemoveWorkTree unregisters a linked working tree, leaving its files alone.
+func (r *Repository) RemoveWorkTree(name string) error {
+	repoDir, err := r.Dir()
+	if err != nil {
+		return fmt.Errorf("RemoveWorkTree: %w", err)
+	}
+	if name == "" || strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		return fmt.Errorf("RemoveWorkTree: invalid working tree name '%s'", name)
+	}
+	if err := os.RemoveAll(filepath.Join(repoDir, workTreesDir, name)); err != nil {
+		return fmt.Errorf("RemoveWorkTree: %w", err)
+	}
+	return nil
+}
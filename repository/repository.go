@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"fmt"
+	"patchy/config"
+	"patchy/diff"
+	"patchy/ignore"
+	"patchy/objects"
+	"patchy/refs"
+	"patchy/remote"
+	"patchy/repo"
+	"patchy/sequencer"
+)
+
+// Repository bundles the paths, stores and caches of one repository, so that any number of repositories can be worked
+// with side by side in the same process, independently of its working directory.
+type Repository struct {
+	*repo.Repository
+	Ignore    *ignore.Matcher
+	Objects   *objects.Store
+	Refs      *refs.Store
+	Diff      *diff.Differ
+	Sequencer *sequencer.Sequencer
+	Remotes   *remote.Client
+}
+
+// Open opens the repository at path, which is either a working tree containing a .patchy directory or the repository
+// directory itself.
+func Open(path string) (*Repository, error) {
+	r, err := repo.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Open: %w", err)
+	}
+	return New(r), nil
+}
+
+// Discover opens the repository containing dir.
+func Discover(dir string) (*Repository, error) {
+	r, err := repo.Discover(dir)
+	if err != nil {
+		return nil, fmt.Errorf("Discover: %w", err)
+	}
+	return New(r), nil
+}
+
+func New(r *repo.Repository) *Repository {
+	matcher := ignore.NewMatcher(r)
+	objectStore := objects.NewStore(r, matcher)
+	refStore := refs.NewStore(r, objectStore)
+	differ := diff.NewDiffer(r, objectStore, refStore)
+	return &Repository{
+		Repository: r,
+		Ignore:     matcher,
+		Objects:    objectStore,
+		Refs:       refStore,
+		Diff:       differ,
+		Sequencer:  sequencer.NewSequencer(r, objectStore, refStore, differ),
+		Remotes:    remote.NewClient(r, objectStore, refStore),
+	}
+}
+
+// Config loads the current config of the repository. It is read afresh each time, so changes made since are seen.
+func (r *Repository) Config() (*config.Config, error) {
+	cfg, err := config.LoadRepo(r.Repository)
+	if err != nil {
+		return nil, fmt.Errorf("Config: %w", err)
+	}
+	return cfg, nil
+}
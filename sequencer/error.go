@@ -0,0 +1,63 @@
+package sequencer
+
+import "strings"
+
+type OperationInProgress struct {
+	Operation string
+}
+
+func (e *OperationInProgress) Error() string {
+	return "a " + e.Operation + " is already in progress"
+}
+
+type NoOperationInProgress struct {
+	Operation string
+}
+
+func (e *NoOperationInProgress) Error() string {
+	return "no " + e.Operation + " in progress"
+}
+
+type LocalChanges struct {
+	Paths []string
+}
+
+func (e *LocalChanges) Error() string {
+	return "your local changes to the following files would be overwritten:\n    " +
+		strings.Join(e.Paths, "\n    ") + "\nplease commit them first"
+}
+
+type StoppedOnConflict struct {
+	Commit  string
+	Subject string
+}
+
+func (e *StoppedOnConflict) Error() string {
+	return "could not apply " + e.Commit[:7] + "... " + e.Subject
+}
+
+type UnresolvedConflicts struct {
+	Paths []string
+}
+
+func (e *UnresolvedConflicts) Error() string {
+	return "conflict markers remain in: " + strings.Join(e.Paths, ", ")
+}
+
+type BadTodo struct {
+	Line   string
+	Reason string
+}
+
+func (e *BadTodo) Error() string {
+	return "bad todo line '" + e.Line + "': " + e.Reason
+}
+
+var (
+	ErrOperationInProgress   *OperationInProgress
+	ErrNoOperationInProgress *NoOperationInProgress
+	ErrLocalChanges          *LocalChanges
+	ErrStoppedOnConflict     *StoppedOnConflict
+	ErrUnresolvedConflicts   *UnresolvedConflicts
+	ErrBadTodo               *BadTodo
+)
@@ -0,0 +1,229 @@
+package sequencer
+
+import (
+	"fmt"
+	"os"
+	"patchy/util"
+	"path/filepath"
+	"strings"
+)
+
+const todoHelp = `
+# Commands:
+# p, pick <commit> = use commit
+# r, reword <commit> = use commit, but edit the commit message
+# e, edit <commit> = use commit, but stop for amending
+# s, squash <commit> = use commit, but meld into previous commit
+# f, fixup <commit> = like "squash", but discard this commit's message
+# d, drop <commit> = remove commit
+#
+# These lines can be re-ordered; they are executed from top to bottom.
+# If you remove everything, the rebase will be aborted.
+`
+
+// Rebase replays the commits of HEAD which are not reachable from upstream on top of onto, or upstream itself if onto
+// is empty, and then moves the branch being rebased to the result. With interactive, the list of commits to replay is
+// opened in the editor first, so that they can be reordered, dropped, reworded, squashed or stopped at for editing.
+func (sq *Sequencer) Rebase(upstream string, onto string, interactive bool) error {
+	if err := sq.rebase(upstream, onto, interactive); err != nil {
+		return fmt.Errorf("Rebase: %w", err)
+	}
+	return nil
+}
+
+// ContinueRebase commits the resolved working tree for the commit that stopped on a conflict, or amends the commit
+// that was stopped at for editing, then replays the rest.
+func (sq *Sequencer) ContinueRebase() error {
+	s, err := sq.resume(rebaseDir)
+	if err != nil {
+		return fmt.Errorf("ContinueRebase: %w", err)
+	}
+	if err := s.continueOperation(); err != nil {
+		return fmt.Errorf("ContinueRebase: %w", err)
+	}
+	return nil
+}
+
+// SkipRebase drops the commit that stopped on a conflict and replays the rest.
+func (sq *Sequencer) SkipRebase() error {
+	s, err := sq.resume(rebaseDir)
+	if err != nil {
+		return fmt.Errorf("SkipRebase: %w", err)
+	}
+	if err := s.skipOperation(); err != nil {
+		return fmt.Errorf("SkipRebase: %w", err)
+	}
+	return nil
+}
+
+// AbortRebase checks out the branch being rebased again, as it was before the rebase started.
+func (sq *Sequencer) AbortRebase() error {
+	s, err := sq.resume(rebaseDir)
+	if err != nil {
+		return fmt.Errorf("AbortRebase: %w", err)
+	}
+	if err := s.abortOperation(); err != nil {
+		return fmt.Errorf("AbortRebase: %w", err)
+	}
+	return nil
+}
+
+func (sq *Sequencer) rebase(upstream string, onto string, interactive bool) error {
+	if err := sq.checkNoOperation(); err != nil {
+		return err
+	}
+	head, headCommit, err := sq.readHeadCommit()
+	if err != nil {
+		return err
+	}
+	if err := sq.checkClean(); err != nil {
+		return err
+	}
+	upstreamHash, err := sq.refs.ParseRev(upstream)
+	if err != nil {
+		return err
+	}
+	ontoHash := upstreamHash
+	if onto != "" {
+		if ontoHash, err = sq.refs.ParseRev(onto); err != nil {
+			return err
+		}
+	}
+	ontoCommit, err := sq.objects.ReadCommit(ontoHash)
+	if err != nil {
+		return err
+	}
+	mergeBase, err := sq.objects.MergeBase(head.Commit, upstreamHash)
+	if err != nil {
+		return err
+	}
+	if !interactive && mergeBase == ontoHash {
+		name := "HEAD"
+		if !head.Detached {
+			name = strings.TrimPrefix(head.Ref, "refs/heads/")
+		}
+		util.Printf("Current branch %s is up to date.\n", name)
+		return nil
+	}
+
+	dir, err := sq.stateDir(rebaseDir)
+	if err != nil {
+		return err
+	}
+	s := &state{seq: sq, dir: dir, origHead: head.Commit}
+	if !head.Detached {
+		s.headName = head.Ref
+	}
+	commits, err := sq.commitsSince(mergeBase, head.Commit)
+	if err != nil {
+		return err
+	}
+	for _, commitHash := range commits {
+		s.todo = append(s.todo, Step{ActionPick, commitHash})
+	}
+	if interactive {
+		if err := s.editTodo(ontoHash); err != nil {
+			_ = s.remove()
+			return err
+		}
+		if len(s.todo) == 0 {
+			util.Println("Nothing to do")
+			return s.remove()
+		}
+	}
+
+	// Replay onto a detached HEAD, so that the branch is only moved once everything has been applied
+	if err := s.save(); err != nil {
+		return err
+	}
+	repoRoot, err := sq.repo.WorkTree()
+	if err != nil {
+		return err
+	}
+	if err := sq.objects.CheckoutTree(headCommit.Tree, ontoCommit.Tree, repoRoot); err != nil {
+		return err
+	}
+	if err := sq.refs.UpdateHead(ontoHash); err != nil {
+		return err
+	}
+	return s.run()
+}
+
+// editTodo opens the todo list in the editor and replaces it with the edited version.
+func (s *state) editTodo(ontoHash string) error {
+	if err := os.MkdirAll(s.dir, os.ModePerm); err != nil {
+		return err
+	}
+	path := filepath.Join(s.dir, "todo")
+	help := fmt.Sprintf("\n# Rebase %s onto %s (%d commands)\n#", s.origHead[:7], ontoHash[:7], len(s.todo))
+	if err := os.WriteFile(path, []byte(s.seq.formatTodo(s.todo, true)+help+todoHelp), 0644); err != nil {
+		return err
+	}
+	if err := util.EditFile(path); err != nil {
+		return err
+	}
+	lines, err := util.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	todo, err := s.seq.parseTodo(lines)
+	if err != nil {
+		return err
+	}
+	for _, step := range todo {
+		if step.Action == ActionRevert {
+			return &BadTodo{step.Action.String() + " " + step.Commit[:7], "revert cannot be used when rebasing"}
+		}
+		if step.Action == ActionDrop {
+			continue
+		}
+		if step.Action == ActionSquash || step.Action == ActionFixup {
+			return &BadTodo{
+				step.Action.String() + " " + step.Commit[:7],
+				"cannot '" + step.Action.String() + "' without a previous commit"}
+		}
+		break
+	}
+	s.todo = todo
+	return nil
+}
+
+func (s *state) finishRebase() error {
+	if s.headName == "" {
+		util.Println("Successfully rebased.")
+		return nil
+	}
+	head, err := s.seq.refs.ReadHead()
+	if err != nil {
+		return err
+	}
+	if err := s.seq.refs.UpdateRef(s.headName, head.Commit); err != nil {
+		return err
+	}
+	if err := s.seq.refs.UpdateHead(strings.TrimPrefix(s.headName, "refs/heads/")); err != nil {
+		return err
+	}
+	util.Printf("Successfully rebased and updated %s.\n", s.headName)
+	return nil
+}
+
+// commitsSince lists the commits from tip back to, but not including, base in the order they were made. An empty
+// base lists the whole history of tip.
+func (sq *Sequencer) commitsSince(base string, tip string) ([]string, error) {
+	commits := make([]string, 0)
+	for hash := tip; hash != "" && hash != base; {
+		commits = append(commits, hash)
+		commit, err := sq.objects.ReadCommit(hash)
+		if err != nil {
+			return nil, err
+		}
+		hash = ""
+		if commit.Parent != nil {
+			hash = *commit.Parent
+		}
+	}
+	for i, j := 0, len(commits)-1; i < j; i, j = i+1, j-1 {
+		commits[i], commits[j] = commits[j], commits[i]
+	}
+	return commits, nil
+}
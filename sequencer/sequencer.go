@@ -0,0 +1,526 @@
+package sequencer
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"patchy/commitmsg"
+	"patchy/diff"
+	"patchy/objects"
+	"patchy/refs"
+	"patchy/repo"
+	"patchy/util"
+	"path/filepath"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+// Sequencer applies sequences of commits to a repository for cherry-pick, revert and rebase, keeping their state in the
+// local directory of the repository so that they can be resumed after a conflict.
+type Sequencer struct {
+	repo    *repo.Repository
+	objects *objects.Store
+	refs    *refs.Store
+	diff    *diff.Differ
+}
+
+var defaultSequencer = &Sequencer{objects: objects.DefaultStore(), refs: refs.DefaultStore(), diff: diff.DefaultDiffer()}
+
+func NewSequencer(r *repo.Repository, objectStore *objects.Store, refStore *refs.Store, differ *diff.Differ) *Sequencer {
+	return &Sequencer{repo: r, objects: objectStore, refs: refStore, diff: differ}
+}
+
+func CherryPick(revSpecs []string) error {
+	return defaultSequencer.CherryPick(revSpecs)
+}
+
+func Revert(revSpecs []string) error {
+	return defaultSequencer.Revert(revSpecs)
+}
+
+func Continue() error {
+	return defaultSequencer.Continue()
+}
+
+func Skip() error {
+	return defaultSequencer.Skip()
+}
+
+func Abort() error {
+	return defaultSequencer.Abort()
+}
+
+func Rebase(upstream string, onto string, interactive bool) error {
+	return defaultSequencer.Rebase(upstream, onto, interactive)
+}
+
+func ContinueRebase() error {
+	return defaultSequencer.ContinueRebase()
+}
+
+func SkipRebase() error {
+	return defaultSequencer.SkipRebase()
+}
+
+func AbortRebase() error {
+	return defaultSequencer.AbortRebase()
+}
+
+// CherryPick applies the changes introduced by each of the given commits onto HEAD, creating a new commit for each
+// with the original message and author.
+func (sq *Sequencer) CherryPick(revSpecs []string) error {
+	if err := sq.start(ActionPick, revSpecs); err != nil {
+		return fmt.Errorf("CherryPick: %w", err)
+	}
+	return nil
+}
+
+// Revert undoes the changes introduced by each of the given commits, creating a new commit for each.
+func (sq *Sequencer) Revert(revSpecs []string) error {
+	if err := sq.start(ActionRevert, revSpecs); err != nil {
+		return fmt.Errorf("Revert: %w", err)
+	}
+	return nil
+}
+
+// Continue commits the resolved working tree for the commit that stopped on a conflict, then applies the rest.
+func (sq *Sequencer) Continue() error {
+	s, err := sq.resume(sequencerDir)
+	if err != nil {
+		return fmt.Errorf("Continue: %w", err)
+	}
+	if err := s.continueOperation(); err != nil {
+		return fmt.Errorf("Continue: %w", err)
+	}
+	return nil
+}
+
+// Skip discards the changes of the commit that stopped on a conflict and applies the rest.
+func (sq *Sequencer) Skip() error {
+	s, err := sq.resume(sequencerDir)
+	if err != nil {
+		return fmt.Errorf("Skip: %w", err)
+	}
+	if err := s.skipOperation(); err != nil {
+		return fmt.Errorf("Skip: %w", err)
+	}
+	return nil
+}
+
+// Abort moves HEAD and the working tree back to where they were before the operation started.
+func (sq *Sequencer) Abort() error {
+	s, err := sq.resume(sequencerDir)
+	if err != nil {
+		return fmt.Errorf("Abort: %w", err)
+	}
+	if err := s.abortOperation(); err != nil {
+		return fmt.Errorf("Abort: %w", err)
+	}
+	return nil
+}
+
+func (sq *Sequencer) start(action Action, revSpecs []string) error {
+	if err := sq.checkNoOperation(); err != nil {
+		return err
+	}
+	head, err := sq.refs.ReadHead()
+	if err != nil {
+		return err
+	}
+	if head.Commit == "" {
+		return &refs.InvalidRevSpec{RevSpec: "HEAD"}
+	}
+	if err := sq.checkClean(); err != nil {
+		return err
+	}
+	dir, err := sq.stateDir(sequencerDir)
+	if err != nil {
+		return err
+	}
+	s := &state{seq: sq, dir: dir, origHead: head.Commit}
+	for _, revSpec := range revSpecs {
+		commitHash, err := sq.refs.ParseRev(revSpec)
+		if err != nil {
+			return err
+		}
+		s.todo = append(s.todo, Step{action, commitHash})
+	}
+	return s.run()
+}
+
+// checkNoOperation fails if a cherry-pick, revert or rebase has stopped and not been finished yet.
+func (sq *Sequencer) checkNoOperation() error {
+	for _, dirName := range []string{sequencerDir, rebaseDir} {
+		if s, err := sq.loadState(dirName); err != nil {
+			return err
+		} else if s != nil {
+			return &OperationInProgress{s.operation()}
+		}
+	}
+	return nil
+}
+
+func (sq *Sequencer) resume(dirName string) (*state, error) {
+	s, err := sq.loadState(dirName)
+	if err != nil {
+		return nil, err
+	} else if s == nil {
+		return nil, &NoOperationInProgress{operationName(dirName)}
+	}
+	return s, nil
+}
+
+// run applies the steps of the todo list in order, saving the state before each one so that a conflict leaves
+// everything needed to resume. The state is removed once every step has been applied.
+func (s *state) run() error {
+	for len(s.todo) > 0 {
+		step := s.todo[0]
+		if err := s.save(); err != nil {
+			return err
+		}
+		if step.Action == ActionDrop {
+			s.todo = s.todo[1:]
+			continue
+		}
+		conflicts, err := s.seq.applyStep(step)
+		if err != nil {
+			return err
+		}
+		if len(conflicts) > 0 {
+			for _, conflict := range conflicts {
+				s.conflicts = append(s.conflicts, conflict.Path)
+			}
+			if err := s.save(); err != nil {
+				return err
+			}
+			commit, err := s.seq.objects.ReadCommit(step.Commit)
+			if err != nil {
+				return err
+			}
+			return &StoppedOnConflict{step.Commit, commitSubject(commit)}
+		}
+		s.todo = s.todo[1:]
+		if step.Action == ActionEdit {
+			return s.stopForEdit(step)
+		}
+	}
+	if s.rebasing() {
+		if err := s.finishRebase(); err != nil {
+			return err
+		}
+	}
+	return s.remove()
+}
+
+func (s *state) stopForEdit(step Step) error {
+	head, err := s.seq.refs.ReadHead()
+	if err != nil {
+		return err
+	}
+	s.amend = head.Commit
+	if err := s.save(); err != nil {
+		return err
+	}
+	commit, err := s.seq.objects.ReadCommit(step.Commit)
+	if err != nil {
+		return err
+	}
+	util.Printf("Stopped at %s... %s\n", step.Commit[:7], commitSubject(commit))
+	util.Println("You can amend the commit now, then run 'patchy rebase --continue'.")
+	return nil
+}
+
+func (s *state) continueOperation() error {
+	if s.amend != "" {
+		if err := s.seq.amendHead(s.amend); err != nil {
+			return err
+		}
+		s.amend = ""
+		return s.run()
+	}
+	if len(s.todo) == 0 {
+		return s.run()
+	}
+	unresolved, err := s.seq.unresolvedConflicts(s.conflicts)
+	if err != nil {
+		return err
+	} else if len(unresolved) > 0 {
+		return &UnresolvedConflicts{unresolved}
+	}
+	repoRoot, err := s.seq.repo.WorkTree()
+	if err != nil {
+		return err
+	}
+	tree, err := s.seq.objects.WriteTree(repoRoot)
+	if err != nil {
+		return err
+	}
+	head, headCommit, err := s.seq.readHeadCommit()
+	if err != nil {
+		return err
+	}
+	if tree != headCommit.Tree {
+		if err := s.seq.commitStep(s.todo[0], tree, head); err != nil {
+			return err
+		}
+	}
+	s.todo, s.conflicts = s.todo[1:], nil
+	return s.run()
+}
+
+func (s *state) skipOperation() error {
+	_, headCommit, err := s.seq.readHeadCommit()
+	if err != nil {
+		return err
+	}
+	if err := s.seq.resetWorkingTree(headCommit.Tree); err != nil {
+		return err
+	}
+	if s.amend != "" {
+		s.amend = ""
+	} else if len(s.todo) > 0 {
+		s.todo = s.todo[1:]
+	}
+	s.conflicts = nil
+	return s.run()
+}
+
+func (s *state) abortOperation() error {
+	origCommit, err := s.seq.objects.ReadCommit(s.origHead)
+	if err != nil {
+		return err
+	}
+	if err := s.seq.resetWorkingTree(origCommit.Tree); err != nil {
+		return err
+	}
+	if s.rebasing() {
+		// The branch itself is only moved once a rebase finishes, so HEAD just needs to go back to it
+		target := s.origHead
+		if s.headName != "" {
+			target = strings.TrimPrefix(s.headName, "refs/heads/")
+		}
+		if err := s.seq.refs.UpdateHead(target); err != nil {
+			return err
+		}
+	} else {
+		head, err := s.seq.refs.ReadHead()
+		if err != nil {
+			return err
+		}
+		if err := s.seq.moveHead(head, s.origHead); err != nil {
+			return err
+		}
+	}
+	return s.remove()
+}
+
+// applyStep merges the changes of a step into HEAD and the working tree and commits the result. If the changes
+// conflict, the working tree is left with conflict markers and nothing is committed.
+func (sq *Sequencer) applyStep(step Step) ([]diff.Conflict, error) {
+	repoRoot, err := sq.repo.WorkTree()
+	if err != nil {
+		return nil, err
+	}
+	head, headCommit, err := sq.readHeadCommit()
+	if err != nil {
+		return nil, err
+	}
+	commit, err := sq.objects.ReadCommit(step.Commit)
+	if err != nil {
+		return nil, err
+	}
+	parentTree, err := sq.parentTree(commit)
+	if err != nil {
+		return nil, err
+	}
+	baseTree, theirsTree := parentTree, commit.Tree
+	theirsLabel := step.Commit[:7] + " (" + commitSubject(commit) + ")"
+	if step.Action == ActionRevert {
+		baseTree, theirsTree = theirsTree, baseTree
+		theirsLabel = "parent of " + theirsLabel
+	}
+	result, err := sq.diff.MergeTrees(baseTree, headCommit.Tree, theirsTree, "HEAD", theirsLabel)
+	if err != nil {
+		return nil, err
+	}
+	if err := sq.objects.CheckoutTree(headCommit.Tree, result.Tree, repoRoot); err != nil {
+		return nil, err
+	}
+	if len(result.Conflicts) > 0 {
+		for _, conflict := range result.Conflicts {
+			util.ColorPrintf(color.FgRed, "CONFLICT (%s): %s\n", conflict.Kind, conflict.Path)
+		}
+		return result.Conflicts, nil
+	}
+	if result.Tree == headCommit.Tree {
+		util.Printf("Skipping %s: its changes are already present\n", step.Commit[:7])
+		return nil, nil
+	}
+	return nil, sq.commitStep(step, result.Tree, head)
+}
+
+// commitStep commits tree as the result of a step. Squashes and fixups replace HEAD with a commit combining it with
+// the step's changes rather than adding a new one.
+func (sq *Sequencer) commitStep(step Step, tree string, head *refs.HeadState) error {
+	commit, err := sq.objects.ReadCommit(step.Commit)
+	if err != nil {
+		return err
+	}
+	parent := &head.Commit
+	message, author, authorTime := commit.Message, commit.Author, commit.Time
+	switch step.Action {
+	case ActionReword:
+		message, err = commitmsg.Edit(sq.repo, commit.Message)
+	case ActionSquash, ActionFixup:
+		var headCommit *objects.Commit
+		if headCommit, err = sq.objects.ReadCommit(head.Commit); err != nil {
+			return err
+		}
+		parent = headCommit.Parent
+		message, author, authorTime = headCommit.Message, headCommit.Author, headCommit.Time
+		if step.Action == ActionSquash {
+			message, err = commitmsg.Edit(sq.repo, headCommit.Message+"\n\n"+commit.Message)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	var hash string
+	if step.Action == ActionRevert {
+		message = fmt.Sprintf("Revert \"%s\"\n\nThis reverts commit %s.", commitSubject(commit), step.Commit)
+		hash, err = sq.objects.WriteCommit(tree, parent, message)
+	} else {
+		hash, err = sq.objects.WriteCommitWithAuthor(tree, parent, message, author, authorTime)
+	}
+	if err != nil {
+		return err
+	}
+	if err := sq.moveHead(head, hash); err != nil {
+		return err
+	}
+	branchName := "detached HEAD"
+	if !head.Detached {
+		branchName = strings.TrimPrefix(head.Ref, "refs/heads/")
+	}
+	util.ColorPrintf(color.FgCyan, "[%s %s] ", branchName, hash[:7])
+	util.Println(strings.SplitN(message, "\n", 2)[0])
+	return nil
+}
+
+// amendHead replaces the commit a rebase stopped at for editing with one containing the working tree, unless HEAD has
+// moved on since.
+func (sq *Sequencer) amendHead(stoppedAt string) error {
+	head, headCommit, err := sq.readHeadCommit()
+	if err != nil || head.Commit != stoppedAt {
+		return err
+	}
+	repoRoot, err := sq.repo.WorkTree()
+	if err != nil {
+		return err
+	}
+	tree, err := sq.objects.WriteTree(repoRoot)
+	if err != nil || tree == headCommit.Tree {
+		return err
+	}
+	hash, err := sq.objects.WriteCommitWithAuthor(
+		tree, headCommit.Parent, headCommit.Message, headCommit.Author, headCommit.Time)
+	if err != nil {
+		return err
+	}
+	return sq.moveHead(head, hash)
+}
+
+// moveHead points the current branch at the commit, or HEAD itself if it is detached.
+func (sq *Sequencer) moveHead(head *refs.HeadState, commitHash string) error {
+	if head.Detached {
+		return sq.refs.UpdateHead(commitHash)
+	}
+	return sq.refs.UpdateRef(head.Ref, commitHash)
+}
+
+func (sq *Sequencer) readHeadCommit() (*refs.HeadState, *objects.Commit, error) {
+	head, err := sq.refs.ReadHead()
+	if err != nil {
+		return nil, nil, err
+	}
+	commit, err := sq.objects.ReadCommit(head.Commit)
+	if err != nil {
+		return nil, nil, err
+	}
+	return head, commit, nil
+}
+
+func (sq *Sequencer) parentTree(commit *objects.Commit) (string, error) {
+	if commit.Parent == nil {
+		return sq.objects.BuildTree(nil)
+	}
+	parent, err := sq.objects.ReadCommit(*commit.Parent)
+	if err != nil {
+		return "", err
+	}
+	return parent.Tree, nil
+}
+
+// resetWorkingTree discards every change in the working tree, making it match the given tree.
+func (sq *Sequencer) resetWorkingTree(tree string) error {
+	repoRoot, err := sq.repo.WorkTree()
+	if err != nil {
+		return err
+	}
+	currentTree, err := sq.objects.WriteTree(repoRoot)
+	if err != nil {
+		return err
+	}
+	return sq.objects.CheckoutTree(currentTree, tree, repoRoot)
+}
+
+func (sq *Sequencer) checkClean() error {
+	changes, err := sq.diff.WorkingTreeDiff()
+	if err != nil {
+		return err
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	paths := make([]string, 0, len(changes))
+	for _, change := range changes {
+		if change.ChangeType == diff.Deleted {
+			paths = append(paths, change.OldName)
+		} else {
+			paths = append(paths, change.NewName)
+		}
+	}
+	return &LocalChanges{paths}
+}
+
+// unresolvedConflicts returns the conflicted paths which still contain conflict markers.
+func (sq *Sequencer) unresolvedConflicts(paths []string) ([]string, error) {
+	repoRoot, err := sq.repo.WorkTree()
+	if err != nil {
+		return nil, err
+	}
+	unresolved := make([]string, 0)
+	for _, path := range paths {
+		f, err := os.Open(filepath.Join(repoRoot, path))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			if strings.HasPrefix(scanner.Text(), "<<<<<<< ") || strings.HasPrefix(scanner.Text(), ">>>>>>> ") {
+				unresolved = append(unresolved, path)
+				break
+			}
+		}
+		_ = f.Close()
+	}
+	return unresolved, nil
+}
+
+func commitSubject(commit *objects.Commit) string {
+	return strings.SplitN(commit.Message, "\n", 2)[0]
+}
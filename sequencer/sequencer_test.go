@@ -0,0 +1,81 @@
+package sequencer_test
+
+import (
+	"os"
+	"patchy/objects"
+	"patchy/objects/objecttype"
+	"patchy/repo"
+	"patchy/repository"
+	"patchy/util"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// commitFile commits a tree holding only file.txt with content on top of parent, without touching HEAD.
+func commitFile(t *testing.T, r *repository.Repository, parent *string, message string, content string) string {
+	t.Helper()
+	blob, err := r.Objects.WriteObject(objecttype.Blob, []byte(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := r.Objects.BuildTree([]objects.TreeEntry{{Mode: "100644", Name: "file.txt", Hash: blob}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit, err := r.Objects.WriteCommitWithAuthor(tree, parent, message, "tester", time.Unix(1700000000, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return commit
+}
+
+// TestCherryPickRepository cherry-picks in a repository other than the one of the working directory, which only a
+// handle on it can reach.
+func TestCherryPickRepository(t *testing.T) {
+	util.Quiet = true
+	t.Cleanup(func() {
+		util.Quiet = false
+	})
+	t.Chdir(t.TempDir())
+	dir := t.TempDir()
+	if _, err := repo.InitRepo(dir); err != nil {
+		t.Fatal(err)
+	}
+	r, err := repository.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	base := commitFile(t, r, nil, "base", "1\n2\n3\n4\n5\n6\n7\n8\n")
+	main := commitFile(t, r, &base, "change the first line", "one\n2\n3\n4\n5\n6\n7\n8\n")
+	side := commitFile(t, r, &base, "change the last line", "1\n2\n3\n4\n5\n6\n7\neight\n")
+	if err := r.Refs.UpdateRef("refs/heads/main", main); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "file.txt"), []byte("one\n2\n3\n4\n5\n6\n7\n8\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.Sequencer.CherryPick([]string{side}); err != nil {
+		t.Fatal(err)
+	}
+	head, err := r.Refs.ReadHead()
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit, err := r.Objects.ReadCommit(head.Commit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if commit.Parent == nil || *commit.Parent != main || commit.Message != "change the last line" {
+		t.Errorf("HEAD is %+v, want the picked commit on top of main", commit)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "file.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "one\n2\n3\n4\n5\n6\n7\neight\n"; string(data) != want {
+		t.Errorf("file.txt is %q, want %q", data, want)
+	}
+}
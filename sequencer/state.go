@@ -0,0 +1,212 @@
+package sequencer
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"patchy/util"
+	"path/filepath"
+	"strings"
+)
+
+type Action int
+
+const (
+	ActionPick Action = iota
+	ActionRevert
+	ActionReword
+	ActionEdit
+	ActionSquash
+	ActionFixup
+	ActionDrop
+)
+
+func (action Action) String() string {
+	switch action {
+	case ActionPick:
+		return "pick"
+	case ActionRevert:
+		return "revert"
+	case ActionReword:
+		return "reword"
+	case ActionEdit:
+		return "edit"
+	case ActionSquash:
+		return "squash"
+	case ActionFixup:
+		return "fixup"
+	case ActionDrop:
+		return "drop"
+	default:
+		return "unknown"
+	}
+}
+
+func ParseAction(name string) (Action, bool) {
+	switch name {
+	case "pick", "p":
+		return ActionPick, true
+	case "revert":
+		return ActionRevert, true
+	case "reword", "r":
+		return ActionReword, true
+	case "edit", "e":
+		return ActionEdit, true
+	case "squash", "s":
+		return ActionSquash, true
+	case "fixup", "f":
+		return ActionFixup, true
+	case "drop", "d":
+		return ActionDrop, true
+	default:
+		return 0, false
+	}
+}
+
+type Step struct {
+	Action Action
+	Commit string
+}
+
+const (
+	sequencerDir = "sequencer"
+	rebaseDir    = "rebase"
+)
+
+// state is what is kept on disk while a sequence of commits is being applied, so that it can be resumed after a
+// conflict. The first step of the todo list is the one currently being applied.
+type state struct {
+	seq      *Sequencer
+	dir      string
+	origHead string
+	// headName is the branch being rebased, or empty if HEAD was detached or this is not a rebase
+	headName  string
+	todo      []Step
+	conflicts []string
+	// amend is the commit a rebase stopped at for editing, which --continue amends with any changes made since
+	amend string
+}
+
+func (s *state) rebasing() bool {
+	return filepath.Base(s.dir) == rebaseDir
+}
+
+func (s *state) operation() string {
+	return operationName(filepath.Base(s.dir))
+}
+
+func operationName(dirName string) string {
+	if dirName == rebaseDir {
+		return "rebase"
+	}
+	return "cherry-pick or revert"
+}
+
+func (sq *Sequencer) stateDir(dirName string) (string, error) {
+	localDir, err := sq.repo.LocalDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(localDir, dirName), nil
+}
+
+// loadState reads the saved state from the given directory of the repository, returning nil if no operation is in
+// progress there.
+func (sq *Sequencer) loadState(dirName string) (*state, error) {
+	dir, err := sq.stateDir(dirName)
+	if err != nil {
+		return nil, err
+	}
+	if exists, err := util.DoesFileExist(dir); err != nil || !exists {
+		return nil, err
+	}
+	s := &state{seq: sq, dir: dir}
+	for file, value := range map[string]*string{"head": &s.origHead, "head-name": &s.headName, "amend": &s.amend} {
+		data, err := os.ReadFile(filepath.Join(dir, file))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		*value = strings.TrimSpace(string(data))
+	}
+	lines, err := util.ReadFile(filepath.Join(dir, "todo"))
+	if err != nil {
+		return nil, err
+	}
+	if s.todo, err = sq.parseTodo(lines); err != nil {
+		return nil, err
+	}
+	if s.conflicts, err = util.ReadFile(filepath.Join(dir, "conflicts")); errors.Is(err, os.ErrNotExist) {
+		s.conflicts = nil
+	} else if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *state) save() error {
+	if err := os.MkdirAll(s.dir, os.ModePerm); err != nil {
+		return err
+	}
+	files := map[string]string{
+		"head":      s.origHead + "\n",
+		"head-name": s.headName + "\n",
+		"amend":     s.amend + "\n",
+		"todo":      s.seq.formatTodo(s.todo, false),
+		"conflicts": "",
+	}
+	for _, path := range s.conflicts {
+		files["conflicts"] += path + "\n"
+	}
+	for file, data := range files {
+		if err := os.WriteFile(filepath.Join(s.dir, file), []byte(data), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *state) remove() error {
+	return os.RemoveAll(s.dir)
+}
+
+// formatTodo writes out a todo list, one "<action> <commit> <subject>" line per step.
+func (sq *Sequencer) formatTodo(todo []Step, abbreviate bool) string {
+	var builder strings.Builder
+	for _, step := range todo {
+		subject := ""
+		if commit, err := sq.objects.ReadCommit(step.Commit); err == nil {
+			subject = commitSubject(commit)
+		}
+		hash := step.Commit
+		if abbreviate {
+			hash = hash[:7]
+		}
+		builder.WriteString(fmt.Sprintf("%s %s %s\n", step.Action, hash, subject))
+	}
+	return builder.String()
+}
+
+// parseTodo reads a todo list, ignoring blank lines and comments. Commits may be abbreviated, and anything after the
+// commit is ignored.
+func (sq *Sequencer) parseTodo(lines []string) ([]Step, error) {
+	todo := make([]Step, 0)
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		action, ok := ParseAction(fields[0])
+		if !ok {
+			return nil, &BadTodo{line, "unknown action '" + fields[0] + "'"}
+		}
+		if len(fields) < 2 {
+			return nil, &BadTodo{line, "missing commit"}
+		}
+		hash := fields[1]
+		if err := sq.objects.ResolveAndValidateObject(&hash); err != nil {
+			return nil, &BadTodo{line, "no commit '" + fields[1] + "'"}
+		}
+		todo = append(todo, Step{action, hash})
+	}
+	return todo, nil
+}
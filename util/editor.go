@@ -0,0 +1,31 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// Editor returns the command used to edit files: $PATCHY_EDITOR, $VISUAL or $EDITOR, whichever is set first, or vi.
+func Editor() string {
+	for _, name := range []string{"PATCHY_EDITOR", "VISUAL", "EDITOR"} {
+		if editor := os.Getenv(name); editor != "" {
+			return editor
+		}
+	}
+	return "vi"
+}
+
+// EditFile opens a file in the user's editor and waits for it to exit. The editor command is run by the shell, so it
+// may include arguments.
+func EditFile(path string) error {
+	editor := Editor()
+	cmd := exec.Command("sh", "-c", editor+` "$@"`, editor, path)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("there was a problem with the editor '%s': %w", editor, err)
+	}
+	return nil
+}
@@ -0,0 +1,7 @@
+package util
+
+import "errors"
+
+// ErrExitStatus is returned by commands which report failure only through their exit status, such as cat-file -e, to
+// exit with a non-zero status without printing an error.
+var ErrExitStatus = errors.New("exit status 1")
@@ -11,7 +11,7 @@ var Quiet bool
 
 func Print(a ...any) {
 	if !Quiet {
-		fmt.Print(a)
+		fmt.Print(a...)
 	}
 }
 